@@ -11,6 +11,10 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.```
+
+// Built with go run compilePlugins.go, keep it out of the service binary
+//go:build ignore
+
 package main
 
 import (
@@ -1,4 +1,4 @@
 #!/bin/bash
 
 go run compilePlugins.go
-go run main.go ticketLogic.go
\ No newline at end of file
+go run .
\ No newline at end of file
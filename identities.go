@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	b "ticketservice/internal/bigqueryfunctions"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// resolveIdentities turns routing identifiers into the ticket system's own
+// when the plugin knows how, dropping any it can't resolve.
+func resolveIdentities(identifiers []string) []string {
+	resolver, ok := ticketService.(t.IdentityResolver)
+	if !ok || len(identifiers) == 0 {
+		return identifiers
+	}
+	resolved, unresolved := resolver.ResolveIdentities(identifiers)
+	if len(unresolved) > 0 {
+		u.LogPrint(3, "Couldn't resolve %s", strings.Join(unresolved, ", "))
+	}
+	return resolved
+}
+
+// reportUnresolvedIdentities logs every identifier in the routing table the
+// plugin can't resolve, so typos show up before a ticket goes unassigned.
+func reportUnresolvedIdentities(routing *b.RoutingCache) {
+	resolver, ok := ticketService.(t.IdentityResolver)
+	if !ok {
+		return
+	}
+	identifiers := routing.Identifiers()
+	_, unresolved := resolver.ResolveIdentities(identifiers)
+	for _, identifier := range unresolved {
+		u.LogPrint(3, "Routing: TicketSystemIdentifier %q can't be resolved", identifier)
+	}
+	u.LogPrint(2, "Routing: resolved %d of %d identifiers", len(identifiers)-len(unresolved), len(identifiers))
+}
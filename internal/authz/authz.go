@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	b "ticketservice/internal/bigqueryfunctions"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// EventDenied is recorded in the ticket history when someone is refused
+const EventDenied = "denied"
+
+// Rules decide who may change a ticket: its assignees, the owners of the
+// route it came from and the admins.
+type Rules struct {
+	Enabled bool
+	// Backend identifiers of people allowed to change any ticket
+	Admins []string
+}
+
+// DeniedError explains why someone may not change a ticket
+type DeniedError struct {
+	User   string
+	Action string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s may not %s: %s", e.User, e.Action, e.Reason)
+}
+
+func (r *Rules) isAdmin(user string) bool {
+	for _, admin := range r.Admins {
+		if strings.EqualFold(admin, user) {
+			return true
+		}
+	}
+	return contains(resolve(r.Admins), user)
+}
+
+func contains(users []string, user string) bool {
+	for _, candidate := range users {
+		if candidate == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Check decides whether user may take action on ticket. A ticket without
+// an IssueKey is one about to be created, only its route owners and the
+// admins may create it.
+func (r *Rules) Check(user, action string, ticket *t.Ticket) error {
+	if !r.Enabled || r.isAdmin(user) {
+		return nil
+	}
+	if user == "" {
+		return &DeniedError{User: "anonymous", Action: action, Reason: "we couldn't tell who you are"}
+	}
+	if ticket.IssueKey != "" && contains(ticket.Assignee, user) {
+		return nil
+	}
+	owners, err := b.GetRouteOwners(ticket.TargetContact)
+	if err != nil {
+		// Without the route we can't tell, and refusing is the safe side
+		u.LogPrint(3, "Failed to get the owners of route %s: %v", ticket.TargetContact, err)
+		return &DeniedError{User: user, Action: action, Reason: "we couldn't check the route owners"}
+	}
+	if contains(owners, user) || contains(resolve(owners), user) {
+		return nil
+	}
+	if ticket.IssueKey == "" {
+		return &DeniedError{User: user, Action: action, Reason: "only the route owners and admins can do that"}
+	}
+	return &DeniedError{User: user, Action: action, Reason: "only the assignees, route owners and admins can do that"}
+}
+
+var resolver atomic.Pointer[func([]string) []string]
+
+// SetResolver lets admins and route owners be given as, I.E., emails that
+// the ticket system resolves to the identifiers its users act as.
+func SetResolver(fn func(identifiers []string) []string) {
+	resolver.Store(&fn)
+}
+
+func resolve(identifiers []string) []string {
+	fn := resolver.Load()
+	if fn == nil || len(identifiers) == 0 {
+		return nil
+	}
+	return (*fn)(identifiers)
+}
+
+var recorder atomic.Pointer[func([]*t.TicketHistory) error]
+
+// SetRecorder changes where denials are recorded, the history table
+// unless told otherwise. Tests use it to keep BigQuery out of the way.
+func SetRecorder(fn func(entries []*t.TicketHistory) error) {
+	recorder.Store(&fn)
+}
+
+func appendHistory(entries []*t.TicketHistory) error {
+	if fn := recorder.Load(); fn != nil && *fn != nil {
+		return (*fn)(entries)
+	}
+	return b.AppendHistory("", entries)
+}
+
+var current atomic.Pointer[Rules]
+
+// Current returns the rules in effect. Until SetCurrent is called
+// everyone may do everything.
+func Current() *Rules {
+	if r := current.Load(); r != nil {
+		return r
+	}
+	return &Rules{}
+}
+
+// SetCurrent swaps the rules in effect.
+func SetCurrent(r *Rules) {
+	current.Store(r)
+}
+
+// CheckAdmin decides whether user may take an action that isn't about a
+// single ticket, I.E. reloading the configuration. Only admins may.
+func (r *Rules) CheckAdmin(user, action string) error {
+	if !r.Enabled || r.isAdmin(user) {
+		return nil
+	}
+	if user == "" {
+		return &DeniedError{User: "anonymous", Action: action, Reason: "we couldn't tell who you are"}
+	}
+	return &DeniedError{User: user, Action: action, Reason: "only admins can do that"}
+}
+
+// Authorize checks the current rules, recording a denial in the ticket
+// history. The returned error is a *DeniedError when user was refused.
+func Authorize(user, action string, ticket *t.Ticket) error {
+	return record(user, action, ticket.IssueKey, Current().Check(user, action, ticket))
+}
+
+// AuthorizeAdmin is Authorize for actions only admins may take. Denials
+// are recorded in the history without an IssueKey.
+func AuthorizeAdmin(user, action string) error {
+	return record(user, action, "", Current().CheckAdmin(user, action))
+}
+
+func record(user, action, issueKey string, err error) error {
+	denied, ok := err.(*DeniedError)
+	if !ok {
+		return err
+	}
+	u.LogPrint(2, "Denied: %v", denied)
+	entry := &t.TicketHistory{
+		IssueKey: issueKey,
+		Event:    EventDenied,
+		User:     user,
+		Comment:  action + ": " + denied.Reason,
+	}
+	if err := appendHistory([]*t.TicketHistory{entry}); err != nil {
+		u.LogPrint(3, "Failed to record denial in ticket history: %v", err)
+	}
+	return denied
+}
@@ -15,14 +15,24 @@ package bigqueryfunctions
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"strings"
 
 	u "ticketservice/internal/utils"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	WithDestinationTable = managedwriter.WithDestinationTable
+	WithSchemaDescriptor = managedwriter.WithSchemaDescriptor
+
 )
 
 var (
@@ -85,6 +95,29 @@ func runQuery(query string)(*bigquery.RowIterator, error){
 	return iter, nil
 }
 
+// runDML runs a parameterized DML statement and returns the number of rows it touched.
+func runDML(query string, params []bigquery.QueryParameter) (int64, error) {
+	q := client.Query(query)
+	q.Parameters = params
+
+	job, err := q.Run(ctx)
+	if err != nil {
+		return 0, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := status.Err(); err != nil {
+		return 0, err
+	}
+	stats, ok := status.Statistics.Details.(*bigquery.QueryStatistics)
+	if !ok {
+		return 0, fmt.Errorf("DML job returned no query statistics")
+	}
+	return stats.NumDMLAffectedRows, nil
+}
+
 func QueryBigQueryToStruct(query string, t reflect.Type) ([]interface{}, error) {
 	// Execute the query
 	iter, err := runQuery(query)
@@ -214,4 +247,57 @@ func updateTableSchema(tableID string, schema bigquery.Schema) error {
 	// Print success message
 	u.LogPrint(1,"Table %s:%s.%s schema updated successfully\n", client.Project(), datasetID, tableID)
 	return nil
-}
\ No newline at end of file
+}
+
+// appendProtoRows writes rows to a table using the BQ Storage Write API.
+// m is only used for its descriptor, so an empty message of the row type is fine.
+func appendProtoRows(tableID string, m proto.Message, rows []proto.Message) error {
+	// Create a ManagedWriter client
+	client, err := managedwriter.NewClient(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("managedwriter.NewClient: %v", err)
+	}
+	defer client.Close()
+
+	// Define protocol buffer schema
+	descriptorProto, err := adapt.NormalizeDescriptor(m.ProtoReflect().Descriptor())
+	if err != nil {
+		return fmt.Errorf("error getting descriptor proto: %v", err)
+	}
+
+	// Create a ManagedStream using pending stream
+	tableName := fmt.Sprintf("projects/%s/datasets/%s/tables/%s", projectID, datasetID, tableID)
+	managedStream, err := client.NewManagedStream(ctx,
+		WithDestinationTable(tableName),
+		WithSchemaDescriptor(descriptorProto))
+	if err != nil {
+		return fmt.Errorf("error creating managed stream: %v", err)
+	}
+	defer managedStream.Close()
+
+	// Encode the rows into binary
+	encoded := make([][]byte, len(rows))
+	for k, row := range rows {
+		b, err := proto.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("error marshalling row: %v", err)
+		}
+		encoded[k] = b
+	}
+
+	// Send the rows to the service, and specify an offset for managing deduplication.
+	result, err := managedStream.AppendRows(ctx, encoded)
+	if err != nil {
+		return fmt.Errorf("error appending rows: %v", err)
+	}
+
+	// Block until the write is complete and return the result.
+	_ , err = result.GetResult(ctx)
+	if err != nil {
+		err1, err2 := result.FullResponse(ctx)
+		fmt.Printf("%+v\n", err1)
+		fmt.Printf("%+v\n", err2)
+		return fmt.Errorf("error getting result: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	t "ticketservice/internal/ticketinterfaces"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/protobuf/proto"
+)
+
+var historySchema = bigquery.Schema{
+	{Name: "IssueKey", Type: bigquery.StringFieldType, Required: true},
+	{Name: "EventDate", Type: bigquery.TimestampFieldType},
+	{Name: "Event", Type: bigquery.StringFieldType},
+	{Name: "User", Type: bigquery.StringFieldType},
+	{Name: "Reason", Type: bigquery.StringFieldType},
+	{Name: "Comment", Type: bigquery.StringFieldType},
+}
+
+// Set by CreateOrUpdateHistoryTable so plugins can append without knowing the table
+var historyTableID string
+
+func CreateOrUpdateHistoryTable(tableID string) error {
+	// Create the table if it does not already exist.
+	if err := createTable(tableID, historySchema); err != nil {
+		return err
+	}
+	// Update the table schema if necessary.
+	if err := updateTableSchema(tableID, historySchema); err != nil {
+		return err
+	}
+	historyTableID = tableID
+	return nil
+}
+
+// AppendHistory records entries in the ticket history, dating any entry without a date.
+func AppendHistory(tableID string, entries []*t.TicketHistory) error {
+	if tableID == "" {
+		tableID = historyTableID
+	}
+	now := time.Now().Format(time.RFC3339)
+	rows := make([]proto.Message, len(entries))
+	for k, entry := range entries {
+		if entry.EventDate == "" {
+			entry.EventDate = now
+		}
+		rows[k] = entry
+	}
+	return appendProtoRows(tableID, &t.TicketHistory{}, rows)
+}
+
+// GetTicketHistory returns the history of a ticket, oldest first.
+func GetTicketHistory(issueKey string) ([]*t.TicketHistory, error) {
+	var getHistoryQuery = `SELECT
+	IssueKey,
+	FORMAT_TIMESTAMP('%%Y-%%m-%%d %%H:%%M:%%S', EventDate) AS EventDate,
+	IFNULL(Event, "") AS Event,
+	IFNULL(User, "") AS User,
+	IFNULL(Reason, "") AS Reason,
+	IFNULL(Comment, "") AS Comment
+	FROM %s.%s
+	WHERE IssueKey = '%s'
+	ORDER BY EventDate
+	`
+	query := fmt.Sprintf(getHistoryQuery, datasetID, historyTableID, issueKey)
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(t.TicketHistory{}))
+	if err != nil {
+		return nil, err
+	}
+	var history []*t.TicketHistory
+	for _, row := range results {
+		entry, ok := row.(t.TicketHistory)
+		if !ok {
+			return nil, fmt.Errorf("failed to assert type TicketHistory")
+		}
+		history = append(history, &entry)
+	}
+	return history, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+var lockSchema = bigquery.Schema{
+	{Name: "Name", Type: bigquery.StringFieldType, Required: true},
+	{Name: "Owner", Type: bigquery.StringFieldType, Required: true},
+	{Name: "ExpiresAt", Type: bigquery.TimestampFieldType, Required: true},
+}
+
+// Unlike the ticket table, locks are updated in place with DML.
+// BigQuery serializes mutating DML on a table, and when two statements
+// conflict the later one fails instead of both succeeding.
+
+// %[1] is the dataset
+// %[2] is the lock table
+var acquireLockQuery = `MERGE %[1]s.%[2]s AS l
+USING (SELECT @name AS Name) AS n
+ON l.Name = n.Name
+WHEN MATCHED AND (l.ExpiresAt < CURRENT_TIMESTAMP() OR l.Owner = @owner) THEN
+  UPDATE SET Owner = @owner, ExpiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND)
+WHEN NOT MATCHED THEN
+  INSERT (Name, Owner, ExpiresAt) VALUES (@name, @owner, TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND))`
+
+var renewLockQuery = `UPDATE %[1]s.%[2]s
+SET ExpiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND)
+WHERE Name = @name AND Owner = @owner`
+
+var releaseLockQuery = `DELETE FROM %[1]s.%[2]s
+WHERE Name = @name AND Owner = @owner`
+
+var getLockQuery = `SELECT Owner, ExpiresAt FROM %[1]s.%[2]s WHERE Name = @name`
+
+func CreateOrUpdateLockTable(tableID string) error {
+	// Create the table if it does not already exist.
+	if err := createTable(tableID, lockSchema); err != nil {
+		return err
+	}
+	// Update the table schema if necessary.
+	if err := updateTableSchema(tableID, lockSchema); err != nil {
+		return err
+	}
+	return nil
+}
+
+func lockParams(name, owner string, ttl time.Duration) []bigquery.QueryParameter {
+	return []bigquery.QueryParameter{
+		{Name: "name", Value: name},
+		{Name: "owner", Value: owner},
+		{Name: "ttl", Value: int64(ttl.Seconds())},
+	}
+}
+
+// AcquireLock takes the named lock for owner. It returns false if
+// another owner holds a lease that hasn't expired.
+func AcquireLock(tableID, name, owner string, ttl time.Duration) (time.Time, bool, error) {
+	query := fmt.Sprintf(acquireLockQuery, datasetID, tableID)
+	affected, err := runDML(query, lockParams(name, owner, ttl))
+	if err != nil {
+		// A concurrent MERGE won, treat it like any other held lock
+		if strings.Contains(err.Error(), "concurrent update") {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	if affected == 0 {
+		return time.Time{}, false, nil
+	}
+	// Read it back to be sure we're the only owner
+	q := client.Query(fmt.Sprintf(getLockQuery, datasetID, tableID))
+	q.Parameters = []bigquery.QueryParameter{{Name: "name", Value: name}}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var row struct {
+		Owner     string
+		ExpiresAt time.Time
+	}
+	var expiresAt time.Time
+	for {
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if row.Owner != owner {
+			return time.Time{}, false, nil
+		}
+		expiresAt = row.ExpiresAt
+	}
+	return expiresAt, !expiresAt.IsZero(), nil
+}
+
+// RenewLock extends a lease owner holds. It returns false if the lease was lost.
+func RenewLock(tableID, name, owner string, ttl time.Duration) (bool, error) {
+	query := fmt.Sprintf(renewLockQuery, datasetID, tableID)
+	affected, err := runDML(query, lockParams(name, owner, ttl))
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ReleaseLock drops the lease if owner still holds it.
+func ReleaseLock(tableID, name, owner string) error {
+	query := fmt.Sprintf(releaseLockQuery, datasetID, tableID)
+	_, err := runDML(query, []bigquery.QueryParameter{
+		{Name: "name", Value: name},
+		{Name: "owner", Value: owner},
+	})
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+var queueSchema = bigquery.Schema{
+	{Name: "ID", Type: bigquery.StringFieldType, Required: true},
+	{Name: "Kind", Type: bigquery.StringFieldType, Required: true},
+	{Name: "Payload", Type: bigquery.BytesFieldType},
+	{Name: "Attempts", Type: bigquery.IntegerFieldType},
+	{Name: "EnqueuedAt", Type: bigquery.TimestampFieldType},
+	{Name: "LastError", Type: bigquery.StringFieldType},
+	{Name: "Receipt", Type: bigquery.StringFieldType},
+	{Name: "State", Type: bigquery.StringFieldType},
+	{Name: "VisibleAt", Type: bigquery.TimestampFieldType},
+}
+
+// Like locks, queued jobs are updated in place with DML. A job is Ready
+// until it's dead lettered, when it becomes Dead. It's claimed by setting a
+// receipt only the claimer knows, which it needs to settle the job.
+
+// %[1] is the dataset
+// %[2] is the queue table
+var enqueueJobQuery = `INSERT INTO %[1]s.%[2]s (ID, Kind, Payload, Attempts, EnqueuedAt, LastError, Receipt, State, VisibleAt)
+VALUES (@id, @kind, @payload, 0, CURRENT_TIMESTAMP(), "", "", "Ready", CURRENT_TIMESTAMP())`
+
+var claimJobQuery = `UPDATE %[1]s.%[2]s
+SET Receipt = @receipt,
+  Attempts = Attempts + 1,
+  VisibleAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @visibility SECOND)
+WHERE State = "Ready" AND VisibleAt <= CURRENT_TIMESTAMP()
+  AND ID = (
+    SELECT MIN(ID) FROM %[1]s.%[2]s
+    WHERE State = "Ready" AND VisibleAt <= CURRENT_TIMESTAMP()
+  )`
+
+var getJobsQuery = `SELECT ID, Kind, Payload, Attempts, EnqueuedAt, IFNULL(LastError, "") AS LastError, IFNULL(Receipt, "") AS Receipt
+FROM %[1]s.%[2]s
+WHERE %[3]s
+ORDER BY ID`
+
+var ackJobQuery = `DELETE FROM %[1]s.%[2]s
+WHERE ID = @id AND Receipt = @receipt`
+
+var retryJobQuery = `UPDATE %[1]s.%[2]s
+SET VisibleAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @delay SECOND), LastError = @error, Receipt = ""
+WHERE ID = @id AND Receipt = @receipt`
+
+var deadLetterJobQuery = `UPDATE %[1]s.%[2]s
+SET State = "Dead", LastError = @error, Receipt = ""
+WHERE ID = @id AND Receipt = @receipt`
+
+// QueuedJob is a row of the queue table
+type QueuedJob struct {
+	ID         string
+	Kind       string
+	Payload    []byte
+	Attempts   int64
+	EnqueuedAt time.Time
+	LastError  string
+	Receipt    string
+}
+
+func CreateOrUpdateQueueTable(tableID string) error {
+	// Create the table if it does not already exist.
+	if err := createTable(tableID, queueSchema); err != nil {
+		return err
+	}
+	// Update the table schema if necessary.
+	if err := updateTableSchema(tableID, queueSchema); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getJobs(tableID, condition string, params []bigquery.QueryParameter) ([]*QueuedJob, error) {
+	q := client.Query(fmt.Sprintf(getJobsQuery, datasetID, tableID, condition))
+	q.Parameters = params
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*QueuedJob
+	for {
+		var job QueuedJob
+		err := it.Next(&job)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// EnqueueJob adds a job, visible straight away
+func EnqueueJob(tableID, id, kind string, payload []byte) error {
+	_, err := runDML(fmt.Sprintf(enqueueJobQuery, datasetID, tableID), []bigquery.QueryParameter{
+		{Name: "id", Value: id},
+		{Name: "kind", Value: kind},
+		{Name: "payload", Value: payload},
+	})
+	return err
+}
+
+// ClaimJob hides the oldest visible job for visibility and tags it with
+// receipt. It returns nil when there is no job, or another replica claimed it first.
+func ClaimJob(tableID, receipt string, visibility time.Duration) (*QueuedJob, error) {
+	affected, err := runDML(fmt.Sprintf(claimJobQuery, datasetID, tableID), []bigquery.QueryParameter{
+		{Name: "receipt", Value: receipt},
+		{Name: "visibility", Value: int64(visibility.Seconds())},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "concurrent update") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, nil
+	}
+	jobs, err := getJobs(tableID, "Receipt = @receipt", []bigquery.QueryParameter{{Name: "receipt", Value: receipt}})
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+func settleParams(id, receipt string, extra ...bigquery.QueryParameter) []bigquery.QueryParameter {
+	return append([]bigquery.QueryParameter{
+		{Name: "id", Value: id},
+		{Name: "receipt", Value: receipt},
+	}, extra...)
+}
+
+// AckJob removes a job. It returns false if the receipt is no longer the job's.
+func AckJob(tableID, id, receipt string) (bool, error) {
+	affected, err := runDML(fmt.Sprintf(ackJobQuery, datasetID, tableID), settleParams(id, receipt))
+	return affected > 0, err
+}
+
+// RetryJob makes a job visible again after delay. It returns false if the receipt is no longer the job's.
+func RetryJob(tableID, id, receipt string, delay time.Duration, lastError string) (bool, error) {
+	affected, err := runDML(fmt.Sprintf(retryJobQuery, datasetID, tableID), settleParams(id, receipt,
+		bigquery.QueryParameter{Name: "delay", Value: int64(delay.Seconds())},
+		bigquery.QueryParameter{Name: "error", Value: lastError},
+	))
+	return affected > 0, err
+}
+
+// DeadLetterJob sets a job aside. It returns false if the receipt is no longer the job's.
+func DeadLetterJob(tableID, id, receipt string, lastError string) (bool, error) {
+	affected, err := runDML(fmt.Sprintf(deadLetterJobQuery, datasetID, tableID), settleParams(id, receipt,
+		bigquery.QueryParameter{Name: "error", Value: lastError},
+	))
+	return affected > 0, err
+}
+
+// GetDeadJobs returns the dead lettered jobs, oldest first
+func GetDeadJobs(tableID string) ([]*QueuedJob, error) {
+	return getJobs(tableID, `State = "Dead"`, nil)
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// ErrRecommendationNotFound is returned when the export no longer has a recommendation
+var ErrRecommendationNotFound = errors.New("Could not find recommendation")
+
+// The flattened recommendations export, set by SetRecommendationsTable
+var recommendationsTableID string
+
+// SetRecommendationsTable names the flattened recommendations table,
+// so plugins can look up the recommendation of a ticket.
+func SetRecommendationsTable(tableID string) {
+	recommendationsTableID = tableID
+}
+
+// GetRecommendation returns the recommendation of a recommender for a
+// resource, the one with the highest cost impact if there are several.
+func GetRecommendation(targetResource, recommenderName string) (*t.RecommendationQueryResult, error) {
+	var getRecommendationQuery = `SELECT
+	IFNULL(f.project_name, "") AS ProjectName,
+	IFNULL(f.project_id, "") AS ProjectID,
+	f.recommender_name AS RecommenderName,
+	f.location AS Location,
+	f.recommender_subtype AS RecommenderSubtype,
+	f.impact_cost_unit AS ImpactCostUnit,
+	f.impact_currency_code AS ImpactCurrencyCode,
+	f.description AS Description,
+	TargetResource
+	FROM %s.%s AS f
+	CROSS JOIN UNNEST(target_resources) AS TargetResource
+	WHERE TargetResource = '%s' AND f.recommender_name = '%s'
+	ORDER BY f.impact_cost_unit DESC
+	LIMIT 1
+	`
+	query := fmt.Sprintf(getRecommendationQuery, datasetID, recommendationsTableID, targetResource, recommenderName)
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(t.RecommendationQueryResult{}))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) < 1 {
+		return nil, fmt.Errorf("%w: %v %v", ErrRecommendationNotFound, recommenderName, targetResource)
+	}
+	row, ok := results[0].(t.RecommendationQueryResult)
+	if !ok {
+		return nil, fmt.Errorf("failed to assert type RecommendationQueryResult")
+	}
+	return &row, nil
+}
+
+// GetTicketSubtype returns the recommender subtype of the recommendation a
+// ticket was created for, tickets only record the recommender.
+func GetTicketSubtype(ticket *t.Ticket) (string, error) {
+	row, err := GetRecommendation(ticket.TargetResource, ticket.RecommenderID)
+	if err != nil {
+		return "", err
+	}
+	return row.RecommenderSubtype, nil
+}
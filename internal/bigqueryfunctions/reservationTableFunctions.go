@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	t "ticketservice/internal/ticketinterfaces"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/protobuf/proto"
+)
+
+// Reservation states. Like the ticket table, the reservation table is append only
+// and the latest row for a (TargetResource, RecommenderID) pair is its current state.
+const (
+	// Written before the backend is called
+	ReservationPending = "Pending"
+	// The backend returned an IssueKey, but the ticket row may not be written yet
+	ReservationCreated = "Created"
+	// The ticket row has been written, nothing left to do
+	ReservationFinalized = "Finalized"
+	// The backend never created the ticket, the next run may try again
+	ReservationReleased = "Released"
+)
+
+// reservationDateFormat keeps microseconds, the most a TIMESTAMP holds. A
+// reservation goes from Pending to Created to Finalized within a second, so
+// whole seconds would leave the latest row to chance.
+const reservationDateFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+var reservationSchema = bigquery.Schema{
+	{Name: "TargetResource", Type: bigquery.StringFieldType, Required: true},
+	{Name: "RecommenderID", Type: bigquery.StringFieldType, Required: true},
+	{Name: "RecommenderSubtype", Type: bigquery.StringFieldType},
+	{Name: "ProjectID", Type: bigquery.StringFieldType},
+	{Name: "State", Type: bigquery.StringFieldType},
+	{Name: "IssueKey", Type: bigquery.StringFieldType},
+	{Name: "TargetContact", Type: bigquery.StringFieldType},
+	{Name: "Subject", Type: bigquery.StringFieldType},
+	{Name: "Assignee", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "Owner", Type: bigquery.StringFieldType},
+	{Name: "CreationDate", Type: bigquery.TimestampFieldType},
+	{Name: "LastUpdateDate", Type: bigquery.TimestampFieldType},
+	{Name: "Locale", Type: bigquery.StringFieldType},
+}
+
+// %[1] is the dataset
+// %[2] is the reservation table
+// %[3] is the age in seconds after which an open reservation is considered orphaned
+// Rows written at the same time are told apart by how far along their state is.
+var getOrphanedReservationsQuery = `SELECT
+  TargetResource,
+  RecommenderID,
+  IFNULL(RecommenderSubtype, "") AS RecommenderSubtype,
+  IFNULL(ProjectID, "") AS ProjectID,
+  State,
+  IFNULL(IssueKey, "") AS IssueKey,
+  IFNULL(TargetContact, "") AS TargetContact,
+  IFNULL(Subject, "") AS Subject,
+  Assignee,
+  IFNULL(Owner, "") AS Owner,
+  FORMAT_TIMESTAMP('%%FT%%T%%z', CreationDate) AS CreationDate,
+  FORMAT_TIMESTAMP('%%FT%%T%%z', LastUpdateDate) AS LastUpdateDate,
+  IFNULL(Locale, "") AS Locale
+FROM (
+  SELECT *,
+    ROW_NUMBER() OVER (PARTITION BY TargetResource, RecommenderID ORDER BY LastUpdateDate DESC,
+      CASE State WHEN "Pending" THEN 0 WHEN "Created" THEN 1 ELSE 2 END DESC) AS rn
+  FROM %[1]s.%[2]s
+)
+WHERE rn = 1
+  AND State IN ("Pending", "Created")
+  AND LastUpdateDate < TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL %[3]d SECOND)`
+
+func CreateOrUpdateReservationTable(tableID string) error {
+	// Create the table if it does not already exist.
+	if err := createTable(tableID, reservationSchema); err != nil {
+		return err
+	}
+	// Update the table schema if necessary.
+	if err := updateTableSchema(tableID, reservationSchema); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AppendReservations records the new state of each reservation.
+func AppendReservations(tableID string, reservations []*t.TicketReservation) error {
+	now := time.Now().Format(reservationDateFormat)
+	rows := make([]proto.Message, len(reservations))
+	for k, r := range reservations {
+		if r.CreationDate == "" {
+			r.CreationDate = now
+		}
+		r.LastUpdateDate = now
+		rows[k] = r
+	}
+	return appendProtoRows(tableID, &t.TicketReservation{}, rows)
+}
+
+// GetOrphanedReservations returns reservations that are still Pending or Created
+// and haven't been touched for longer than olderThan.
+func GetOrphanedReservations(tableID string, olderThan time.Duration) ([]*t.TicketReservation, error) {
+	query := fmt.Sprintf(getOrphanedReservationsQuery, datasetID, tableID, int64(olderThan.Seconds()))
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(t.TicketReservation{}))
+	if err != nil {
+		return nil, err
+	}
+	var reservations []*t.TicketReservation
+	for _, row := range results {
+		r, ok := row.(t.TicketReservation)
+		if !ok {
+			return nil, fmt.Errorf("failed to assert type TicketReservation")
+		}
+		reservations = append(reservations, &r)
+	}
+	return reservations, nil
+}
@@ -16,19 +16,37 @@ package bigqueryfunctions
 import (
 	"cloud.google.com/go/bigquery"
 	"fmt"
+	"google.golang.org/api/iterator"
 	"reflect"
+	"sort"
+	"sync/atomic"
 )
 
 type routingRow struct {
 	Target string
 	ProjectID string
 	TicketSystemIdentifiers	[]string
+	// Locale of tickets for this route, empty uses the target contact's or the default
+	Locale string
+	// Create the route's channels private
+	Private bool
+	// Emails of people outside the workspace to invite with Slack Connect
+	ExternalInvites []string
+}
+
+// RouteOptions are how the ticket system should treat the tickets of a route.
+type RouteOptions struct {
+	Private         bool
+	ExternalInvites []string
 }
 
 var routingSchema = bigquery.Schema{
 	{Name: "Target", Type: bigquery.StringFieldType, Required: true},
 	{Name: "ProjectID", Type: bigquery.StringFieldType},
 	{Name: "TicketSystemIdentifiers", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "Locale", Type: bigquery.StringFieldType},
+	{Name: "Private", Type: bigquery.BooleanFieldType},
+	{Name: "ExternalInvites", Type: bigquery.StringFieldType, Repeated: true},
 }
 
 var getTargetByProjectIDQuery = `Select * from %v.%v.%v 
@@ -37,7 +55,81 @@ var getTargetByProjectIDQuery = `Select * from %v.%v.%v
     				order by 5
 				limit 1`
 
+var getRouteOwnersQuery = `SELECT DISTINCT owner
+				FROM %v.%v.%v, UNNEST(TicketSystemIdentifiers) AS owner
+				WHERE Target = @target`
+
+var getAllRoutingQuery = `SELECT Target, IFNULL(ProjectID, "") AS ProjectID, TicketSystemIdentifiers, IFNULL(Locale, "") AS Locale,
+				IFNULL(Private, false) AS Private, ExternalInvites
+				FROM %v.%v.%v
+				ORDER BY ProjectID, Target`
+
+// RoutingCache is a snapshot of the routing table keyed by ProjectID.
+type RoutingCache struct {
+	rows map[string][]routingRow
+}
+
+var routingCache atomic.Pointer[RoutingCache]
+
+// Set by CreateOrUpdateRoutingTable so plugins can look up routes without knowing the table
+var routingTableID string
+
+// LoadRoutingCache reads the whole routing table. The result isn't used
+// until it's passed to SetRoutingCache.
+func LoadRoutingCache(tableID string) (*RoutingCache, error) {
+	query := fmt.Sprintf(getAllRoutingQuery, projectID, datasetID, tableID)
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(routingRow{}))
+	if err != nil {
+		return nil, err
+	}
+	cache := &RoutingCache{rows: make(map[string][]routingRow)}
+	for _, row := range results {
+		r, ok := row.(routingRow)
+		if !ok {
+			return nil, fmt.Errorf("failed to assert type routingRow")
+		}
+		cache.rows[r.ProjectID] = append(cache.rows[r.ProjectID], r)
+	}
+	return cache, nil
+}
+
+// Projects is the number of projects with routing.
+func (r *RoutingCache) Projects() int {
+	return len(r.rows)
+}
+
+// Identifiers lists every TicketSystemIdentifier in the routing, sorted.
+func (r *RoutingCache) Identifiers() []string {
+	seen := make(map[string]bool)
+	var identifiers []string
+	for _, rows := range r.rows {
+		for _, row := range rows {
+			for _, identifier := range row.TicketSystemIdentifiers {
+				if !seen[identifier] {
+					seen[identifier] = true
+					identifiers = append(identifiers, identifier)
+				}
+			}
+		}
+	}
+	sort.Strings(identifiers)
+	return identifiers
+}
+
+// SetRoutingCache swaps the routing used by GetRoutingRowsByProjectID.
+func SetRoutingCache(cache *RoutingCache) {
+	routingCache.Store(cache)
+}
+
+// GetRoutingRowsByProjectID returns the routing for a project, from the
+// cache when one has been loaded and from the table otherwise.
 func GetRoutingRowsByProjectID(tableID string, project string)([]routingRow, error){
+	if tableID == "" {
+		tableID = routingTableID
+	}
+	if cache := routingCache.Load(); cache != nil {
+		return cache.rows[project], nil
+	}
 	query := fmt.Sprintf(getTargetByProjectIDQuery,projectID, datasetID, tableID, project)
 	t := reflect.TypeOf(routingRow{})
 	results, err := QueryBigQueryToStruct(query, t)
@@ -58,6 +150,62 @@ func GetRoutingRowsByProjectID(tableID string, project string)([]routingRow, err
 	return rows, nil
 }
 
+// GetRouteOptions returns the options of the route a project's tickets to
+// target came from, the zero options if there is no such route.
+func GetRouteOptions(project, target string) (RouteOptions, error) {
+	rows, err := GetRoutingRowsByProjectID("", project)
+	if err != nil {
+		return RouteOptions{}, err
+	}
+	for _, row := range rows {
+		if row.Target == target {
+			return RouteOptions{Private: row.Private, ExternalInvites: row.ExternalInvites}, nil
+		}
+	}
+	return RouteOptions{}, nil
+}
+
+// GetRouteOwners returns everyone named by a route to target, from the
+// cache when one has been loaded and from the table otherwise.
+func GetRouteOwners(target string) ([]string, error) {
+	var owners []string
+	if cache := routingCache.Load(); cache != nil {
+		seen := make(map[string]bool)
+		for _, rows := range cache.rows {
+			for _, row := range rows {
+				if row.Target != target {
+					continue
+				}
+				for _, owner := range row.TicketSystemIdentifiers {
+					if !seen[owner] {
+						seen[owner] = true
+						owners = append(owners, owner)
+					}
+				}
+			}
+		}
+		return owners, nil
+	}
+	q := client.Query(fmt.Sprintf(getRouteOwnersQuery, projectID, datasetID, routingTableID))
+	q.Parameters = []bigquery.QueryParameter{{Name: "target", Value: target}}
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var row struct{ Owner string `bigquery:"owner"` }
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, row.Owner)
+	}
+	return owners, nil
+}
+
 func CreateOrUpdateRoutingTable(tableID string) error {
 	// Create the table if it does not already exist.
 	if err := createTable(tableID, routingSchema); err != nil {
@@ -67,6 +215,7 @@ func CreateOrUpdateRoutingTable(tableID string) error {
 	if err := updateTableSchema(tableID, routingSchema); err != nil {
 		return err
 	}
+	routingTableID = tableID
 	// Return nil if the table was created or updated successfully.
 	return nil
 }
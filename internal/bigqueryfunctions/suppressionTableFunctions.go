@@ -0,0 +1,299 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigqueryfunctions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	t "ticketservice/internal/ticketinterfaces"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/protobuf/proto"
+)
+
+// Suppression states, the latest row for an ID is its current state
+const (
+	SuppressionActive  = "Active"
+	SuppressionDeleted = "Deleted"
+)
+
+// ErrSuppressionNotFound is returned when there is no suppression with an ID
+var ErrSuppressionNotFound = errors.New("Could not find suppression")
+
+var suppressionSchema = bigquery.Schema{
+	{Name: "ID", Type: bigquery.StringFieldType, Required: true},
+	{Name: "TargetResource", Type: bigquery.StringFieldType},
+	{Name: "RecommenderSubtype", Type: bigquery.StringFieldType},
+	{Name: "ProjectID", Type: bigquery.StringFieldType},
+	{Name: "Labels", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "ExpiryDate", Type: bigquery.TimestampFieldType},
+	{Name: "Reason", Type: bigquery.StringFieldType},
+	{Name: "Owner", Type: bigquery.StringFieldType},
+	{Name: "State", Type: bigquery.StringFieldType},
+	{Name: "CreationDate", Type: bigquery.TimestampFieldType},
+	{Name: "LastUpdateDate", Type: bigquery.TimestampFieldType},
+}
+
+// %[1] is the dataset
+// %[2] is the suppression table
+// The columns are renamed so they can't be mistaken for the columns of the
+// recommendation they are matched against.
+var activeSuppressionsQuery = `SELECT
+    ID AS SuppressionID,
+    IFNULL(TargetResource, "") AS SuppressedResource,
+    IFNULL(RecommenderSubtype, "") AS SuppressedSubtype,
+    IFNULL(ProjectID, "") AS SuppressedProject,
+    Labels AS SuppressedLabels,
+    IFNULL(Reason, "") AS Reason,
+    IFNULL(Owner, "") AS Owner,
+    CreationDate
+  FROM (
+    SELECT *,
+      ROW_NUMBER() OVER (PARTITION BY ID ORDER BY LastUpdateDate DESC) AS rn
+    FROM %[1]s.%[2]s
+  )
+  WHERE rn = 1
+    AND State = "Active"
+    AND (ExpiryDate IS NULL OR ExpiryDate > CURRENT_TIMESTAMP())`
+
+// %[1] is the dataset
+// %[2] is the suppression table
+// %[3] is a condition on the latest row of each ID
+var getSuppressionsQuery = `SELECT
+  ID,
+  IFNULL(TargetResource, "") AS TargetResource,
+  IFNULL(RecommenderSubtype, "") AS RecommenderSubtype,
+  IFNULL(ProjectID, "") AS ProjectID,
+  Labels,
+  IFNULL(FORMAT_TIMESTAMP('%%FT%%T%%z', ExpiryDate), "") AS ExpiryDate,
+  IFNULL(Reason, "") AS Reason,
+  IFNULL(Owner, "") AS Owner,
+  State,
+  FORMAT_TIMESTAMP('%%FT%%T%%z', CreationDate) AS CreationDate,
+  FORMAT_TIMESTAMP('%%FT%%T%%z', LastUpdateDate) AS LastUpdateDate
+FROM (
+  SELECT *,
+    ROW_NUMBER() OVER (PARTITION BY ID ORDER BY LastUpdateDate DESC) AS rn
+  FROM %[1]s.%[2]s
+)
+WHERE rn = 1 AND %[3]s
+ORDER BY CreationDate`
+
+// %[1] is the active suppressions
+// %[2] is the recommender export table
+// %[3] is the condition matching a suppression to a recommendation
+var suppressedSavingsQuery = `WITH matched AS (
+  SELECT s.SuppressionID, s.Reason, s.Owner, f.impact_cost_unit, f.impact_currency_code
+  FROM %[2]s AS f
+  CROSS JOIN UNNEST(target_resources) AS TargetResource
+  CROSS JOIN (%[1]s) AS s
+  WHERE %[3]s
+  -- A recommendation matching several suppressions only counts towards the oldest
+  QUALIFY ROW_NUMBER() OVER (PARTITION BY f.recommender_name, TargetResource ORDER BY s.CreationDate, s.SuppressionID) = 1
+)
+SELECT
+  SuppressionID AS ID,
+  Reason,
+  Owner,
+  IFNULL(impact_currency_code, "") AS CurrencyCode,
+  COUNT(*) AS Recommendations,
+  SUM(IFNULL(impact_cost_unit, 0)) AS Savings
+FROM matched
+GROUP BY ID, Reason, Owner, CurrencyCode
+ORDER BY Savings DESC`
+
+// SuppressedSavings is the cost impact of the recommendations a suppression hides, in one currency
+type SuppressedSavings struct {
+	ID              string
+	Reason          string
+	Owner           string
+	CurrencyCode    string
+	Recommendations int64
+	Savings         int64
+}
+
+// Set by CreateOrUpdateSuppressionTable so plugins can suppress without knowing the table
+var suppressionTableID string
+
+func CreateOrUpdateSuppressionTable(tableID string) error {
+	// Create the table if it does not already exist.
+	if err := createTable(tableID, suppressionSchema); err != nil {
+		return err
+	}
+	// Update the table schema if necessary.
+	if err := updateTableSchema(tableID, suppressionSchema); err != nil {
+		return err
+	}
+	suppressionTableID = tableID
+	return nil
+}
+
+// NewSuppressionID returns a random ID for a new suppression.
+func NewSuppressionID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// AppendSuppressions records the new state of each suppression.
+func AppendSuppressions(tableID string, suppressions []*t.Suppression) error {
+	if tableID == "" {
+		tableID = suppressionTableID
+	}
+	now := time.Now().Format(time.RFC3339)
+	rows := make([]proto.Message, len(suppressions))
+	for k, s := range suppressions {
+		if s.CreationDate == "" {
+			s.CreationDate = now
+		}
+		s.LastUpdateDate = now
+		rows[k] = s
+	}
+	return appendProtoRows(tableID, &t.Suppression{}, rows)
+}
+
+func querySuppressions(tableID string, condition string) ([]*t.Suppression, error) {
+	query := fmt.Sprintf(getSuppressionsQuery, datasetID, tableID, condition)
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(t.Suppression{}))
+	if err != nil {
+		return nil, err
+	}
+	var suppressions []*t.Suppression
+	for _, row := range results {
+		s, ok := row.(t.Suppression)
+		if !ok {
+			return nil, fmt.Errorf("failed to assert type Suppression")
+		}
+		suppressions = append(suppressions, &s)
+	}
+	return suppressions, nil
+}
+
+// GetActiveSuppressions returns the suppressions that are in effect, oldest first.
+func GetActiveSuppressions(tableID string) ([]*t.Suppression, error) {
+	return querySuppressions(tableID, `State = "Active" AND (ExpiryDate IS NULL OR ExpiryDate > CURRENT_TIMESTAMP())`)
+}
+
+// GetSuppression returns the current state of a suppression, even when it has been deleted.
+func GetSuppression(tableID string, id string) (*t.Suppression, error) {
+	suppressions, err := querySuppressions(tableID, fmt.Sprintf("ID = '%s'", id))
+	if err != nil {
+		return nil, err
+	}
+	if len(suppressions) < 1 {
+		return nil, fmt.Errorf("%w: %v", ErrSuppressionNotFound, id)
+	}
+	return suppressions[0], nil
+}
+
+// SuppressResource suppresses the recommendations of subtype for a single
+// resource, the way dismissing its ticket does. An empty subtype suppresses
+// every recommendation for the resource.
+func SuppressResource(tableID, targetResource, subtype, reason, owner string) error {
+	id, err := NewSuppressionID()
+	if err != nil {
+		return err
+	}
+	return AppendSuppressions(tableID, []*t.Suppression{{
+		ID:                 id,
+		TargetResource:     targetResource,
+		RecommenderSubtype: subtype,
+		Reason:             reason,
+		Owner:              owner,
+		State:              SuppressionActive,
+	}})
+}
+
+// LiftResourceSuppressions deletes the active suppressions scoped to just
+// the resource and subtype, the way reopening a dismissed ticket does.
+// Wider suppressions, by project or labels, stay in effect.
+func LiftResourceSuppressions(tableID, targetResource, subtype string) error {
+	if tableID == "" {
+		tableID = suppressionTableID
+	}
+	suppressions, err := querySuppressions(tableID, fmt.Sprintf(
+		`State = "Active" AND TargetResource = %q AND IFNULL(RecommenderSubtype, "") = %q AND IFNULL(ProjectID, "") = "" AND ARRAY_LENGTH(Labels) = 0`,
+		targetResource, subtype))
+	if err != nil || len(suppressions) == 0 {
+		return err
+	}
+	for _, s := range suppressions {
+		s.State = SuppressionDeleted
+	}
+	return AppendSuppressions(tableID, suppressions)
+}
+
+// suppressionMatchSQL is the condition of a suppression s matching a
+// recommendation, given its resource, subtype, project and labels columns.
+// Every part of the suppression that is set has to match. labelsColumn
+// holds the labels as an ARRAY<STRUCT<key STRING, value STRING>>, without
+// it suppressions with labels never match.
+func suppressionMatchSQL(resourceColumn, subtypeColumn, projectColumn, labelsColumn string) string {
+	labels := "ARRAY_LENGTH(s.SuppressedLabels) = 0"
+	if labelsColumn != "" {
+		labels = fmt.Sprintf(`NOT EXISTS (
+      SELECT 1 FROM UNNEST(s.SuppressedLabels) AS selector
+      WHERE selector NOT IN (SELECT CONCAT(l.key, "=", l.value) FROM UNNEST(%s) AS l)
+    )`, labelsColumn)
+	}
+	return fmt.Sprintf(`(s.SuppressedResource = "" OR s.SuppressedResource = %s)
+    AND (s.SuppressedSubtype = "" OR s.SuppressedSubtype = %s)
+    AND (s.SuppressedProject = "" OR s.SuppressedProject = %s)
+    AND %s`, resourceColumn, subtypeColumn, projectColumn, labels)
+}
+
+// SuppressionFilterSQL builds the AND clause of CheckQueryTpl leaving out
+// recommendations matched by an active suppression.
+func SuppressionFilterSQL(tableID, resourceColumn, subtypeColumn, projectColumn, labelsColumn string) string {
+	return fmt.Sprintf(`AND NOT EXISTS (
+    SELECT 1 FROM (%s) AS s
+    WHERE %s
+  )`,
+		fmt.Sprintf(activeSuppressionsQuery, datasetID, tableID),
+		suppressionMatchSQL(resourceColumn, subtypeColumn, projectColumn, labelsColumn))
+}
+
+// GetSuppressedSavings reports what each active suppression hides from the
+// recommendations table. A recommendation matched by several suppressions
+// is only counted once.
+func GetSuppressedSavings(tableID, recommendationsTable, labelsColumn string) ([]SuppressedSavings, error) {
+	if labelsColumn != "" {
+		labelsColumn = "f." + labelsColumn
+	}
+	query := fmt.Sprintf(suppressedSavingsQuery,
+		fmt.Sprintf(activeSuppressionsQuery, datasetID, tableID),
+		fmt.Sprintf("%s.%s", datasetID, recommendationsTable),
+		suppressionMatchSQL("TargetResource", "f.recommender_subtype", "f.project_id", labelsColumn))
+	results, err := QueryBigQueryToStruct(query, reflect.TypeOf(SuppressedSavings{}))
+	if err != nil {
+		return nil, err
+	}
+	savings := make([]SuppressedSavings, len(results))
+	for i, row := range results {
+		s, ok := row.(SuppressedSavings)
+		if !ok {
+			return nil, fmt.Errorf("failed to assert type SuppressedSavings")
+		}
+		savings[i] = s
+	}
+	return savings, nil
+}
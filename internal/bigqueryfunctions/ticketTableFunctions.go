@@ -15,21 +15,18 @@
 package bigqueryfunctions
 
 import (
+	"errors"
 	"fmt"
 	t "ticketservice/internal/ticketinterfaces"
 	u "ticketservice/internal/utils"
 	"reflect"
-	"cloud.google.com/go/bigquery/storage/managedwriter"
-	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"strings"
 	"cloud.google.com/go/bigquery"
 	"google.golang.org/protobuf/proto"
 )
 
-var (
-	WithDestinationTable = managedwriter.WithDestinationTable
-	WithSchemaDescriptor = managedwriter.WithSchemaDescriptor
-
-)
+// ErrTicketNotFound is returned when no row exists for an IssueKey
+var ErrTicketNotFound = errors.New("Could not find ticket")
 
 var ticketSchema = bigquery.Schema{
 	{Name: "IssueKey", Type: bigquery.StringFieldType, Required: true},
@@ -44,6 +41,9 @@ var ticketSchema = bigquery.Schema{
 	{Name: "Subject", Type: bigquery.StringFieldType},
 	{Name: "Assignee", Type: bigquery.StringFieldType, Repeated: true},
 	{Name: "UserRecommendation", Type: bigquery.BooleanFieldType},
+	{Name: "Locale", Type: bigquery.StringFieldType},
+	{Name: "Reason", Type: bigquery.StringFieldType},
+	{Name: "Comment", Type: bigquery.StringFieldType},
 }
 
 // An arguement could be made to make this a service that has it's own client.
@@ -85,91 +85,94 @@ func AppendTicketsToTable(tableID string, tickets []*t.Ticket) error {
 	if tableID == "" {
 		tableID = ticketTableID
 	}
-	// Create a ManagedWriter client
-	client, err := managedwriter.NewClient(ctx, projectID)
-	if err != nil {
-		return fmt.Errorf("managedwriter.NewClient: %v", err)
-	}
-	defer client.Close()
-	
-	// Define protocol buffer schema
-	m := &t.Ticket{}
-	descriptorProto, err := adapt.NormalizeDescriptor(m.ProtoReflect().Descriptor())
-	if err != nil {
-		return fmt.Errorf("error getting descriptor proto: %v", err)
-	}
-
-	// Create a ManagedStream using pending stream
-	tableName := fmt.Sprintf("projects/%s/datasets/%s/tables/%s", projectID, datasetID, tableID)
-	managedStream, err := client.NewManagedStream(ctx,
-		WithDestinationTable(tableName),
-		WithSchemaDescriptor(descriptorProto))
-	defer managedStream.Close()
-	if err != nil {
-		return fmt.Errorf("error creating managed stream: %v", err)
-	}
-
-	// Encode the tickets into binary
-	encoded := make([][]byte, len(tickets))
+	rows := make([]proto.Message, len(tickets))
 	for k, ticket := range tickets {
-		b, err := proto.Marshal(ticket)
-		if err != nil {
-			return fmt.Errorf("error marshalling ticket: %v", err)
-		}
-		encoded[k] = b
+		rows[k] = ticket
 	}
-
-	// Send the rows to the service, and specify an offset for managing deduplication.
-	result, err := managedStream.AppendRows(ctx, encoded)
-	if err != nil {
-		return fmt.Errorf("error appending rows: %v", err)
-	}
-
-	// Block until the write is complete and return the result.
-	_ , err = result.GetResult(ctx)
-	if err != nil {
-		err1, err2 := result.FullResponse(ctx)
-		fmt.Printf("%+v\n", err1)
-		fmt.Printf("%+v\n", err2)
-		return fmt.Errorf("error getting result: %v", err)
+	if err := appendProtoRows(tableID, &t.Ticket{}, rows); err != nil {
+		return err
 	}
 	u.LogPrint(1,"Inserted %d rows into BigQuery", len(tickets))
 	return nil
 }
 
-func GetTicketByIssueKey(issueKey string) (*t.Ticket, error) {
-	// Build the SQL query to retrieve the ticket with the matching issueKey.
-	var GetTicketQuery = `SELECT 
-	IssueKey,
+// ticketColumns selects a ticket in the layout GetTicketByIssueKey has always returned
+const ticketColumns = `IssueKey,
     TargetContact,
-    FORMAT_TIMESTAMP('%%Y-%%m-%%d %%H:%%M:%%S', CreationDate) AS CreationDate,
+    FORMAT_TIMESTAMP('%Y-%m-%d %H:%M:%S', CreationDate) AS CreationDate,
     Status,
     TargetResource,
     RecommenderID,
-    FORMAT_TIMESTAMP('%%Y-%%m-%%d %%H:%%M:%%S', LastUpdateDate) AS LastUpdateDate,
-    FORMAT_TIMESTAMP('%%Y-%%m-%%d %%H:%%M:%%S', LastPingDate) AS LastPingDate,
-    FORMAT_TIMESTAMP('%%Y-%%m-%%d %%H:%%M:%%S', SnoozeDate) AS SnoozeDate,
+    FORMAT_TIMESTAMP('%Y-%m-%d %H:%M:%S', LastUpdateDate) AS LastUpdateDate,
+    FORMAT_TIMESTAMP('%Y-%m-%d %H:%M:%S', LastPingDate) AS LastPingDate,
+    FORMAT_TIMESTAMP('%Y-%m-%d %H:%M:%S', SnoozeDate) AS SnoozeDate,
     Subject,
-    Assignee
+    Assignee,
+    IFNULL(Locale, "") AS Locale,
+    IFNULL(Reason, "") AS Reason,
+    IFNULL(Comment, "") AS Comment`
+
+func GetTicketByIssueKey(issueKey string) (*t.Ticket, error) {
+	// Build the SQL query to retrieve the ticket with the matching issueKey.
+	// Every update appends a row, the latest one is the ticket.
+	var GetTicketQuery = `SELECT 
+	%s
 	FROM %s.%s
 	WHERE IssueKey = '%s'
+	ORDER BY LastUpdateDate DESC
+	LIMIT 1
 	`
-	query := fmt.Sprintf(GetTicketQuery, datasetID, ticketTableID, issueKey)
+	query := fmt.Sprintf(GetTicketQuery, ticketColumns, datasetID, ticketTableID, issueKey)
 	tType := reflect.TypeOf(t.Ticket{})
 	// Execute the query.
 	ticket, err := QueryBigQueryToStruct(query, tType)
-	if len(ticket) < 1 {
-		u.LogPrint(3, "[TicketTableFunctions] Could not find ticket: %v", issueKey)
-		return nil, fmt.Errorf("Could not find ticket: %v", issueKey)
-	}
 	if err != nil {
 		u.LogPrint(3, "[TicketTableFunctions] Something went wrong querying ticket: %v", err)
 		return nil, err
 	}
+	if len(ticket) < 1 {
+		u.LogPrint(3, "[TicketTableFunctions] Could not find ticket: %v", issueKey)
+		return nil, fmt.Errorf("%w: %v", ErrTicketNotFound, issueKey)
+	}
 	tick, ok := ticket[0].(t.Ticket);
 	if !ok {
 		u.LogPrint(3, "[TicketTableFunctions] Something went wrong asserting Ticket")
 		return nil, fmt.Errorf("Assertion Error")
 	} 
 	return &tick, nil
-}
\ No newline at end of file
+}
+
+// GetOpenTicketsByAssignee returns the latest state of every ticket
+// assigned to assignee that hasn't been closed or dismissed, most recently
+// updated first.
+func GetOpenTicketsByAssignee(assignee string) ([]t.Ticket, error) {
+	var openTicketsQuery = `SELECT
+	%s
+	FROM (
+		SELECT * FROM %s.%s
+		WHERE TRUE
+		QUALIFY ROW_NUMBER() OVER (PARTITION BY IssueKey ORDER BY LastUpdateDate DESC) = 1
+	)
+	WHERE IFNULL(Status, "") NOT IN (%s) AND '%s' IN UNNEST(Assignee)
+	ORDER BY LastUpdateDate DESC
+	`
+	closed := make([]string, len(t.ClosedStatuses))
+	for i, status := range t.ClosedStatuses {
+		closed[i] = fmt.Sprintf("%q", status)
+	}
+	query := fmt.Sprintf(openTicketsQuery, ticketColumns, datasetID, ticketTableID, strings.Join(closed, ", "), assignee)
+	rows, err := QueryBigQueryToStruct(query, reflect.TypeOf(t.Ticket{}))
+	if err != nil {
+		u.LogPrint(3, "[TicketTableFunctions] Something went wrong querying open tickets: %v", err)
+		return nil, err
+	}
+	tickets := make([]t.Ticket, 0, len(rows))
+	for _, row := range rows {
+		ticket, ok := row.(t.Ticket)
+		if !ok {
+			return nil, fmt.Errorf("Assertion Error")
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
@@ -0,0 +1,399 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"ticketservice/internal/authz"
+	"ticketservice/internal/locale"
+	"ticketservice/internal/policy"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// Config is the full service configuration. It's loaded from an optional
+// YAML or JSON file, then any environment variable named in an env tag
+// overrides the value from the file.
+type Config struct {
+	Store         StoreConfig         `yaml:"store"`
+	Tickets       TicketsConfig       `yaml:"tickets"`
+	Backend       BackendConfig       `yaml:"backend"`
+	Jobs          JobsConfig          `yaml:"jobs"`
+	Templates     TemplatesConfig     `yaml:"templates"`
+	Policies      []PolicyConfig      `yaml:"policies"`
+	Localization  LocalizationConfig  `yaml:"localization"`
+	Authorization AuthorizationConfig `yaml:"authorization"`
+}
+
+// StoreConfig is where recommendations are read from and tickets are kept.
+type StoreConfig struct {
+	Project              string        `yaml:"project" env:"BQ_PROJECT"`
+	Dataset              string        `yaml:"dataset" env:"BQ_DATASET"`
+	RecommendationsTable string        `yaml:"recommendationsTable" env:"BQ_RECOMMENDATIONS_TABLE"`
+	TicketTable          string        `yaml:"ticketTable" env:"BQ_TICKET_TABLE"`
+	RoutingTable         string        `yaml:"routingTable" env:"BQ_ROUTING_TABLE"`
+	ReservationTable     string        `yaml:"reservationTable" env:"BQ_RESERVATION_TABLE"`
+	ReservationTimeout   time.Duration `yaml:"reservationTimeout" env:"RESERVATION_TIMEOUT"`
+	HistoryTable         string        `yaml:"historyTable" env:"BQ_HISTORY_TABLE"`
+	SuppressionTable     string        `yaml:"suppressionTable" env:"BQ_SUPPRESSION_TABLE"`
+	// Column of the recommendations table holding resource labels, empty turns off label suppressions
+	LabelsColumn string      `yaml:"labelsColumn" env:"BQ_LABELS_COLUMN"`
+	Lock         LockConfig  `yaml:"lock"`
+	Queue        QueueConfig `yaml:"queue"`
+}
+
+type LockConfig struct {
+	Backend string        `yaml:"backend" env:"LOCK_BACKEND"` // bigquery or file
+	TTL     time.Duration `yaml:"ttl" env:"LOCK_TTL"`
+	FileDir string        `yaml:"fileDir" env:"LOCK_FILE_DIR"`
+	Table   string        `yaml:"table" env:"BQ_LOCK_TABLE"`
+}
+
+// QueueConfig is the work queue webhooks are processed from.
+type QueueConfig struct {
+	Backend           string        `yaml:"backend" env:"QUEUE_BACKEND"` // memory, file or bigquery
+	Workers           int           `yaml:"workers" env:"QUEUE_WORKERS"`
+	MaxAttempts       int           `yaml:"maxAttempts" env:"QUEUE_MAX_ATTEMPTS"`
+	VisibilityTimeout time.Duration `yaml:"visibilityTimeout" env:"QUEUE_VISIBILITY_TIMEOUT"`
+	PollInterval      time.Duration `yaml:"pollInterval" env:"QUEUE_POLL_INTERVAL"`
+	RetryBackoff      time.Duration `yaml:"retryBackoff" env:"QUEUE_RETRY_BACKOFF"`
+	FileDir           string        `yaml:"fileDir" env:"QUEUE_FILE_DIR"`
+	Table             string        `yaml:"table" env:"BQ_QUEUE_TABLE"`
+}
+
+type TicketsConfig struct {
+	CostThreshold   int      `yaml:"costThreshold" env:"TICKET_COST_THRESHOLD"`
+	LimitPerCall    int      `yaml:"limitPerCall" env:"TICKET_LIMIT"`
+	Workers         int      `yaml:"workers" env:"TICKET_WORKERS"`
+	AllowNullCost   bool     `yaml:"allowNullCost" env:"ALLOW_NULL_COST"`
+	ExcludeSubTypes []string `yaml:"excludeSubTypes" env:"EXCLUDE_SUB_TYPES"`
+	SnoozeDays      int      `yaml:"snoozeDays" env:"TICKET_SNOOZE_DAYS"`
+}
+
+// PolicyConfig overrides the ticket settings for a recommender, a subtype or both.
+// Anything left out falls back to the tickets section.
+type PolicyConfig struct {
+	Recommender    string `yaml:"recommender"`
+	Subtype        string `yaml:"subtype"`
+	CostThreshold  *int   `yaml:"costThreshold"`
+	AllowNullCost  *bool  `yaml:"allowNullCost"`
+	SnoozeDays     *int   `yaml:"snoozeDays"`
+	MaxPerRun      *int   `yaml:"maxPerRun"`
+	TitleTemplate  string `yaml:"titleTemplate"`
+	UpdateTemplate string `yaml:"updateTemplate"`
+}
+
+type BackendConfig struct {
+	// Needs to be the same name as the plugin without the extension
+	Impl string `yaml:"impl" env:"TICKET_SERVICE_IMPL"`
+	// Handed to the plugin, which falls back to environment variables for anything missing
+	Settings map[string]string `yaml:"settings"`
+}
+
+type JobsConfig struct {
+	HTTPTrigger   bool      `yaml:"httpTrigger" env:"HTTP_TRIGGER_ENABLED"`
+	CreateTickets JobConfig `yaml:"createTickets" envPrefix:"CREATE_TICKETS_"`
+	Reconcile     JobConfig `yaml:"reconcileReservations" envPrefix:"RECONCILE_"`
+	Reminders     JobConfig `yaml:"reminders" envPrefix:"REMINDERS_"`
+	SavingsReport JobConfig `yaml:"savingsReport" envPrefix:"SAVINGS_REPORT_"`
+}
+
+type JobConfig struct {
+	// Cron expression or @every <duration>, empty means the job isn't scheduled
+	Schedule string        `yaml:"schedule" env:"SCHEDULE"`
+	Jitter   time.Duration `yaml:"jitter" env:"JITTER"`
+}
+
+type TemplatesConfig struct {
+	EventTemplates `yaml:",inline"`
+	// Templates for a recommender subtype, keyed by subtype
+	Subtypes map[string]EventTemplates `yaml:"subtypes"`
+}
+
+// EventTemplates names the template for the ticket title and the message
+// posted for each lifecycle event. For a subtype anything left out uses the default.
+type EventTemplates struct {
+	Title string `yaml:"title" env:"TITLE_TEMPLATE"`
+	// Posted when the ticket is created
+	Update    string `yaml:"update" env:"UPDATE_TEMPLATE"`
+	Reminder  string `yaml:"reminder" env:"REMINDER_TEMPLATE"`
+	Snoozed   string `yaml:"snoozed" env:"SNOOZED_TEMPLATE"`
+	Closed    string `yaml:"closed" env:"CLOSED_TEMPLATE"`
+	Resolved  string `yaml:"resolved" env:"RESOLVED_TEMPLATE"`
+	Reopened  string `yaml:"reopened" env:"REOPENED_TEMPLATE"`
+	Dismissed string `yaml:"dismissed" env:"DISMISSED_TEMPLATE"`
+}
+
+// TemplateFile is one template of EventTemplates
+type TemplateFile struct {
+	Field string
+	Env   string
+	// The template kind, "title" or one of the ticket events
+	Kind string
+	Path string
+}
+
+// Files lists the templates in a fixed order
+func (e EventTemplates) Files() []TemplateFile {
+	return []TemplateFile{
+		{"title", "TITLE_TEMPLATE", "title", e.Title},
+		{"update", "UPDATE_TEMPLATE", t.EventCreated, e.Update},
+		{"reminder", "REMINDER_TEMPLATE", t.EventReminder, e.Reminder},
+		{"snoozed", "SNOOZED_TEMPLATE", t.EventSnoozed, e.Snoozed},
+		{"closed", "CLOSED_TEMPLATE", t.EventClosed, e.Closed},
+		{"resolved", "RESOLVED_TEMPLATE", t.EventResolved, e.Resolved},
+		{"reopened", "REOPENED_TEMPLATE", t.EventReopened, e.Reopened},
+		{"dismissed", "DISMISSED_TEMPLATE", t.EventDismissed, e.Dismissed},
+	}
+}
+
+// LocalizationConfig picks the language tickets are written in. A route's
+// Locale column wins, then the locale of the target contact, then the default.
+type LocalizationConfig struct {
+	Default string `yaml:"default" env:"DEFAULT_LOCALE"`
+	// Locales templates are translated to
+	Locales []string `yaml:"locales" env:"LOCALES"`
+	// Locale of a target contact, keyed by contact
+	Contacts map[string]string `yaml:"contacts"`
+}
+
+// AuthorizationConfig decides who may change tickets. Assignees and route
+// owners always may, admins may change any ticket.
+type AuthorizationConfig struct {
+	Enabled bool     `yaml:"enabled" env:"AUTHZ_ENABLED"`
+	Admins  []string `yaml:"admins" env:"AUTHZ_ADMINS"`
+	// Header holding the caller of an API request, set by the proxy in front of the service
+	UserHeader string `yaml:"userHeader" env:"AUTHZ_USER_HEADER"`
+}
+
+// AuthzRules builds the authorization rules in effect
+func (c Config) AuthzRules() *authz.Rules {
+	return &authz.Rules{
+		Enabled: c.Authorization.Enabled,
+		Admins:  c.Authorization.Admins,
+	}
+}
+
+// LocaleSettings builds the locale settings in effect
+func (c Config) LocaleSettings() *locale.Settings {
+	return &locale.Settings{
+		Default:  c.Localization.Default,
+		Locales:  c.Localization.Locales,
+		Contacts: c.Localization.Contacts,
+	}
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		Store: StoreConfig{
+			RecommendationsTable: "flattened_recommendations",
+			TicketTable:          "recommender_ticket_table",
+			RoutingTable:         "recommender_routing_table",
+			ReservationTable:     "recommender_ticket_reservations",
+			ReservationTimeout:   15 * time.Minute,
+			HistoryTable:         "recommender_ticket_history",
+			SuppressionTable:     "recommender_suppressions",
+			Lock: LockConfig{
+				Backend: "bigquery",
+				TTL:     2 * time.Minute,
+				FileDir: "/tmp/ticketservice-locks",
+				Table:   "recommender_locks",
+			},
+			Queue: QueueConfig{
+				Backend:           "memory",
+				Workers:           2,
+				MaxAttempts:       5,
+				VisibilityTimeout: 2 * time.Minute,
+				PollInterval:      5 * time.Second,
+				RetryBackoff:      10 * time.Second,
+				FileDir:           "/tmp/ticketservice-queue",
+				Table:             "recommender_work_queue",
+			},
+		},
+		Tickets: TicketsConfig{
+			CostThreshold: 100,
+			LimitPerCall:  5,
+			Workers:       4,
+			SnoozeDays:    7,
+		},
+		Backend: BackendConfig{
+			Impl:     "slackTicket",
+			Settings: map[string]string{},
+		},
+		Jobs: JobsConfig{
+			HTTPTrigger: true,
+		},
+		Localization: LocalizationConfig{
+			Default: locale.English,
+		},
+		Authorization: AuthorizationConfig{
+			Enabled:    false,
+			UserHeader: "X-Goog-Authenticated-User-Email",
+		},
+		Templates: TemplatesConfig{
+			EventTemplates: EventTemplates{
+				Title:     "ticketTitleTpl.txt",
+				Update:    "updateTicketTpl.txt",
+				Reminder:  "reminderTicketTpl.txt",
+				Snoozed:   "snoozedTicketTpl.txt",
+				Closed:    "closedTicketTpl.txt",
+				Resolved:  "resolvedTicketTpl.txt",
+				Reopened:  "reopenedTicketTpl.txt",
+				Dismissed: "dismissedTicketTpl.txt",
+			},
+		},
+	}
+}
+
+// PolicySet builds the policies in effect from the tickets section and any overrides.
+func (c Config) PolicySet() *policy.Set {
+	def := policy.Policy{
+		CostThreshold: c.Tickets.CostThreshold,
+		AllowNullCost: c.Tickets.AllowNullCost,
+		SnoozeDays:    c.Tickets.SnoozeDays,
+		MaxPerRun:     c.Tickets.LimitPerCall,
+	}
+	policies := make([]policy.Policy, len(c.Policies))
+	for i, pc := range c.Policies {
+		p := def
+		p.Recommender = pc.Recommender
+		p.Subtype = pc.Subtype
+		if pc.CostThreshold != nil {
+			p.CostThreshold = *pc.CostThreshold
+		}
+		if pc.AllowNullCost != nil {
+			p.AllowNullCost = *pc.AllowNullCost
+		}
+		if pc.SnoozeDays != nil {
+			p.SnoozeDays = *pc.SnoozeDays
+		}
+		if pc.MaxPerRun != nil {
+			p.MaxPerRun = *pc.MaxPerRun
+		}
+		p.TitleTemplate = pc.TitleTemplate
+		p.UpdateTemplate = pc.UpdateTemplate
+		policies[i] = p
+	}
+	set := policy.NewSet(def, policies)
+	set.ExcludeSubTypes = c.Tickets.ExcludeSubTypes
+	return set
+}
+
+// Load reads path (if not empty) over the defaults and applies environment
+// overrides. Problems parsing values are returned together, it's up to the
+// caller to Validate the result.
+func Load(path string) (Config, []error) {
+	c := Default()
+	var problems []error
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, []error{fmt.Errorf("reading config file: %v", err)}
+		}
+		// YAML is a superset of JSON, so one decoder handles both
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&c); err != nil {
+			problems = append(problems, fmt.Errorf("parsing %s: %v", path, err))
+		}
+	}
+	problems = append(problems, applyEnv(reflect.ValueOf(&c).Elem(), "")...)
+	if c.Backend.Settings == nil {
+		c.Backend.Settings = map[string]string{}
+	}
+	return c, problems
+}
+
+// applyEnv walks the struct and overrides any field whose env variable is set.
+func applyEnv(v reflect.Value, prefix string) []error {
+	var problems []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			problems = append(problems, applyEnv(value, prefix+field.Tag.Get("envPrefix"))...)
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		name = prefix + name
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return problems
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(i))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma separated list. Quotes are stripped so the old
+// hand quoted SQL form of EXCLUDE_SUB_TYPES (I.E. "'a','b'" or "' '") still works.
+func splitList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.Trim(strings.TrimSpace(item), `'"`)
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
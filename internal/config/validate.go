@@ -0,0 +1,259 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"golang.org/x/text/language"
+
+	s "ticketservice/internal/scheduler"
+)
+
+// BigQuery dataset and table names only allow letters, numbers and underscores.
+// Project IDs also allow dashes (and a domain prefix for some older projects).
+var (
+	bqNameRegex    = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	bqProjectRegex = regexp.MustCompile(`^[a-z0-9.:-]+$`)
+	// Recommender names look like google.compute.instance.MachineTypeRecommender
+	policyNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Validate checks the whole config and returns every problem it finds
+// rather than stopping at the first one.
+func (c Config) Validate() []error {
+	var problems []error
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	// Store
+	if c.Store.Project == "" {
+		add("store.project (BQ_PROJECT) is required")
+	} else if !bqProjectRegex.MatchString(c.Store.Project) {
+		add("store.project (BQ_PROJECT) %q is not a valid project ID", c.Store.Project)
+	}
+	if c.Store.Dataset == "" {
+		add("store.dataset (BQ_DATASET) is required")
+	}
+	if c.Store.Dataset != "" && !bqNameRegex.MatchString(c.Store.Dataset) {
+		add("store.dataset (BQ_DATASET) %q may only contain letters, numbers and underscores", c.Store.Dataset)
+	}
+	for _, table := range []struct{ name, value string }{
+		{"store.recommendationsTable (BQ_RECOMMENDATIONS_TABLE)", c.Store.RecommendationsTable},
+		{"store.ticketTable (BQ_TICKET_TABLE)", c.Store.TicketTable},
+		{"store.routingTable (BQ_ROUTING_TABLE)", c.Store.RoutingTable},
+		{"store.reservationTable (BQ_RESERVATION_TABLE)", c.Store.ReservationTable},
+		{"store.historyTable (BQ_HISTORY_TABLE)", c.Store.HistoryTable},
+		{"store.suppressionTable (BQ_SUPPRESSION_TABLE)", c.Store.SuppressionTable},
+	} {
+		if !bqNameRegex.MatchString(table.value) {
+			add("%s %q may only contain letters, numbers and underscores", table.name, table.value)
+		}
+	}
+	if c.Store.LabelsColumn != "" && !bqNameRegex.MatchString(c.Store.LabelsColumn) {
+		add("store.labelsColumn (BQ_LABELS_COLUMN) %q may only contain letters, numbers and underscores", c.Store.LabelsColumn)
+	}
+	if c.Store.ReservationTimeout <= 0 {
+		add("store.reservationTimeout (RESERVATION_TIMEOUT) must be positive")
+	}
+	switch c.Store.Lock.Backend {
+	case "bigquery":
+		if !bqNameRegex.MatchString(c.Store.Lock.Table) {
+			add("store.lock.table (BQ_LOCK_TABLE) %q may only contain letters, numbers and underscores", c.Store.Lock.Table)
+		}
+	case "file":
+		if c.Store.Lock.FileDir == "" {
+			add("store.lock.fileDir (LOCK_FILE_DIR) is required when the lock backend is file")
+		}
+	default:
+		add("store.lock.backend (LOCK_BACKEND) %q must be bigquery or file", c.Store.Lock.Backend)
+	}
+	if c.Store.Lock.TTL < 3*time.Second {
+		add("store.lock.ttl (LOCK_TTL) must be at least 3s")
+	}
+	switch c.Store.Queue.Backend {
+	case "memory":
+	case "bigquery":
+		if !bqNameRegex.MatchString(c.Store.Queue.Table) {
+			add("store.queue.table (BQ_QUEUE_TABLE) %q may only contain letters, numbers and underscores", c.Store.Queue.Table)
+		}
+	case "file":
+		if c.Store.Queue.FileDir == "" {
+			add("store.queue.fileDir (QUEUE_FILE_DIR) is required when the queue backend is file")
+		}
+	default:
+		add("store.queue.backend (QUEUE_BACKEND) %q must be memory, file or bigquery", c.Store.Queue.Backend)
+	}
+	if c.Store.Queue.Workers < 1 {
+		add("store.queue.workers (QUEUE_WORKERS) must be at least 1")
+	}
+	if c.Store.Queue.MaxAttempts < 1 {
+		add("store.queue.maxAttempts (QUEUE_MAX_ATTEMPTS) must be at least 1")
+	}
+	if c.Store.Queue.VisibilityTimeout < time.Second {
+		add("store.queue.visibilityTimeout (QUEUE_VISIBILITY_TIMEOUT) must be at least 1s")
+	}
+	if c.Store.Queue.PollInterval <= 0 {
+		add("store.queue.pollInterval (QUEUE_POLL_INTERVAL) must be positive")
+	}
+	if c.Store.Queue.RetryBackoff <= 0 {
+		add("store.queue.retryBackoff (QUEUE_RETRY_BACKOFF) must be positive")
+	}
+
+	// Tickets
+	if c.Tickets.CostThreshold < 0 {
+		add("tickets.costThreshold (TICKET_COST_THRESHOLD) must not be negative")
+	}
+	if c.Tickets.LimitPerCall < 1 {
+		add("tickets.limitPerCall (TICKET_LIMIT) must be at least 1")
+	}
+	if c.Tickets.Workers < 1 {
+		add("tickets.workers (TICKET_WORKERS) must be at least 1")
+	}
+	if c.Tickets.SnoozeDays < 1 {
+		add("tickets.snoozeDays (TICKET_SNOOZE_DAYS) must be at least 1")
+	}
+	for _, subtype := range c.Tickets.ExcludeSubTypes {
+		if !bqNameRegex.MatchString(subtype) {
+			add("tickets.excludeSubTypes %q may only contain letters, numbers and underscores", subtype)
+		}
+	}
+
+	// Policies
+	seen := make(map[string]bool)
+	for i, p := range c.Policies {
+		name := fmt.Sprintf("policies[%d]", i)
+		if p.Recommender == "" && p.Subtype == "" {
+			add("%s needs a recommender, a subtype or both", name)
+		}
+		if p.Recommender != "" && !policyNameRegex.MatchString(p.Recommender) {
+			add("%s.recommender %q is not a valid recommender name", name, p.Recommender)
+		}
+		if p.Subtype != "" && !bqNameRegex.MatchString(p.Subtype) {
+			add("%s.subtype %q may only contain letters, numbers and underscores", name, p.Subtype)
+		}
+		key := p.Recommender + "/" + p.Subtype
+		if seen[key] {
+			add("%s duplicates an earlier policy for %s", name, key)
+		}
+		seen[key] = true
+		if p.CostThreshold != nil && *p.CostThreshold < 0 {
+			add("%s.costThreshold must not be negative", name)
+		}
+		if p.SnoozeDays != nil && *p.SnoozeDays < 1 {
+			add("%s.snoozeDays must be at least 1", name)
+		}
+		if p.MaxPerRun != nil && *p.MaxPerRun < 0 {
+			add("%s.maxPerRun must not be negative", name)
+		}
+		for _, template := range []struct{ field, path string }{
+			{"titleTemplate", p.TitleTemplate},
+			{"updateTemplate", p.UpdateTemplate},
+		} {
+			if template.path == "" {
+				continue
+			}
+			if _, err := os.Stat(template.path); err != nil {
+				add("%s.%s: %v", name, template.field, err)
+			}
+		}
+	}
+
+	// Backend
+	if c.Backend.Impl == "" {
+		add("backend.impl (TICKET_SERVICE_IMPL) is required")
+	} else if !bqNameRegex.MatchString(c.Backend.Impl) {
+		add("backend.impl (TICKET_SERVICE_IMPL) %q is not a valid plugin name", c.Backend.Impl)
+	}
+
+	// Jobs
+	for _, job := range []struct {
+		name string
+		job  JobConfig
+	}{
+		{"createTickets", c.Jobs.CreateTickets},
+		{"reconcileReservations", c.Jobs.Reconcile},
+		{"reminders", c.Jobs.Reminders},
+		{"savingsReport", c.Jobs.SavingsReport},
+	} {
+		if job.job.Schedule != "" {
+			if _, err := s.ParseSchedule(job.job.Schedule); err != nil {
+				add("jobs.%s.schedule %q: %v", job.name, job.job.Schedule, err)
+			}
+		}
+		if job.job.Jitter < 0 {
+			add("jobs.%s.jitter must not be negative", job.name)
+		}
+	}
+
+	// Templates
+	for _, file := range c.Templates.Files() {
+		if _, err := os.Stat(file.Path); err != nil {
+			add("templates.%s (%s): %v", file.Field, file.Env, err)
+		}
+	}
+	subtypes := make([]string, 0, len(c.Templates.Subtypes))
+	for subtype := range c.Templates.Subtypes {
+		subtypes = append(subtypes, subtype)
+	}
+	sort.Strings(subtypes)
+	for _, subtype := range subtypes {
+		if !bqNameRegex.MatchString(subtype) {
+			add("templates.subtypes %q may only contain letters, numbers and underscores", subtype)
+		}
+		for _, file := range c.Templates.Subtypes[subtype].Files() {
+			if file.Path == "" {
+				continue
+			}
+			if _, err := os.Stat(file.Path); err != nil {
+				add("templates.subtypes.%s.%s: %v", subtype, file.Field, err)
+			}
+		}
+	}
+
+	// Localization
+	known := map[string]bool{c.Localization.Default: true}
+	if _, err := language.Parse(c.Localization.Default); err != nil {
+		add("localization.default (DEFAULT_LOCALE) %q: %v", c.Localization.Default, err)
+	}
+	for _, loc := range c.Localization.Locales {
+		if _, err := language.Parse(loc); err != nil {
+			add("localization.locales (LOCALES) %q: %v", loc, err)
+		}
+		known[loc] = true
+	}
+	contacts := make([]string, 0, len(c.Localization.Contacts))
+	for contact := range c.Localization.Contacts {
+		contacts = append(contacts, contact)
+	}
+	sort.Strings(contacts)
+	for _, contact := range contacts {
+		loc := c.Localization.Contacts[contact]
+		if !known[loc] {
+			add("localization.contacts.%s %q is not the default locale or one of localization.locales", contact, loc)
+		}
+	}
+
+	// Authorization
+	if c.Authorization.Enabled && c.Authorization.UserHeader == "" {
+		add("authorization.userHeader (AUTHZ_USER_HEADER) is required when authorization is enabled")
+	}
+	return problems
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/number"
+)
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+	"BRL": "R$",
+}
+
+// Currencies without minor units
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+}
+
+// Languages that write the currency after the amount, I.E. 1.234,50 €
+var symbolAfter = map[language.Base]bool{}
+
+func init() {
+	for _, l := range []string{"de", "fr", "es", "it", "nl", "pl", "sv", "cs", "fi", "da", "nb", "pt"} {
+		base, _ := language.MustParse(l).Base()
+		symbolAfter[base] = true
+	}
+}
+
+// Number formats a number with the grouping and decimal separators of the locale.
+func Number(loc string, value float64, decimals int) string {
+	return printer(loc).Sprint(number.Decimal(value,
+		number.MinFractionDigits(decimals),
+		number.MaxFractionDigits(decimals)))
+}
+
+// Currency formats an amount such as 1234 USD as $1,234.00 in English or
+// 1.234,00 $ in German. Unknown currency codes are written out.
+func Currency(loc string, amount float64, code string) string {
+	code = strings.ToUpper(code)
+	decimals := 2
+	if zeroDecimalCurrencies[code] {
+		decimals = 0
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = math.Abs(amount)
+	}
+	formatted := Number(loc, amount, decimals)
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		symbol = code
+	}
+	if symbol == "" {
+		return sign + formatted
+	}
+	base, _ := Tag(loc).Base()
+	if symbolAfter[base] {
+		return sign + formatted + " " + symbol
+	}
+	if !ok {
+		// Codes need a space to be readable, I.E. CHF 1,234.00
+		return sign + symbol + " " + formatted
+	}
+	return sign + symbol + formatted
+}
+
+// Date layouts by language, anything else uses English
+var dateLayouts = map[language.Base]string{}
+
+func init() {
+	for l, layout := range map[string]string{
+		"en": "Jan 2, 2006",
+		"ja": "2006年1月2日",
+		"de": "2.1.2006",
+		"fr": "02/01/2006",
+	} {
+		base, _ := language.MustParse(l).Base()
+		dateLayouts[base] = layout
+	}
+}
+
+// Date formats the day of a date the way the locale writes it.
+func Date(loc string, date time.Time) string {
+	base, _ := Tag(loc).Base()
+	layout, ok := dateLayouts[base]
+	if !ok {
+		layout = "Jan 2, 2006"
+	}
+	return date.Format(layout)
+}
+
+// round counts whole units, rounding to the nearest
+func round(d, unit time.Duration) int {
+	return int((d + unit/2) / unit)
+}
+
+// Relative date messages, singular and plural, in the future and past.
+// These are the English keys translated in messages.go.
+var relativeUnits = []struct {
+	limit time.Duration
+	unit  time.Duration
+	in    [2]string
+	ago   [2]string
+}{
+	{time.Hour, time.Minute, [2]string{"in %d minute", "in %d minutes"}, [2]string{"%d minute ago", "%d minutes ago"}},
+	{24 * time.Hour, time.Hour, [2]string{"in %d hour", "in %d hours"}, [2]string{"%d hour ago", "%d hours ago"}},
+	{30 * 24 * time.Hour, 24 * time.Hour, [2]string{"in %d day", "in %d days"}, [2]string{"%d day ago", "%d days ago"}},
+	{365 * 24 * time.Hour, 30 * 24 * time.Hour, [2]string{"in %d month", "in %d months"}, [2]string{"%d month ago", "%d months ago"}},
+	{math.MaxInt64, 365 * 24 * time.Hour, [2]string{"in %d year", "in %d years"}, [2]string{"%d year ago", "%d years ago"}},
+}
+
+// RelativeDate describes date relative to now, such as "in 7 days" or "3 hours ago".
+func RelativeDate(loc string, date, now time.Time) string {
+	diff := date.Sub(now)
+	future := diff > 0
+	if !future {
+		diff = -diff
+	}
+	if diff < time.Minute {
+		return Sprintf(loc, "just now")
+	}
+	for _, u := range relativeUnits {
+		if diff >= u.limit {
+			continue
+		}
+		n := round(diff, u.unit)
+		form := 1
+		if n == 1 {
+			form = 0
+		}
+		if future {
+			return Sprintf(loc, u.in[form], n)
+		}
+		return Sprintf(loc, u.ago[form], n)
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package locale picks the language of a ticket and formats numbers,
+// currencies, dates and messages for it. Anything without a translation
+// falls back to English.
+package locale
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// English is what everything falls back to
+const English = "en"
+
+// Settings decides the locale of a ticket.
+type Settings struct {
+	// Used when neither the route nor the target contact has a locale
+	Default string
+	// Locales with translated templates
+	Locales []string
+	// Locale of a target contact, keyed by contact
+	Contacts map[string]string
+}
+
+// Resolve picks the locale for a ticket: the route's locale, then the
+// target contact's, then the default.
+func (s *Settings) Resolve(route, contact string) string {
+	if route != "" {
+		return route
+	}
+	if loc, ok := s.Contacts[contact]; ok {
+		return loc
+	}
+	if s.Default != "" {
+		return s.Default
+	}
+	return English
+}
+
+var current atomic.Pointer[Settings]
+
+// Current returns the settings in effect, English for everyone until
+// SetCurrent is called.
+func Current() *Settings {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return &Settings{Default: English}
+}
+
+// SetCurrent swaps the settings in effect.
+func SetCurrent(s *Settings) {
+	current.Store(s)
+}
+
+// Tag parses a locale such as "ja" or "de-CH", unknown locales are English.
+func Tag(loc string) language.Tag {
+	tag, err := language.Parse(loc)
+	if err != nil {
+		return language.English
+	}
+	return tag
+}
+
+func printer(loc string) *message.Printer {
+	return message.NewPrinter(Tag(loc))
+}
+
+// Sprintf translates an English message and formats it for the locale.
+// Messages without a translation stay in English.
+func Sprintf(loc, key string, args ...interface{}) string {
+	return printer(loc).Sprintf(key, args...)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// translations of the messages the service sends outside of templates,
+// keyed by the English message. Add a language by adding a column.
+var translations = map[string]map[language.Tag]string{
+	// Relative dates
+	"just now":       {language.Japanese: "たった今", language.German: "gerade eben"},
+	"in %d minute":   {language.Japanese: "%d分後", language.German: "in %d Minute"},
+	"in %d minutes":  {language.Japanese: "%d分後", language.German: "in %d Minuten"},
+	"%d minute ago":  {language.Japanese: "%d分前", language.German: "vor %d Minute"},
+	"%d minutes ago": {language.Japanese: "%d分前", language.German: "vor %d Minuten"},
+	"in %d hour":     {language.Japanese: "%d時間後", language.German: "in %d Stunde"},
+	"in %d hours":    {language.Japanese: "%d時間後", language.German: "in %d Stunden"},
+	"%d hour ago":    {language.Japanese: "%d時間前", language.German: "vor %d Stunde"},
+	"%d hours ago":   {language.Japanese: "%d時間前", language.German: "vor %d Stunden"},
+	"in %d day":      {language.Japanese: "%d日後", language.German: "in %d Tag"},
+	"in %d days":     {language.Japanese: "%d日後", language.German: "in %d Tagen"},
+	"%d day ago":     {language.Japanese: "%d日前", language.German: "vor %d Tag"},
+	"%d days ago":    {language.Japanese: "%d日前", language.German: "vor %d Tagen"},
+	"in %d month":    {language.Japanese: "%dか月後", language.German: "in %d Monat"},
+	"in %d months":   {language.Japanese: "%dか月後", language.German: "in %d Monaten"},
+	"%d month ago":   {language.Japanese: "%dか月前", language.German: "vor %d Monat"},
+	"%d months ago":  {language.Japanese: "%dか月前", language.German: "vor %d Monaten"},
+	"in %d year":     {language.Japanese: "%d年後", language.German: "in %d Jahr"},
+	"in %d years":    {language.Japanese: "%d年後", language.German: "in %d Jahren"},
+	"%d year ago":    {language.Japanese: "%d年前", language.German: "vor %d Jahr"},
+	"%d years ago":   {language.Japanese: "%d年前", language.German: "vor %d Jahren"},
+
+	// Slack command replies
+	"Not enough arguments":                {language.Japanese: "引数が足りません", language.German: "Zu wenige Argumente"},
+	"Invalid duration format":             {language.Japanese: "期間の形式が正しくありません", language.German: "Ungültiges Zeitformat"},
+	"Invalid duration unit":               {language.Japanese: "期間の単位が正しくありません", language.German: "Ungültige Zeiteinheit"},
+	"Something went wrong getting ticket": {language.Japanese: "チケットの取得中に問題が発生しました", language.German: "Beim Abrufen des Tickets ist ein Fehler aufgetreten"},
+	"Something went wrong":                {language.Japanese: "問題が発生しました", language.German: "Etwas ist schiefgelaufen"},
+
+	// Slack ticket messages
+	"Savings":       {language.Japanese: "削減可能額", language.German: "Einsparung"},
+	"Resource":      {language.Japanese: "リソース", language.German: "Ressource"},
+	"Snooze 7d":     {language.Japanese: "7日間スヌーズ", language.German: "7 Tage pausieren"},
+	"Snooze 30d":    {language.Japanese: "30日間スヌーズ", language.German: "30 Tage pausieren"},
+	"Mark complete": {language.Japanese: "完了にする", language.German: "Als erledigt markieren"},
+	"Dismiss":       {language.Japanese: "却下", language.German: "Verwerfen"},
+	"Close":         {language.Japanese: "閉じる", language.German: "Schließen"},
+
+	// Slack commands
+	"Mention who to assign, I.E. !assign @user": {language.Japanese: "担当者をメンションしてください。例: !assign @user", language.German: "Erwähne, wem das Ticket zugewiesen werden soll, z. B. !assign @user"},
+	"Assigned to %s":                          {language.Japanese: "%s に割り当てました", language.German: "%s zugewiesen"},
+	"Status: %s":                              {language.Japanese: "ステータス: %s", language.German: "Status: %s"},
+	"Assigned to: %s":                         {language.Japanese: "担当者: %s", language.German: "Zugewiesen an: %s"},
+	"Created: %s":                             {language.Japanese: "作成日: %s", language.German: "Erstellt: %s"},
+	"Next reminder: %s":                       {language.Japanese: "次回のリマインダー: %s", language.German: "Nächste Erinnerung: %s"},
+	"Recommender: %s":                         {language.Japanese: "レコメンダー: %s", language.German: "Recommender: %s"},
+	"Resource: %s":                            {language.Japanese: "リソース: %s", language.German: "Ressource: %s"},
+	"You have no open tickets":                {language.Japanese: "未完了のチケットはありません", language.German: "Du hast keine offenen Tickets"},
+	"Your open tickets:":                      {language.Japanese: "未完了のチケット:", language.German: "Deine offenen Tickets:"},
+	"...and %d more":                          {language.Japanese: "...ほか %d 件", language.German: "...und %d weitere"},
+	"Commands:":                               {language.Japanese: "コマンド:", language.German: "Befehle:"},
+	"Snooze the ticket":                       {language.Japanese: "チケットをスヌーズする", language.German: "Ticket pausieren"},
+	"Close the ticket without resolving it":   {language.Japanese: "解決せずにチケットを閉じる", language.German: "Ticket ohne Lösung schließen"},
+	"Close the ticket as resolved":            {language.Japanese: "解決済みとしてチケットを閉じる", language.German: "Ticket als gelöst schließen"},
+	"Reassign the ticket and invite the user": {language.Japanese: "チケットを割り当て直してユーザーを招待する", language.German: "Ticket neu zuweisen und die Person einladen"},
+	"Show the state of the ticket":            {language.Japanese: "チケットの状態を表示する", language.German: "Status des Tickets anzeigen"},
+	"List your open tickets":                  {language.Japanese: "未完了のチケットを一覧表示する", language.German: "Deine offenen Tickets auflisten"},
+	"List the commands":                       {language.Japanese: "コマンドを一覧表示する", language.German: "Befehle auflisten"},
+	"Unknown command, try %s help":            {language.Japanese: "不明なコマンドです。%s help をお試しください", language.German: "Unbekannter Befehl, versuche %s help"},
+	"Start %s with the IssueKey of the ticket, %s list shows them":      {language.Japanese: "%s の最初にチケットの IssueKey を指定してください。%s list で確認できます", language.German: "Gib bei %s zuerst den IssueKey des Tickets an, %s list zeigt sie"},
+	"Dismiss the recommendation for this resource for good, saying why": {language.Japanese: "理由を添えてこのリソースのレコメンデーションを恒久的に却下する", language.German: "Empfehlung für diese Ressource mit Begründung dauerhaft verwerfen"},
+	"Reopen a closed ticket":                    {language.Japanese: "閉じたチケットを再開する", language.German: "Geschlossenes Ticket wieder öffnen"},
+	"Record a note in the ticket history":       {language.Japanese: "チケットの履歴にメモを残す", language.German: "Notiz im Ticketverlauf festhalten"},
+	"This ticket is not closed":                 {language.Japanese: "このチケットは閉じられていません", language.German: "Dieses Ticket ist nicht geschlossen"},
+	"This ticket is closed, !reopen reopens it": {language.Japanese: "このチケットは閉じられました。!reopen で再開できます", language.German: "Dieses Ticket ist geschlossen, !reopen öffnet es wieder"},
+	"Comment recorded":                          {language.Japanese: "コメントを記録しました", language.German: "Kommentar gespeichert"},
+	"Reason: %s":                                {language.Japanese: "理由: %s", language.German: "Grund: %s"},
+	"Comment: %s":                               {language.Japanese: "コメント: %s", language.German: "Kommentar: %s"},
+	"Recommendation type: %s":                   {language.Japanese: "レコメンデーションの種類: %s", language.German: "Art der Empfehlung: %s"},
+	"Savings: %s":                               {language.Japanese: "削減額: %s", language.German: "Einsparung: %s"},
+	"Details: %s":                               {language.Japanese: "詳細: %s", language.German: "Details: %s"},
+	"Give a reason: %s":                         {language.Japanese: "理由を指定してください: %s", language.German: "Gib einen Grund an: %s"},
+
+	// Authorization
+	"Sorry, you can't %s: %s":                                 {language.Japanese: "%[1]sことはできません: %[2]s", language.German: "Du darfst leider nicht %s: %s"},
+	"snooze this ticket":                                      {language.Japanese: "このチケットをスヌーズする", language.German: "dieses Ticket pausieren"},
+	"close this ticket":                                       {language.Japanese: "このチケットを閉じる", language.German: "dieses Ticket schließen"},
+	"dismiss this ticket":                                     {language.Japanese: "このチケットを却下する", language.German: "dieses Ticket verwerfen"},
+	"reopen this ticket":                                      {language.Japanese: "このチケットを再開する", language.German: "dieses Ticket wieder öffnen"},
+	"assign this ticket":                                      {language.Japanese: "このチケットを割り当てる", language.German: "dieses Ticket zuweisen"},
+	"comment on this ticket":                                  {language.Japanese: "このチケットにコメントする", language.German: "dieses Ticket kommentieren"},
+	"we couldn't tell who you are":                            {language.Japanese: "ユーザーを特定できませんでした", language.German: "wir konnten nicht feststellen, wer du bist"},
+	"we couldn't check the route owners":                      {language.Japanese: "ルートの所有者を確認できませんでした", language.German: "wir konnten die Verantwortlichen der Route nicht prüfen"},
+	"only admins can do that":                                 {language.Japanese: "管理者のみが実行できます", language.German: "das dürfen nur Admins"},
+	"only the route owners and admins can do that":            {language.Japanese: "ルートの所有者と管理者のみが実行できます", language.German: "das dürfen nur die Verantwortlichen der Route und Admins"},
+	"only the assignees, route owners and admins can do that": {language.Japanese: "担当者、ルートの所有者、管理者のみが実行できます", language.German: "das dürfen nur die Zuständigen, die Verantwortlichen der Route und Admins"},
+
+	// Snooze and dismiss modals
+	"Snooze...":                   {language.Japanese: "スヌーズ...", language.German: "Pausieren..."},
+	"Snooze ticket":               {language.Japanese: "チケットをスヌーズ", language.German: "Ticket pausieren"},
+	"Dismiss ticket":              {language.Japanese: "チケットを却下", language.German: "Ticket verwerfen"},
+	"Snooze":                      {language.Japanese: "スヌーズ", language.German: "Pausieren"},
+	"Cancel":                      {language.Japanese: "キャンセル", language.German: "Abbrechen"},
+	"Snooze for":                  {language.Japanese: "スヌーズ期間", language.German: "Pausieren für"},
+	"%d days":                     {language.Japanese: "%d日間", language.German: "%d Tage"},
+	"Reason":                      {language.Japanese: "理由", language.German: "Grund"},
+	"Pick a reason":               {language.Japanese: "理由を選択", language.German: "Grund auswählen"},
+	"Comment":                     {language.Japanese: "コメント", language.German: "Kommentar"},
+	"Anything others should know": {language.Japanese: "共有しておきたいこと", language.German: "Was andere wissen sollten"},
+	"False positive":              {language.Japanese: "誤検知", language.German: "Fehlalarm"},
+	"Planned":                     {language.Japanese: "対応予定", language.German: "Geplant"},
+	"Blocked":                     {language.Japanese: "ブロック中", language.German: "Blockiert"},
+	"Not worth it":                {language.Japanese: "対応する価値がない", language.German: "Lohnt sich nicht"},
+}
+
+func init() {
+	for key, byLanguage := range translations {
+		for tag, translation := range byLanguage {
+			if err := message.SetString(tag, key, translation); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"time"
+
+	b "ticketservice/internal/bigqueryfunctions"
+)
+
+// BigQueryLocker keeps leases in a BigQuery table so every replica
+// sharing the dataset sees the same locks.
+type BigQueryLocker struct {
+	TableID string
+}
+
+func (l *BigQueryLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	expiresAt, ok, err := b.AcquireLock(l.TableID, name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+	return &Lease{Name: name, Owner: owner, ExpiresAt: expiresAt}, nil
+}
+
+func (l *BigQueryLocker) Renew(ctx context.Context, lease *Lease, ttl time.Duration) error {
+	ok, err := b.RenewLock(l.TableID, lease.Name, lease.Owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+	lease.ExpiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (l *BigQueryLocker) Release(ctx context.Context, lease *Lease) error {
+	return b.ReleaseLock(l.TableID, lease.Name, lease.Owner)
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// FileLocker keeps leases in files under Dir. It only protects replicas
+// that share a filesystem, which makes it a good fit for local development
+// and single VM deployments.
+type FileLocker struct {
+	Dir string
+}
+
+type fileLease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// update opens the lock file under an exclusive flock and lets fn decide the new
+// contents. Returning nil from fn removes the lease.
+func (l *FileLocker) update(name string, fn func(current *fileLease) (*fileLease, error)) error {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(l.Dir, unsafeFileChars.ReplaceAllString(name, "_")+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	var current *fileLease
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		current = &fileLease{}
+		if err := json.Unmarshal(data, current); err != nil {
+			// A corrupt lease is treated as no lease
+			current = nil
+		}
+	}
+	next, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if next == nil {
+		return nil
+	}
+	data, err = json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(data, 0)
+	return err
+}
+
+func (l *FileLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	lease := &Lease{Name: name, Owner: owner}
+	err := l.update(name, func(current *fileLease) (*fileLease, error) {
+		if current != nil && current.Owner != owner && time.Now().Before(current.ExpiresAt) {
+			return current, ErrLockHeld
+		}
+		lease.ExpiresAt = time.Now().Add(ttl)
+		return &fileLease{Owner: owner, ExpiresAt: lease.ExpiresAt}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func (l *FileLocker) Renew(ctx context.Context, lease *Lease, ttl time.Duration) error {
+	return l.update(lease.Name, func(current *fileLease) (*fileLease, error) {
+		if current == nil || current.Owner != lease.Owner {
+			return current, ErrLeaseLost
+		}
+		lease.ExpiresAt = time.Now().Add(ttl)
+		return &fileLease{Owner: lease.Owner, ExpiresAt: lease.ExpiresAt}, nil
+	})
+}
+
+func (l *FileLocker) Release(ctx context.Context, lease *Lease) error {
+	return l.update(lease.Name, func(current *fileLease) (*fileLease, error) {
+		if current == nil || current.Owner != lease.Owner {
+			// Someone else has it now, leave their lease alone
+			return current, nil
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileLockerAcquireAndContend(test *testing.T) {
+	ctx := context.Background()
+	locker := &FileLocker{Dir: test.TempDir()}
+	lease, err := locker.Acquire(ctx, "job-createTickets", "a", time.Minute)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if lease.Owner != "a" || time.Until(lease.ExpiresAt) <= 0 {
+		test.Errorf("got lease %+v, want a live lease of a", lease)
+	}
+	if _, err := locker.Acquire(ctx, "job-createTickets", "b", time.Minute); !errors.Is(err, ErrLockHeld) {
+		test.Errorf("b acquired a held lock: %v", err)
+	}
+	// Other locks are separate
+	if _, err := locker.Acquire(ctx, "job-other", "b", time.Minute); err != nil {
+		test.Errorf("b couldn't acquire another lock: %v", err)
+	}
+	// The owner acquiring again just extends its lease
+	if _, err := locker.Acquire(ctx, "job-createTickets", "a", time.Minute); err != nil {
+		test.Errorf("a couldn't acquire its own lock: %v", err)
+	}
+
+	if err := locker.Release(ctx, lease); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := locker.Acquire(ctx, "job-createTickets", "b", time.Minute); err != nil {
+		test.Errorf("b couldn't acquire a released lock: %v", err)
+	}
+	// Releasing a lease someone else holds now leaves theirs alone
+	if err := locker.Release(ctx, lease); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := locker.Acquire(ctx, "job-createTickets", "c", time.Minute); !errors.Is(err, ErrLockHeld) {
+		test.Errorf("c acquired the lock b holds: %v", err)
+	}
+}
+
+func TestFileLockerRenewAndExpiry(test *testing.T) {
+	ctx := context.Background()
+	locker := &FileLocker{Dir: test.TempDir()}
+	lease, err := locker.Acquire(ctx, "job-createTickets", "a", 50*time.Millisecond)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expiresAt := lease.ExpiresAt
+	if err := locker.Renew(ctx, lease, time.Minute); err != nil {
+		test.Fatal(err)
+	}
+	if !lease.ExpiresAt.After(expiresAt) {
+		test.Errorf("renewing moved the expiry from %v to %v", expiresAt, lease.ExpiresAt)
+	}
+	if err := locker.Renew(ctx, lease, 50*time.Millisecond); err != nil {
+		test.Fatal(err)
+	}
+
+	// Once it expires, someone else may take it and a renewal finds it lost
+	time.Sleep(60 * time.Millisecond)
+	if _, err := locker.Acquire(ctx, "job-createTickets", "b", time.Minute); err != nil {
+		test.Fatalf("b couldn't take an expired lock: %v", err)
+	}
+	if err := locker.Renew(ctx, lease, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		test.Errorf("renewing a taken lease returned %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestWithLockCancelsWhenLeaseIsLost(test *testing.T) {
+	locker := &FileLocker{Dir: test.TempDir()}
+	ttl := 30 * time.Millisecond
+	err := WithLock(context.Background(), locker, "job-createTickets", "a", ttl, func(ctx context.Context) error {
+		// Someone clears the lease, the next renewal finds it gone
+		if err := locker.Release(ctx, &Lease{Name: "job-createTickets", Owner: "a"}); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("still running a second after losing the lease")
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		test.Errorf("got %v, want the run canceled", err)
+	}
+}
+
+func TestWithLockHeld(test *testing.T) {
+	ctx := context.Background()
+	locker := &FileLocker{Dir: test.TempDir()}
+	if _, err := locker.Acquire(ctx, "job-createTickets", "b", time.Minute); err != nil {
+		test.Fatal(err)
+	}
+	ran := false
+	err := WithLock(ctx, locker, "job-createTickets", "a", time.Minute, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, ErrLockHeld) || ran {
+		test.Errorf("got %v and ran %v, want ErrLockHeld without running", err, ran)
+	}
+}
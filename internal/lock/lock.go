@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	u "ticketservice/internal/utils"
+)
+
+var (
+	// ErrLockHeld is returned by Acquire when another owner holds a live lease.
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLeaseLost is returned by Renew when the lease expired and was taken.
+	ErrLeaseLost = errors.New("lease was lost")
+)
+
+// Lease is a time limited claim on a named lock.
+type Lease struct {
+	Name      string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+// Locker hands out leases. A lease that isn't renewed expires after its TTL,
+// so a replica that dies can't hold a lock forever.
+type Locker interface {
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error)
+	Renew(ctx context.Context, lease *Lease, ttl time.Duration) error
+	Release(ctx context.Context, lease *Lease) error
+}
+
+// WithLock runs fn while holding the named lock, renewing the lease every
+// third of its TTL. The context given to fn is canceled if the lease is lost.
+func WithLock(ctx context.Context, l Locker, name, owner string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lease, err := l.Acquire(ctx, name, owner, ttl)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.Renew(ctx, lease, ttl); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					u.LogPrint(3, "[Lock] Failed to renew %s: %v", name, err)
+					if errors.Is(err, ErrLeaseLost) {
+						cancel()
+						return
+					}
+				}
+			}
+		}
+	}()
+	err = fn(ctx)
+	cancel()
+	<-renewed
+	// Release with a fresh context, ours is already canceled
+	if releaseErr := l.Release(context.Background(), lease); releaseErr != nil {
+		u.LogPrint(3, "[Lock] Failed to release %s: %v", name, releaseErr)
+	}
+	return err
+}
+
+// New returns the Locker for the configured backend.
+func New(backend, fileDir, bqTable string) (Locker, error) {
+	switch backend {
+	case "bigquery":
+		return &BigQueryLocker{TableID: bqTable}, nil
+	case "file":
+		return &FileLocker{Dir: fileDir}, nil
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q, expected bigquery or file", backend)
+	}
+}
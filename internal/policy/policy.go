@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Policy controls which recommendations of a recommender and subtype get
+// tickets, and how those tickets behave. An empty Recommender or Subtype
+// matches any value.
+type Policy struct {
+	Recommender   string
+	Subtype       string
+	CostThreshold int
+	AllowNullCost bool
+	SnoozeDays    int
+	// The most tickets this policy creates in one run
+	MaxPerRun int
+	// Template overrides, empty uses the default templates
+	TitleTemplate  string
+	UpdateTemplate string
+}
+
+// Key identifies the policy in queries and logs.
+func (p Policy) Key() string {
+	if p.Recommender == "" && p.Subtype == "" {
+		return "default"
+	}
+	return p.Recommender + "/" + p.Subtype
+}
+
+// specificity orders policies so the most specific one wins:
+// recommender and subtype, then recommender only, then subtype only.
+func (p Policy) specificity() int {
+	score := 0
+	if p.Recommender != "" {
+		score += 2
+	}
+	if p.Subtype != "" {
+		score += 1
+	}
+	return score
+}
+
+func (p Policy) matches(recommender, subtype string) bool {
+	return (p.Recommender == "" || p.Recommender == recommender) &&
+		(p.Subtype == "" || p.Subtype == subtype)
+}
+
+// Set is the default policy plus any overrides.
+type Set struct {
+	Default  Policy
+	Policies []Policy
+	// Subtypes that never get tickets
+	ExcludeSubTypes []string
+}
+
+func NewSet(def Policy, policies []Policy) *Set {
+	sorted := make([]Policy, len(policies))
+	copy(sorted, policies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].specificity() > sorted[j].specificity()
+	})
+	return &Set{Default: def, Policies: sorted}
+}
+
+// Match returns the policy for a recommendation.
+func (s *Set) Match(recommender, subtype string) Policy {
+	for _, p := range s.Policies {
+		if p.matches(recommender, subtype) {
+			return p
+		}
+	}
+	return s.Default
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "\\'") + "'"
+}
+
+func (p Policy) condition(recommenderCol, subtypeCol string) string {
+	var parts []string
+	if p.Recommender != "" {
+		parts = append(parts, fmt.Sprintf("%s = %s", recommenderCol, quote(p.Recommender)))
+	}
+	if p.Subtype != "" {
+		parts = append(parts, fmt.Sprintf("%s = %s", subtypeCol, quote(p.Subtype)))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// caseSQL builds a CASE expression over the policies in match order,
+// with value giving the result for each policy.
+func (s *Set) caseSQL(recommenderCol, subtypeCol string, value func(Policy) string) string {
+	if len(s.Policies) == 0 {
+		return value(s.Default)
+	}
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, p := range s.Policies {
+		fmt.Fprintf(&b, " WHEN %s THEN %s", p.condition(recommenderCol, subtypeCol), value(p))
+	}
+	fmt.Fprintf(&b, " ELSE %s END", value(s.Default))
+	return b.String()
+}
+
+// KeySQL is a SQL expression evaluating to the key of the matching policy.
+func (s *Set) KeySQL(recommenderCol, subtypeCol string) string {
+	return s.caseSQL(recommenderCol, subtypeCol, func(p Policy) string {
+		return quote(p.Key())
+	})
+}
+
+// FilterSQL is a SQL condition that is true when a recommendation meets
+// the cost threshold of its policy.
+func (s *Set) FilterSQL(recommenderCol, subtypeCol, costCol string) string {
+	return s.caseSQL(recommenderCol, subtypeCol, func(p Policy) string {
+		if p.AllowNullCost {
+			return fmt.Sprintf("(%s >= %d OR %s IS NULL)", costCol, p.CostThreshold, costCol)
+		}
+		return fmt.Sprintf("IFNULL(%s >= %d, FALSE)", costCol, p.CostThreshold)
+	})
+}
+
+// CapSQL is a SQL expression evaluating to the per run cap of the matching policy.
+func (s *Set) CapSQL(recommenderCol, subtypeCol string) string {
+	return s.caseSQL(recommenderCol, subtypeCol, func(p Policy) string {
+		return fmt.Sprintf("%d", p.MaxPerRun)
+	})
+}
+
+// SnoozeDaysSQL is a SQL expression evaluating to the snooze days of the matching policy.
+func (s *Set) SnoozeDaysSQL(recommenderCol, subtypeCol string) string {
+	return s.caseSQL(recommenderCol, subtypeCol, func(p Policy) string {
+		return fmt.Sprintf("%d", p.SnoozeDays)
+	})
+}
+
+// MaxTotal is the most tickets all the policies together create in one run.
+func (s *Set) MaxTotal() int {
+	total := s.Default.MaxPerRun
+	for _, p := range s.Policies {
+		total += p.MaxPerRun
+	}
+	return total
+}
+
+var current atomic.Pointer[Set]
+
+// Current returns the policies in effect. Until SetCurrent is called
+// every recommendation gets an empty default policy.
+func Current() *Set {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return &Set{Default: Policy{SnoozeDays: 7}}
+}
+
+// SetCurrent swaps the policies in effect.
+func SetCurrent(s *Set) {
+	current.Store(s)
+}
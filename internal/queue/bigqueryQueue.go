@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"time"
+
+	b "ticketservice/internal/bigqueryfunctions"
+)
+
+// BigQueryQueue keeps jobs in a BigQuery table so every replica sharing the
+// dataset works off the same queue. Each call is a DML statement taking a
+// second or two, Enqueue included, which eats into the 3 seconds Slack gives
+// a webhook, and idle workers poll with UPDATE statements. It doesn't suit
+// the webhook path, use the file backend on a shared filesystem instead.
+type BigQueryQueue struct {
+	TableID string
+}
+
+func toJob(j *b.QueuedJob) *Job {
+	return &Job{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Payload:    j.Payload,
+		Attempts:   int(j.Attempts),
+		EnqueuedAt: j.EnqueuedAt,
+		LastError:  j.LastError,
+		Receipt:    j.Receipt,
+	}
+}
+
+func (q *BigQueryQueue) Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error) {
+	job := &Job{ID: newID(), Kind: kind, Payload: payload, EnqueuedAt: time.Now()}
+	if err := b.EnqueueJob(q.TableID, job.ID, kind, payload); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *BigQueryQueue) Dequeue(ctx context.Context, visibility time.Duration) (*Job, error) {
+	j, err := b.ClaimJob(q.TableID, newReceipt(), visibility)
+	if err != nil || j == nil {
+		return nil, err
+	}
+	return toJob(j), nil
+}
+
+// settled turns a statement that touched nothing into ErrReceiptExpired
+func settled(ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrReceiptExpired
+	}
+	return nil
+}
+
+func (q *BigQueryQueue) Ack(ctx context.Context, job *Job) error {
+	return settled(b.AckJob(q.TableID, job.ID, job.Receipt))
+}
+
+func (q *BigQueryQueue) Retry(ctx context.Context, job *Job, delay time.Duration, cause error) error {
+	return settled(b.RetryJob(q.TableID, job.ID, job.Receipt, delay, errorString(cause)))
+}
+
+func (q *BigQueryQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	return settled(b.DeadLetterJob(q.TableID, job.ID, job.Receipt, errorString(cause)))
+}
+
+func (q *BigQueryQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	rows, err := b.GetDeadJobs(q.TableID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, len(rows))
+	for i, row := range rows {
+		jobs[i] = toJob(row)
+	}
+	return jobs, nil
+}
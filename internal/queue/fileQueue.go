@@ -0,0 +1,238 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errSkip leaves a job file as it is
+var errSkip = errors.New("skip")
+
+// FileQueue keeps each job in a file under Dir and dead letters under
+// Dir/dead. Jobs survive restarts, and like the file locker it works
+// across replicas sharing a filesystem.
+type FileQueue struct {
+	Dir string
+}
+
+type fileJob struct {
+	Job
+	VisibleAt time.Time
+}
+
+func (q *FileQueue) deadDir() string {
+	return filepath.Join(q.Dir, "dead")
+}
+
+func (q *FileQueue) path(id string) string {
+	return filepath.Join(q.Dir, id+".json")
+}
+
+// update opens a job file under an exclusive flock and lets fn change it.
+// Returning nil from fn removes the file, errSkip leaves it alone.
+func (q *FileQueue) update(id string, fn func(current *fileJob) (*fileJob, error)) error {
+	f, err := os.OpenFile(q.path(id), os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrReceiptExpired
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	// Removed by someone else between opening and locking it
+	if len(data) == 0 {
+		return ErrReceiptExpired
+	}
+	var current fileJob
+	if err := json.Unmarshal(data, &current); err != nil {
+		return err
+	}
+	next, err := fn(&current)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		// Truncate first, so anyone who opened the file before it's removed sees it's gone
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		return os.Remove(q.path(id))
+	}
+	data, err = json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(data, 0)
+	return err
+}
+
+func (q *FileQueue) Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error) {
+	if err := os.MkdirAll(q.Dir, 0755); err != nil {
+		return nil, err
+	}
+	job := fileJob{
+		Job:       Job{ID: newID(), Kind: kind, Payload: payload, EnqueuedAt: time.Now()},
+		VisibleAt: time.Now(),
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	// Write elsewhere and rename, so nobody reads half a job
+	tmp := filepath.Join(q.Dir, "."+job.ID+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, q.path(job.ID)); err != nil {
+		return nil, err
+	}
+	return &job.Job, nil
+}
+
+// ids lists the jobs in dir, oldest first
+func ids(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (q *FileQueue) Dequeue(ctx context.Context, visibility time.Duration) (*Job, error) {
+	jobIDs, err := ids(q.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range jobIDs {
+		var claimed *Job
+		err := q.update(id, func(current *fileJob) (*fileJob, error) {
+			now := time.Now()
+			if current.VisibleAt.After(now) {
+				return nil, errSkip
+			}
+			current.VisibleAt = now.Add(visibility)
+			current.Attempts++
+			current.Receipt = newReceipt()
+			job := current.Job
+			claimed = &job
+			return current, nil
+		})
+		if errors.Is(err, errSkip) || errors.Is(err, ErrReceiptExpired) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return claimed, nil
+	}
+	return nil, nil
+}
+
+// settle changes a job the caller still holds
+func (q *FileQueue) settle(job *Job, fn func(current *fileJob) (*fileJob, error)) error {
+	return q.update(job.ID, func(current *fileJob) (*fileJob, error) {
+		if current.Receipt != job.Receipt {
+			return nil, ErrReceiptExpired
+		}
+		return fn(current)
+	})
+}
+
+func (q *FileQueue) Ack(ctx context.Context, job *Job) error {
+	return q.settle(job, func(current *fileJob) (*fileJob, error) {
+		return nil, nil
+	})
+}
+
+func (q *FileQueue) Retry(ctx context.Context, job *Job, delay time.Duration, cause error) error {
+	return q.settle(job, func(current *fileJob) (*fileJob, error) {
+		current.VisibleAt = time.Now().Add(delay)
+		current.LastError = errorString(cause)
+		current.Receipt = ""
+		return current, nil
+	})
+}
+
+func (q *FileQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	if err := os.MkdirAll(q.deadDir(), 0755); err != nil {
+		return err
+	}
+	return q.settle(job, func(current *fileJob) (*fileJob, error) {
+		current.LastError = errorString(cause)
+		current.Receipt = ""
+		data, err := json.Marshal(current.Job)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(q.deadDir(), current.ID+".json"), data, 0644); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
+
+func (q *FileQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	jobIDs, err := ids(q.deadDir())
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, id := range jobIDs {
+		data, err := os.ReadFile(filepath.Join(q.deadDir(), id+".json"))
+		if err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryJob struct {
+	job       Job
+	visibleAt time.Time
+}
+
+// MemoryQueue keeps jobs in the process. Nothing survives a restart, which
+// is fine for local development and for work Slack would retry anyway.
+type MemoryQueue struct {
+	mutex sync.Mutex
+	jobs  map[string]*memoryJob
+	dead  []*Job
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{jobs: make(map[string]*memoryJob)}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job := Job{ID: newID(), Kind: kind, Payload: payload, EnqueuedAt: time.Now()}
+	q.jobs[job.ID] = &memoryJob{job: job, visibleAt: job.EnqueuedAt}
+	return &job, nil
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context, visibility time.Duration) (*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := time.Now()
+	var next *memoryJob
+	for _, j := range q.jobs {
+		if j.visibleAt.After(now) {
+			continue
+		}
+		if next == nil || j.job.ID < next.job.ID {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.visibleAt = now.Add(visibility)
+	next.job.Attempts++
+	next.job.Receipt = newReceipt()
+	job := next.job
+	return &job, nil
+}
+
+// held returns the job if the receipt is still the latest one handed out
+func (q *MemoryQueue) held(job *Job) (*memoryJob, error) {
+	j, ok := q.jobs[job.ID]
+	if !ok || j.job.Receipt != job.Receipt {
+		return nil, ErrReceiptExpired
+	}
+	return j, nil
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, job *Job) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, err := q.held(job); err != nil {
+		return err
+	}
+	delete(q.jobs, job.ID)
+	return nil
+}
+
+func (q *MemoryQueue) Retry(ctx context.Context, job *Job, delay time.Duration, cause error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	j, err := q.held(job)
+	if err != nil {
+		return err
+	}
+	j.visibleAt = time.Now().Add(delay)
+	j.job.LastError = errorString(cause)
+	j.job.Receipt = ""
+	return nil
+}
+
+func (q *MemoryQueue) DeadLetter(ctx context.Context, job *Job, cause error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	j, err := q.held(job)
+	if err != nil {
+		return err
+	}
+	delete(q.jobs, job.ID)
+	dead := j.job
+	dead.LastError = errorString(cause)
+	dead.Receipt = ""
+	q.dead = append(q.dead, &dead)
+	return nil
+}
+
+func (q *MemoryQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	jobs := make([]*Job, len(q.dead))
+	for i, j := range q.dead {
+		job := *j
+		jobs[i] = &job
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrReceiptExpired is returned when a job is acked, retried or dead
+// lettered after its visibility timeout ran out. Someone else may have it now.
+var ErrReceiptExpired = errors.New("job receipt expired")
+
+// Job is a piece of deferred work. Kind picks the handler, the payload is
+// whatever the handler needs and is opaque to the queue.
+type Job struct {
+	ID         string
+	Kind       string
+	Payload    []byte
+	Attempts   int
+	EnqueuedAt time.Time
+	LastError  string
+	// Set by Dequeue, only the holder of the latest receipt can settle the job
+	Receipt string
+}
+
+// Queue holds jobs until a worker takes them. A dequeued job is hidden for
+// the visibility timeout, if it isn't settled by then it's handed out again,
+// so a worker that dies can't lose a job.
+type Queue interface {
+	Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error)
+	// Dequeue returns the oldest visible job, or nil if there is none
+	Dequeue(ctx context.Context, visibility time.Duration) (*Job, error)
+	// Ack removes a job that is done
+	Ack(ctx context.Context, job *Job) error
+	// Retry makes a job visible again after delay
+	Retry(ctx context.Context, job *Job, delay time.Duration, cause error) error
+	// DeadLetter sets a job aside for good, it's kept so someone can look at it
+	DeadLetter(ctx context.Context, job *Job, cause error) error
+	DeadLetters(ctx context.Context) ([]*Job, error)
+}
+
+// New returns the Queue for the configured backend.
+func New(backend, fileDir, bqTable string) (Queue, error) {
+	switch backend {
+	case "memory":
+		return NewMemoryQueue(), nil
+	case "file":
+		return &FileQueue{Dir: fileDir}, nil
+	case "bigquery":
+		return &BigQueryQueue{TableID: bqTable}, nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q, expected memory, file or bigquery", backend)
+	}
+}
+
+// newID returns an ID that sorts by creation time
+func newID() string {
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), newReceipt()[:8])
+}
+
+func newReceipt() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	u "ticketservice/internal/utils"
+)
+
+// Handler does the work for a job. Returning an error retries the job, so
+// once a handler has changed something it should return nil and only log
+// what fails afterwards, I.E. a reply that couldn't be posted.
+type Handler func(ctx context.Context, payload []byte) error
+
+var (
+	handlersMutex sync.RWMutex
+	handlers      = map[string]Handler{}
+	current       atomic.Pointer[Queue]
+	// wake lets a worker pick up a job enqueued in this process without waiting to poll
+	wake = make(chan struct{}, 1)
+)
+
+// Register sets the handler for a kind of job. Plugins register theirs in
+// Init, the queue package is shared with the service so they land in the
+// same registry.
+func Register(kind string, handler Handler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers[kind] = handler
+}
+
+func handler(kind string) Handler {
+	handlersMutex.RLock()
+	defer handlersMutex.RUnlock()
+	return handlers[kind]
+}
+
+// SetCurrent sets the queue Enqueue adds jobs to
+func SetCurrent(q Queue) {
+	current.Store(&q)
+}
+
+// Current returns the queue set by SetCurrent, or nil before it's set
+func Current() Queue {
+	q := current.Load()
+	if q == nil {
+		return nil
+	}
+	return *q
+}
+
+// Enqueue adds a job to the current queue
+func Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error) {
+	q := Current()
+	if q == nil {
+		return nil, fmt.Errorf("no work queue configured")
+	}
+	job, err := q.Enqueue(ctx, kind, payload)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Worker takes jobs off a queue and runs their handlers
+type Worker struct {
+	Queue             Queue
+	Workers           int
+	MaxAttempts       int
+	VisibilityTimeout time.Duration
+	PollInterval      time.Duration
+	// Retries wait RetryBackoff, doubling with each attempt up to VisibilityTimeout
+	RetryBackoff time.Duration
+}
+
+// Run starts the workers and returns once ctx is done and they've stopped
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for {
+		job, err := w.Queue.Dequeue(ctx, w.VisibilityTimeout)
+		if err != nil {
+			u.LogPrint(3, "Failed to take a job off the queue: %v", err)
+		}
+		if job != nil {
+			w.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.RetryBackoff
+	for i := 1; i < attempts && delay < w.VisibilityTimeout; i++ {
+		delay *= 2
+	}
+	if delay > w.VisibilityTimeout {
+		delay = w.VisibilityTimeout
+	}
+	return delay
+}
+
+// run handles a job and settles it. A job whose receipt expired while it
+// ran was handed to someone else, so there's nothing left to settle.
+func (w *Worker) run(ctx context.Context, job *Job) {
+	h := handler(job.Kind)
+	if h == nil {
+		err := fmt.Errorf("no handler for %s jobs", job.Kind)
+		u.LogPrint(3, "Dead lettering job %s: %v", job.ID, err)
+		if err := w.Queue.DeadLetter(ctx, job, err); err != nil {
+			u.LogPrint(3, "Failed to dead letter job %s: %v", job.ID, err)
+		}
+		return
+	}
+	err := h(ctx, job.Payload)
+	switch {
+	case err == nil:
+		err = w.Queue.Ack(ctx, job)
+	case job.Attempts >= w.MaxAttempts:
+		u.LogPrint(3, "Dead lettering %s job %s after %d attempts: %v", job.Kind, job.ID, job.Attempts, err)
+		err = w.Queue.DeadLetter(ctx, job, err)
+	default:
+		delay := w.backoff(job.Attempts)
+		u.LogPrint(2, "Retrying %s job %s in %v: %v", job.Kind, job.ID, delay, err)
+		err = w.Queue.Retry(ctx, job, delay, err)
+	}
+	if err != nil {
+		u.LogPrint(3, "Failed to settle %s job %s: %v", job.Kind, job.ID, err)
+	}
+}
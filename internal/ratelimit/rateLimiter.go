@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	u "ticketservice/internal/utils"
+)
+
+// Limit describes the token bucket for a single backend API method.
+// Most ticket systems publish their limits per minute, so that is what we use here.
+type Limit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// RetryPolicy controls how rate limited calls are retried.
+type RetryPolicy struct {
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// RetryAfter reports whether err is a rate limit response and, if the
+	// backend told us, how long we should wait before trying again.
+	RetryAfter func(err error) (time.Duration, bool)
+}
+
+// Limiter holds one token bucket per backend API method and retries
+// calls that were rejected for being rate limited.
+type Limiter struct {
+	mu       sync.Mutex
+	limits   map[string]Limit
+	fallback Limit
+	buckets  map[string]*rate.Limiter
+	policy   RetryPolicy
+}
+
+func NewLimiter(limits map[string]Limit, fallback Limit, policy RetryPolicy) *Limiter {
+	if policy.BaseBackoff <= 0 {
+		policy.BaseBackoff = time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = time.Minute
+	}
+	return &Limiter{
+		limits:   limits,
+		fallback: fallback,
+		buckets:  make(map[string]*rate.Limiter),
+		policy:   policy,
+	}
+}
+
+// bucket returns the token bucket for method, creating it on first use.
+func (l *Limiter) bucket(method string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[method]; ok {
+		return b
+	}
+	limit, ok := l.limits[method]
+	if !ok {
+		limit = l.fallback
+	}
+	r := rate.Inf
+	if limit.PerMinute > 0 {
+		r = rate.Limit(limit.PerMinute / 60)
+	}
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	b := rate.NewLimiter(r, burst)
+	l.buckets[method] = b
+	return b
+}
+
+// Do waits for a token for method and then calls fn. If fn fails because the
+// backend rate limited us it is retried with backoff, honouring any Retry-After
+// the backend returned, until MaxRetries is reached.
+func (l *Limiter) Do(ctx context.Context, method string, fn func() error) error {
+	b := l.bucket(method)
+	for attempt := 0; ; attempt++ {
+		if err := b.Wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if l.policy.RetryAfter == nil {
+			return err
+		}
+		retryAfter, limited := l.policy.RetryAfter(err)
+		if !limited || attempt >= l.policy.MaxRetries {
+			return err
+		}
+		wait := l.backoff(attempt, retryAfter)
+		u.LogPrint(2, "[RateLimit] %s was rate limited, retrying in %v (attempt %d)", method, wait, attempt+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff uses the Retry-After value when we have one, otherwise an
+// exponential backoff with a little jitter so workers don't retry in lockstep.
+func (l *Limiter) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	wait := l.policy.BaseBackoff << uint(attempt)
+	if wait <= 0 || wait > l.policy.MaxBackoff {
+		wait = l.policy.MaxBackoff
+	}
+	return wait + time.Duration(rand.Int63n(int64(l.policy.BaseBackoff)))
+}
+
+// ParseLimits parses overrides in the form "method=perMinute[:burst],..."
+// I.E. "conversations.create=20,chat.postMessage=60:5"
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, expected method=perMinute[:burst]", part)
+		}
+		perMinute, burst, _ := strings.Cut(value, ":")
+		var limit Limit
+		var err error
+		if limit.PerMinute, err = strconv.ParseFloat(perMinute, 64); err != nil {
+			return nil, fmt.Errorf("invalid rate for %s: %v", method, err)
+		}
+		if burst != "" {
+			if limit.Burst, err = strconv.Atoi(burst); err != nil {
+				return nil, fmt.Errorf("invalid burst for %s: %v", method, err)
+			}
+		}
+		limits[strings.TrimSpace(method)] = limit
+	}
+	return limits, nil
+}
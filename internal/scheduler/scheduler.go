@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	u "ticketservice/internal/utils"
+)
+
+var (
+	// ErrJobRunning is returned when a job is triggered while it is still running.
+	ErrJobRunning = errors.New("job is already running")
+	// ErrSkipped can be wrapped by a job that decided not to run, I.E. another
+	// replica holds its lock. It's reported as a skip rather than a failure.
+	ErrSkipped = errors.New("skipped")
+)
+
+// Job is a unit of work the scheduler runs. Schedule may be nil for jobs that
+// are only ever triggered manually (I.E. over HTTP).
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Up to Jitter is added to every scheduled run so replicas spread out
+	Jitter time.Duration
+	Run    func(ctx context.Context) error
+}
+
+// JobStatus is what the /jobs endpoint reports for each job.
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Scheduled    bool       `json:"scheduled"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastResult   string     `json:"lastResult,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+type jobState struct {
+	job     Job
+	mu      sync.Mutex
+	running bool
+	status  JobStatus
+}
+
+// Scheduler runs registered jobs on their schedules, never running
+// the same job twice at once.
+type Scheduler struct {
+	mu     sync.Mutex
+	jobs   map[string]*jobState
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		jobs:   make(map[string]*jobState),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &jobState{
+		job:    job,
+		status: JobStatus{Name: job.Name, Scheduled: job.Schedule != nil},
+	}
+	return nil
+}
+
+// Start launches a goroutine per scheduled job.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, state := range s.jobs {
+		if state.job.Schedule == nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(state)
+	}
+}
+
+// Stop cancels running jobs and waits for the loops to exit.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(state *jobState) {
+	defer s.wg.Done()
+	for {
+		next := state.job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			u.LogPrint(3, "[Scheduler] Job %s will never run again", state.job.Name)
+			return
+		}
+		if state.job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(state.job.Jitter))))
+		}
+		state.mu.Lock()
+		state.status.NextRun = &next
+		state.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.run(state); errors.Is(err, ErrJobRunning) {
+			u.LogPrint(2, "[Scheduler] Skipping %s, previous run is still going", state.job.Name)
+		}
+	}
+}
+
+// RunNow runs a job immediately and waits for it to finish.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	state, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown job %s", name)
+	}
+	return s.run(state)
+}
+
+func (s *Scheduler) run(state *jobState) error {
+	state.mu.Lock()
+	if state.running {
+		state.mu.Unlock()
+		return ErrJobRunning
+	}
+	state.running = true
+	state.mu.Unlock()
+
+	u.LogPrint(1, "[Scheduler] Running %s", state.job.Name)
+	start := time.Now()
+	err := state.job.Run(s.ctx)
+	result := "ok"
+	if errors.Is(err, ErrSkipped) {
+		result = err.Error()
+		u.LogPrint(2, "[Scheduler] Job %s %v", state.job.Name, err)
+	} else if err != nil {
+		result = err.Error()
+		u.LogPrint(3, "[Scheduler] Job %s failed: %v", state.job.Name, err)
+	}
+
+	state.mu.Lock()
+	state.running = false
+	state.status.LastRun = &start
+	state.status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	state.status.LastResult = result
+	state.mu.Unlock()
+	return err
+}
+
+// Status returns the state of every job sorted by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, state := range s.jobs {
+		state.mu.Lock()
+		status := state.status
+		status.Running = state.running
+		state.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
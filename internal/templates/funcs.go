@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"ticketservice/internal/locale"
+)
+
+// FuncMap is every helper available to ticket templates, formatting for loc.
+//
+//	{{currency .Row.ImpactCostUnit .Row.ImpactCurrencyCode}}  $1,234.00
+//	{{number .Row.ImpactCostUnit}}                            1,234
+//	{{shortResource .Row.TargetResource}}                     instance-1
+//	{{consoleURL .Row.TargetResource}}                        https://console.cloud.google.com/...
+//	{{date .Ticket.SnoozeDate}}                               Oct 26, 2026
+//	{{relativeDate .Ticket.SnoozeDate}}                       in 7 days
+//	{{truncate 80 .Row.Description}}                          first 80 characters...
+//	{{slugify .Row.RecommenderSubtype}}                       change-machine-type
+func FuncMap(loc string) template.FuncMap {
+	return template.FuncMap{
+		"currency": func(amount interface{}, code string) (string, error) {
+			value, err := toFloat(amount)
+			if err != nil {
+				return "", err
+			}
+			return locale.Currency(loc, value, code), nil
+		},
+		"number": func(amount interface{}) (string, error) {
+			value, err := toFloat(amount)
+			if err != nil {
+				return "", err
+			}
+			return locale.Number(loc, value, 0), nil
+		},
+		"shortResource": ShortResource,
+		"consoleURL":    ConsoleURL,
+		"date": func(v interface{}) (string, error) {
+			date, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return locale.Date(loc, date), nil
+		},
+		"relativeDate": func(v interface{}) (string, error) {
+			date, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return locale.RelativeDate(loc, date, time.Now()), nil
+		},
+		"truncate": Truncate,
+		"slugify":  Slugify,
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%T is not a number", v)
+}
+
+// ShortResource returns the last part of a full resource name, so
+// //compute.googleapis.com/projects/p/zones/z/instances/vm-1 becomes vm-1
+func ShortResource(resource string) string {
+	resource = strings.TrimRight(resource, "/")
+	if i := strings.LastIndex(resource, "/"); i >= 0 {
+		return resource[i+1:]
+	}
+	return resource
+}
+
+// parseResource splits //service.googleapis.com/collection/id/... into the
+// service and a map of collection to id.
+func parseResource(resource string) (string, map[string]string) {
+	resource = strings.TrimPrefix(resource, "//")
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+	ids := make(map[string]string)
+	for i := 1; i+1 < len(parts); i += 2 {
+		ids[parts[i]] = parts[i+1]
+	}
+	return parts[0], ids
+}
+
+const consoleBase = "https://console.cloud.google.com/"
+
+// ConsoleURL builds a Cloud Console link for a full resource name. Resources
+// it doesn't know link to the project dashboard.
+func ConsoleURL(resource string) string {
+	service, ids := parseResource(resource)
+	project := ids["projects"]
+	path := "home/dashboard"
+	switch service {
+	case "compute.googleapis.com":
+		switch {
+		case ids["instances"] != "" && ids["zones"] != "":
+			path = fmt.Sprintf("compute/instancesDetail/zones/%s/instances/%s", ids["zones"], ids["instances"])
+		case ids["disks"] != "" && ids["zones"] != "":
+			path = fmt.Sprintf("compute/disksDetail/zones/%s/disks/%s", ids["zones"], ids["disks"])
+		case ids["disks"] != "" && ids["regions"] != "":
+			path = fmt.Sprintf("compute/disksDetail/regions/%s/disks/%s", ids["regions"], ids["disks"])
+		case ids["images"] != "":
+			path = fmt.Sprintf("compute/imagesDetail/projects/%s/global/images/%s", project, ids["images"])
+		case ids["addresses"] != "":
+			path = "networking/addresses/list"
+		case ids["instanceGroupManagers"] != "":
+			path = "compute/instanceGroups/list"
+		default:
+			path = "compute/instances"
+		}
+	case "sqladmin.googleapis.com":
+		if ids["instances"] != "" {
+			path = fmt.Sprintf("sql/instances/%s/overview", ids["instances"])
+		}
+	case "storage.googleapis.com":
+		// Buckets are named //storage.googleapis.com/bucket-name
+		if bucket := ShortResource(resource); bucket != service {
+			path = "storage/browser/" + bucket
+		}
+	case "cloudresourcemanager.googleapis.com", "iam.googleapis.com":
+		path = "iam-admin/iam"
+	case "container.googleapis.com":
+		if ids["clusters"] != "" && ids["locations"] != "" {
+			path = fmt.Sprintf("kubernetes/clusters/details/%s/%s/details", ids["locations"], ids["clusters"])
+		}
+	}
+	if project == "" {
+		return consoleBase + path
+	}
+	return consoleBase + path + "?project=" + project
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch d := v.(type) {
+	case time.Time:
+		return d, nil
+	case *time.Time:
+		return *d, nil
+	case string:
+		// Tickets read by IssueKey use the BigQuery layout
+		if date, err := time.Parse("2006-01-02 15:04:05", d); err == nil {
+			return date, nil
+		}
+		return time.Parse(time.RFC3339, d)
+	}
+	return time.Time{}, fmt.Errorf("%T is not a date", v)
+}
+
+// Truncate shortens s to at most n characters, ending in ... when cut.
+// The length comes first so it works in a pipeline: {{.Row.Description | truncate 80}}
+func Truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string([]rune(s)[:n])
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
+
+var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify lower cases s and replaces everything but letters and numbers
+// with dashes, so CHANGE_MACHINE_TYPE becomes change-machine-type
+func Slugify(s string) string {
+	return strings.Trim(slugRegex.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
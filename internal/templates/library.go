@@ -0,0 +1,239 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"ticketservice/internal/locale"
+	"ticketservice/internal/policy"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// Kinds of template, the ticket title and a message for each ticket event
+const (
+	Title     = "title"
+	Created   = t.EventCreated
+	Reminder  = t.EventReminder
+	Snoozed   = t.EventSnoozed
+	Closed    = t.EventClosed
+	Resolved  = t.EventResolved
+	Reopened  = t.EventReopened
+	Dismissed = t.EventDismissed
+)
+
+// Kinds lists every kind of template
+var Kinds = []string{Title, Created, Reminder, Snoozed, Closed, Resolved, Reopened, Dismissed}
+
+// Paths names the template file for each kind. Kinds left out fall back.
+type Paths map[string]string
+
+// Library holds every parsed template and picks the one to use for a
+// recommendation. The most specific wins: a policy override, then the
+// templates for the recommender subtype, then the defaults. Each of those
+// can be translated by a file next to it named after the locale, I.E.
+// updateTicketTpl.ja.txt, otherwise the English one is used.
+type Library struct {
+	defaults map[string]string
+	subtypes map[string]Paths
+	// Every template by path, in English and by locale
+	parsed    map[string]*template.Template
+	localized map[string]map[string]*template.Template
+}
+
+func parse(path string) (*template.Template, error) {
+	tpl, err := template.New(filepath.Base(path)).Funcs(FuncMap(locale.English)).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", path, err)
+	}
+	return tpl, nil
+}
+
+// LocalizedPath is where the translation of a template lives,
+// updateTicketTpl.txt in Japanese is updateTicketTpl.ja.txt
+func LocalizedPath(path, loc string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + loc + ext
+}
+
+// Load parses the default templates, the per subtype templates, any
+// other files (policy overrides) and their translations to locales.
+// Every problem is returned, a Library is only returned when everything parsed.
+func Load(defaults Paths, subtypes map[string]Paths, files []string, locales []string) (*Library, []error) {
+	var problems []error
+	l := &Library{
+		defaults:  defaults,
+		subtypes:  subtypes,
+		parsed:    make(map[string]*template.Template),
+		localized: make(map[string]map[string]*template.Template),
+	}
+	paths := []string{}
+	for _, kind := range Kinds {
+		paths = append(paths, defaults[kind])
+	}
+	for _, kinds := range subtypes {
+		for _, path := range kinds {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	paths = append(paths, files...)
+	for _, path := range paths {
+		if _, ok := l.parsed[path]; ok {
+			continue
+		}
+		tpl, err := parse(path)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		l.parsed[path] = tpl
+		l.localized[path] = make(map[string]*template.Template)
+		for _, loc := range locales {
+			localized := LocalizedPath(path, loc)
+			if _, err := os.Stat(localized); errors.Is(err, os.ErrNotExist) {
+				// Not translated, English it is
+				continue
+			}
+			tpl, err := parse(localized)
+			if err != nil {
+				problems = append(problems, err)
+				continue
+			}
+			l.localized[path][loc] = tpl
+		}
+	}
+	if len(problems) > 0 {
+		sort.Slice(problems, func(i, j int) bool { return problems[i].Error() < problems[j].Error() })
+		return nil, problems
+	}
+	return l, nil
+}
+
+func policyOverride(p policy.Policy, kind string) string {
+	switch kind {
+	case Title:
+		return p.TitleTemplate
+	case Created:
+		return p.UpdateTemplate
+	}
+	return ""
+}
+
+// lookupPath returns the path of the template of a kind for a recommendation.
+func (l *Library) lookupPath(kind string, row t.RecommendationQueryResult) (string, error) {
+	p := policy.Current().Match(row.RecommenderName, row.RecommenderSubtype)
+	if path := policyOverride(p, kind); path != "" {
+		return path, nil
+	}
+	if path := l.subtypes[row.RecommenderSubtype][kind]; path != "" {
+		return path, nil
+	}
+	if path := l.defaults[kind]; path != "" {
+		return path, nil
+	}
+	return "", fmt.Errorf("no %s template", kind)
+}
+
+// Lookup returns the template of a kind for a recommendation in a locale,
+// falling back from de-CH to de to English.
+func (l *Library) Lookup(kind string, row t.RecommendationQueryResult, loc string) (*template.Template, error) {
+	path, err := l.lookupPath(kind, row)
+	if err != nil {
+		return nil, err
+	}
+	if tpl, ok := l.localized[path][loc]; ok {
+		return tpl, nil
+	}
+	base, _ := locale.Tag(loc).Base()
+	if tpl, ok := l.localized[path][base.String()]; ok {
+		return tpl, nil
+	}
+	if tpl, ok := l.parsed[path]; ok {
+		return tpl, nil
+	}
+	return nil, fmt.Errorf("template %s was not loaded", path)
+}
+
+// execute renders a template with the helpers formatting for loc
+func execute(tpl *template.Template, loc string, data interface{}) (string, error) {
+	// Clone so concurrent renders in other locales don't share the helpers
+	tpl, err := tpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Funcs(FuncMap(loc)).Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// TicketLocale is the locale a ticket is written in. Tickets from before
+// localization don't have one, they get the locale of their target contact.
+func TicketLocale(ticket *t.Ticket) string {
+	if ticket != nil && ticket.Locale != "" {
+		return ticket.Locale
+	}
+	contact := ""
+	if ticket != nil {
+		contact = ticket.TargetContact
+	}
+	return locale.Current().Resolve("", contact)
+}
+
+// Render executes the template of a kind with the row and ticket, in the ticket's locale.
+func (l *Library) Render(kind string, row t.RecommendationQueryResult, ticket *t.Ticket) (string, error) {
+	// Events such as snoozing only have the ticket, it still knows the recommender
+	if row.RecommenderName == "" && ticket != nil {
+		row.RecommenderName = ticket.RecommenderID
+	}
+	loc := TicketLocale(ticket)
+	tpl, err := l.Lookup(kind, row, loc)
+	if err != nil {
+		return "", err
+	}
+	return execute(tpl, loc, map[string]interface{}{"Row": row, "Ticket": ticket})
+}
+
+var current atomic.Pointer[Library]
+
+// Current returns the templates in use, nil until SetCurrent is called.
+func Current() *Library {
+	return current.Load()
+}
+
+// SetCurrent swaps the templates in use.
+func SetCurrent(l *Library) {
+	current.Store(l)
+}
+
+// Render renders with the templates in use.
+func Render(kind string, row t.RecommendationQueryResult, ticket *t.Ticket) (string, error) {
+	l := Current()
+	if l == nil {
+		return "", fmt.Errorf("templates have not been loaded")
+	}
+	return l.Render(kind, row, ticket)
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	"ticketservice/internal/locale"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// Sample is a made up recommendation used to check templates render.
+type Sample struct {
+	Name   string
+	Row    *t.RecommendationQueryResult
+	Ticket *t.Ticket
+}
+
+// Samples covers the kinds of rows templates need to cope with,
+// including one without a cost.
+func Samples() []Sample {
+	now := time.Now()
+	ticket := func(subject string) *t.Ticket {
+		return &t.Ticket{
+			IssueKey:       "C0123456789",
+			TargetContact:  "team-platform",
+			Subject:        subject,
+			Status:         "New",
+			CreationDate:   now.Format(time.RFC3339),
+			LastUpdateDate: now.Format(time.RFC3339),
+			LastPingDate:   now.Format(time.RFC3339),
+			SnoozeDate:     now.AddDate(0, 0, 7).Format(time.RFC3339),
+			Assignee:       []string{"U0123456789"},
+		}
+	}
+	return []Sample{
+		{
+			Name: "machine type",
+			Row: &t.RecommendationQueryResult{
+				ProjectName:        "Billing Prod",
+				ProjectId:          "billing-prod",
+				RecommenderName:    "google.compute.instance.MachineTypeRecommender",
+				Location:           "us-central1-a",
+				RecommenderSubtype: "CHANGE_MACHINE_TYPE",
+				ImpactCostUnit:     1234,
+				ImpactCurrencyCode: "USD",
+				TargetResource:     "//compute.googleapis.com/projects/billing-prod/zones/us-central1-a/instances/api-server-1",
+				Description:        "Save cost by changing machine type from e2-standard-8 to e2-standard-4.",
+			},
+			Ticket: ticket("CHANGE_MACHINE_TYPE-apiserver1"),
+		},
+		{
+			Name: "idle disk",
+			Row: &t.RecommendationQueryResult{
+				ProjectName:        "Data Lake",
+				ProjectId:          "data-lake-dev",
+				RecommenderName:    "google.compute.disk.IdleResourceRecommender",
+				Location:           "europe-west1-b",
+				RecommenderSubtype: "SNAPSHOT_AND_DELETE_DISK",
+				ImpactCostUnit:     87,
+				ImpactCurrencyCode: "EUR",
+				TargetResource:     "//compute.googleapis.com/projects/data-lake-dev/zones/europe-west1-b/disks/scratch-disk",
+				Description:        "Save cost by snapshotting and then deleting idle persistent disk 'scratch-disk'.",
+			},
+			Ticket: ticket("SNAPSHOT_AND_DELETE_DISK-scratchdisk"),
+		},
+		{
+			Name: "iam without cost",
+			Row: &t.RecommendationQueryResult{
+				ProjectName:        "Shared Services",
+				ProjectId:          "shared-services",
+				RecommenderName:    "google.iam.policy.Recommender",
+				Location:           "global",
+				RecommenderSubtype: "REMOVE_ROLE",
+				TargetResource:     "//cloudresourcemanager.googleapis.com/projects/shared-services",
+				Description:        "This role has not been used during the observation window.",
+			},
+			Ticket: ticket("REMOVE_ROLE-sharedservices"),
+		},
+	}
+}
+
+// Rendered is the output of one template for one sample.
+type Rendered struct {
+	Template string
+	Sample   string
+	Output   string
+}
+
+// Check renders every template, and every translation, against every
+// sample. It returns what rendered and every error, so a bad field in one
+// template doesn't hide another.
+func (l *Library) Check(samples []Sample) ([]Rendered, []error) {
+	paths := make([]string, 0, len(l.parsed))
+	for path := range l.parsed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var rendered []Rendered
+	var problems []error
+	render := func(name string, tpl *template.Template, loc string) {
+		for _, sample := range samples {
+			out, err := execute(tpl, loc, map[string]interface{}{"Row": sample.Row, "Ticket": sample.Ticket})
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s with %s sample: %w", name, sample.Name, err))
+				continue
+			}
+			rendered = append(rendered, Rendered{Template: name, Sample: sample.Name, Output: out})
+		}
+	}
+	for _, path := range paths {
+		render(path, l.parsed[path], locale.English)
+		locales := make([]string, 0, len(l.localized[path]))
+		for loc := range l.localized[path] {
+			locales = append(locales, loc)
+		}
+		sort.Strings(locales)
+		for _, loc := range locales {
+			render(LocalizedPath(path, loc), l.localized[path][loc], loc)
+		}
+	}
+	return rendered, problems
+}
@@ -23,19 +23,100 @@ import (
 
 // Your plugin needs to have the method CreateService that returns your BaseTicketService interface implementation
 
+// Lifecycle events of a ticket. Each one has a template of the same name
+// rendering the message posted to the ticket.
+const (
+	EventCreated   = "created"
+	EventReminder  = "reminder"
+	EventSnoozed   = "snoozed"
+	EventClosed    = "closed"
+	EventResolved  = "resolved"
+	EventReopened  = "reopened"
+	EventDismissed = "dismissed"
+)
+
+// History events with no message of their own, the command replies instead.
+const (
+	EventAssigned  = "assigned"
+	EventCommented = "commented"
+)
+
+// ClosedStatuses are the statuses of tickets that are done with
+var ClosedStatuses = []string{"Closed", "Dismissed"}
+
+// Reasons a ticket can be snoozed or dismissed for, stored on the ticket
+// and in its history.
+const (
+	ReasonFalsePositive = "false_positive"
+	ReasonPlanned       = "planned"
+	ReasonBlocked       = "blocked"
+	ReasonNotWorthIt    = "not_worth_it"
+)
+
+// Reasons lists every reason in the order they are offered
+var Reasons = []string{ReasonFalsePositive, ReasonPlanned, ReasonBlocked, ReasonNotWorthIt}
+
+// IsClosed tells if a ticket with this status is done with, closed tickets
+// get no reminders.
+func IsClosed(status string) bool {
+	for _, closed := range ClosedStatuses {
+		if status == closed {
+			return true
+		}
+	}
+	return false
+}
+
 // TicketService is an interface for managing tickets.
 type BaseTicketService interface {
 	Init() error
 	// I might want to update this to not return anything, except err. Because we are modifying the 
 	// original variable anyways. 
 	CreateTicket(ticket *Ticket, row RecommendationQueryResult) (string, error)
-	UpdateTicket(ticket *Ticket, row RecommendationQueryResult) error
+	// UpdateTicket posts the message for a lifecycle event to the ticket.
+	// row is empty for events that don't come from a recommendation, such as snoozing.
+	UpdateTicket(ticket *Ticket, row RecommendationQueryResult, event string) error
 	CloseTicket(issueKey string) error
 	GetTicket(issueKey string) (Ticket, error)
 	HandleWebhookAction(echo.Context) error
 }
 
-func InitTicketService(implName string) (BaseTicketService, error) {
+// TicketFinder is optional. Plugins that implement it let the service reconcile
+// reservations that were left Pending when the process died during CreateTicket.
+// FindTicket returns the IssueKey of the ticket the backend holds for the
+// ticket and row, or an empty string if it never created one.
+type TicketFinder interface {
+	FindTicket(ticket *Ticket, row RecommendationQueryResult) (string, error)
+}
+
+// ConfigurableTicketService is optional. Plugins that implement it get the
+// backend settings from the config file before Init is called. Plugins should
+// fall back to environment variables for anything that isn't set.
+type ConfigurableTicketService interface {
+	Configure(settings map[string]string)
+}
+
+// ReloadableTicketService is optional. Plugins that implement it pick up new
+// settings and re-read their templates when the service is reloaded. If Reload
+// returns an error the plugin must keep running with what it had before.
+type ReloadableTicketService interface {
+	Reload(settings map[string]string) error
+}
+
+// ReopenableTicketService is optional. Plugins that implement it undo
+// whatever CloseTicket did, I.E. unarchive a channel.
+type ReopenableTicketService interface {
+	ReopenTicket(issueKey string) error
+}
+
+// IdentityResolver is optional. Plugins that implement it turn the
+// TicketSystemIdentifiers of the routing table, such as emails, into their
+// own identifiers. Anything they can't resolve is returned as unresolved.
+type IdentityResolver interface {
+	ResolveIdentities(identifiers []string) (resolved []string, unresolved []string)
+}
+
+func InitTicketService(implName string, settings map[string]string) (BaseTicketService, error) {
 
 	// Load the plugin based on the name
 	pluginPath := "./plugins/" + implName + ".so"
@@ -54,6 +135,10 @@ func InitTicketService(implName string) (BaseTicketService, error) {
 	// Create an instance of the ticket service implementation
 	implValue := newTicketServiceSymbol.(func() BaseTicketService)()
 
+	if configurable, ok := implValue.(ConfigurableTicketService); ok {
+		configurable.Configure(settings)
+	}
+
 	// Initialize the ticket service implementation
 	if err := implValue.Init(); err != nil {
 		return nil, err
@@ -64,10 +149,17 @@ func InitTicketService(implName string) (BaseTicketService, error) {
 
 // %[1] is the recommender export table
 // %[2] is the ticket table
-// %[3] is the Cost Threshold
-// %[4] is an additional string added to allow null values
-// %[5] is a subtype filter
+// %[3] is the policy cost filter, a condition checking each row against its policy
+// %[4] is the policy per run cap, an expression giving the cap of each row's policy
+// %[5] is a subtype filter, either empty or a full AND clause
 // %[6] is the limit of rows
+// %[7] is the reservation table
+// %[8] is the policy key, an expression naming each row's policy
+// %[9] is the suppression filter, a full AND clause leaving out suppressed rows
+// %[10] is the policy snooze days, an expression giving the snooze days of each row's policy
+// %[11] is either empty or a full AND clause keeping only rows with a ticket
+// A closed ticket is picked up again when its recommendation is still there
+// the snooze days after it was closed, see dueForUpdate.
 // The Format timestamp works here, but doesn't work in ticketTableFunctions? 
 // If it stops working here try changing to '%%Y-%%m-%%d %%H:%%M:%%S'
 var CheckQueryTpl = `SELECT
@@ -91,16 +183,30 @@ var CheckQueryTpl = `SELECT
     FORMAT_TIMESTAMP('%%FT%%T%%z', IFNULL(t.LastPingDate, TIMESTAMP '1970-01-01T00:00:00Z')) AS LastPingDate,
     FORMAT_TIMESTAMP('%%FT%%T%%z', IFNULL(t.SnoozeDate, TIMESTAMP '1970-01-01T00:00:00Z')) AS SnoozeDate,
     IFNULL(t.Subject, "") AS Subject,
-    t.Assignee
+    t.Assignee,
+    IFNULL(t.Locale, "") AS Locale,
+    IFNULL(t.Reason, "") AS Reason,
+    IFNULL(t.Comment, "") AS Comment
   ) AS Ticket
 FROM %[1]s AS f
 CROSS JOIN UNNEST(target_resources) AS TargetResource
 LEFT JOIN (
 	SELECT *,
-		   ROW_NUMBER() OVER (PARTITION BY IssueKey ORDER BY LastUpdateDate DESC) as rn
+		   ROW_NUMBER() OVER (PARTITION BY TargetResource, RecommenderID ORDER BY LastUpdateDate DESC) as rn
 	FROM %[2]s
-  ) AS t ON TargetResource = t.TargetResource AND t.rn = 1
+  ) AS t ON TargetResource = t.TargetResource AND f.recommender_name = t.RecommenderID AND t.rn = 1
+LEFT JOIN (
+	SELECT TargetResource, RecommenderID, State,
+		   ROW_NUMBER() OVER (PARTITION BY TargetResource, RecommenderID ORDER BY LastUpdateDate DESC,
+		     CASE State WHEN "Pending" THEN 0 WHEN "Created" THEN 1 ELSE 2 END DESC) as rn
+	FROM %[7]s
+  ) AS r ON TargetResource = r.TargetResource AND f.recommender_name = r.RecommenderID AND r.rn = 1
 WHERE (t.IssueKey IS NULL OR CURRENT_TIMESTAMP() >= SnoozeDate)
-  AND (impact_cost_unit >= %[3]d %[4]s)
-  AND recommender_subtype NOT IN (%[5]s)
+  AND (IFNULL(t.Status, "") NOT IN ("Closed", "Dismissed") OR CURRENT_TIMESTAMP() >= TIMESTAMP_ADD(t.LastUpdateDate, INTERVAL %[10]s DAY))
+  AND (r.State IS NULL OR r.State NOT IN ("Pending", "Created"))
+  AND %[3]s
+  %[5]s
+  %[9]s
+  %[11]s
+QUALIFY ROW_NUMBER() OVER (PARTITION BY %[8]s ORDER BY f.impact_cost_unit DESC) <= %[4]s
 LIMIT %[6]d`
\ No newline at end of file
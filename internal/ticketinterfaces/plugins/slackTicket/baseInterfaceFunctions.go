@@ -15,10 +15,12 @@
 package main
 
 import (
-	"bytes"
-	"strings"
+	"strconv"
+	"time"
 
-	b "ticketservice/internal/bigqueryfunctions"
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/templates"
 	t "ticketservice/internal/ticketinterfaces"
 )
 
@@ -33,42 +35,102 @@ func (s *SlackTicketService) CreateTicket(ticket *t.Ticket, row t.Recommendation
 	}
 }
 
-func (s *SlackTicketService) UpdateTicket(ticket *t.Ticket, row t.RecommendationQueryResult) error {
-	// Prepare a buffer to hold the executed template
-    var tpl bytes.Buffer
-
-    // Execute the stored template with the row and ticket data
-    err := s.updateTemplate.Execute(&tpl, map[string]interface{}{"Row": row, "Ticket": ticket})
-    if err != nil {
-        return err
-    }
-	message := tpl.String()
+func (s *SlackTicketService) UpdateTicket(ticket *t.Ticket, row t.RecommendationQueryResult, event string) error {
+	// Render the event template picked for this recommendation
+	message, err := templates.Render(event, row, ticket)
+	if err != nil {
+		return err
+	}
 
-	if !s.channelAsTicket {
-		// This will return an array. [0] will be channel id [1] will be timestamp
-		channelTimestamp := strings.Split(ticket.IssueKey, "-")
-		return s.sendSlackMessage(channelTimestamp[0], channelTimestamp[1], message)
+	channel, timestamp := s.splitIssueKey(ticket.IssueKey)
+	if richEvents[event] {
+		return s.sendSlackBlocks(channel, timestamp, message, ticketBlocks(ticket, row, message))
 	}
-	return s.sendSlackMessage(ticket.IssueKey, "", message)
+	return s.sendSlackMessage(channel, timestamp, message)
 }
 
-// CloseTicket is a function that closes an existing channel in Slack based on the given IssueKey.
+// CloseTicket closes the ticket in Slack. A channel ticket's channel is
+// archived, a thread ticket gets a closing note and a reaction on its parent
+// message, archiving would close the channel it shares with other tickets.
 func (s *SlackTicketService) CloseTicket(key string) error {
-	// Use the ArchiveConversation method provided by the Slack API to close the channel with the given IssueKey.
-	err := s.slackClient.ArchiveConversation(key)
-	if err != nil {
-		// If there's an error while closing the channel, return the error.
-		return err
+	if !s.channelAsTicket {
+		if err := s.closingNote(key); err != nil {
+			return err
+		}
 	}
-	// If the channel was successfully closed, return nil.
-	return nil
+	return s.closeConversation(key)
 }
 
 func (s *SlackTicketService) GetTicket(issueKey string) (t.Ticket, error) {
 	// Slack tickets are super simple, so let's pull from BQ
-	ticket, err := b.GetTicketByIssueKey(issueKey)
+	ticket, err := s.store.GetTicket(issueKey)
 	if err != nil {
-		// Handle the error
+		return t.Ticket{}, err
 	}
 	return *ticket, nil
+}
+
+// FindTicket looks for a ticket that was created for the ticket and row but
+// never written to BigQuery. Channels are found by name, threads by
+// searching the channel history for the initial message, whose metadata
+// names the recommendation it was posted for.
+func (s *SlackTicketService) FindTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+	var channelName string
+	var err error
+	if s.channelAsTicket {
+		channelName, err = s.channelTicketName(ticket, row)
+	} else {
+		channelName, err = s.threadTicketChannel(ticket, row)
+	}
+	if err != nil {
+		return "", err
+	}
+	var channelID string
+	if !s.channelAsTicket && channelIDRegex.MatchString(channelName) {
+		// An existing shared channel, there's nothing to look up
+		channelID = channelName
+	} else {
+		// The channel may have been created by the run that died, so a
+		// name we don't know lists the channels again.
+		channel, err := s.findChannel(channelName, channelListInterval, row)
+		if err != nil {
+			return "", err
+		}
+		if channel == nil {
+			return "", nil
+		}
+		channelID = channel.ID
+	}
+	if s.channelAsTicket {
+		return channelID, nil
+	}
+	oldest := "0"
+	if created, err := time.Parse(time.RFC3339, ticket.CreationDate); err == nil {
+		oldest = strconv.FormatInt(created.Unix(), 10)
+	}
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID:          channelID,
+		Oldest:             oldest,
+		Limit:              200,
+		IncludeAllMetadata: true,
+	}
+	for {
+		var history *slack.GetConversationHistoryResponse
+		err := s.callSlack("conversations.history", func() (err error) {
+			history, err = s.slackClient.GetConversationHistory(params)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		for _, message := range history.Messages {
+			if isTicketMessage(message, row) {
+				return channelID + "-" + message.Timestamp, nil
+			}
+		}
+		if !history.HasMore || history.ResponseMetaData.NextCursor == "" {
+			return "", nil
+		}
+		params.Cursor = history.ResponseMetaData.NextCursor
+	}
 }
\ No newline at end of file
@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/locale"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// Action IDs of the ticket buttons. Slack posts clicks to the app's
+// Interactivity Request URL, which should be /webhooks like the events.
+const (
+	ticketActionsBlockID = "ticket_actions"
+	actionSnooze7d       = "snooze_7d"
+	actionSnooze30d      = "snooze_30d"
+	actionSnoozeCustom   = "snooze_custom"
+	actionComplete       = "complete"
+	actionDismiss        = "dismiss"
+)
+
+// Slack rejects blocks with longer text
+const (
+	maxHeaderLength  = 150
+	maxSectionLength = 3000
+)
+
+// richEvents are posted as Block Kit messages, other events stay plain text
+var richEvents = map[string]bool{
+	t.EventCreated:  true,
+	t.EventReminder: true,
+}
+
+func plainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
+
+func markdown(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+// ticketBlocks lays out a ticket message: a header, the savings and resource
+// fields, the rendered template as the description and the action buttons.
+// Every button carries the IssueKey so the click can find the ticket.
+func ticketBlocks(ticket *t.Ticket, row t.RecommendationQueryResult, message string) []slack.Block {
+	loc := templates.TicketLocale(ticket)
+	header := ticket.Subject
+	if header == "" {
+		header = row.RecommenderSubtype
+	}
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(plainText(templates.Truncate(maxHeaderLength, header))),
+	}
+
+	var fields []*slack.TextBlockObject
+	if row.ImpactCostUnit != 0 {
+		fields = append(fields, markdown(fmt.Sprintf("*%s*\n%s",
+			locale.Sprintf(loc, "Savings"),
+			locale.Currency(loc, float64(row.ImpactCostUnit), row.ImpactCurrencyCode))))
+	}
+	if row.TargetResource != "" {
+		fields = append(fields, markdown(fmt.Sprintf("*%s*\n<%s|%s>",
+			locale.Sprintf(loc, "Resource"),
+			templates.ConsoleURL(row.TargetResource),
+			templates.ShortResource(row.TargetResource))))
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+	}
+
+	blocks = append(blocks,
+		slack.NewSectionBlock(markdown(templates.Truncate(maxSectionLength, message)), nil, nil),
+		slack.NewActionBlock(ticketActionsBlockID,
+			slack.NewButtonBlockElement(actionSnooze7d, ticket.IssueKey, plainText(locale.Sprintf(loc, "Snooze 7d"))),
+			slack.NewButtonBlockElement(actionSnooze30d, ticket.IssueKey, plainText(locale.Sprintf(loc, "Snooze 30d"))),
+			slack.NewButtonBlockElement(actionSnoozeCustom, ticket.IssueKey, plainText(locale.Sprintf(loc, "Snooze..."))),
+			slack.NewButtonBlockElement(actionComplete, ticket.IssueKey, plainText(locale.Sprintf(loc, "Mark complete"))).
+				WithStyle(slack.StylePrimary),
+			slack.NewButtonBlockElement(actionDismiss, ticket.IssueKey, plainText(locale.Sprintf(loc, "Dismiss"))).
+				WithStyle(slack.StyleDanger),
+		),
+	)
+	return blocks
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// How long a cached channel is trusted before it's checked with
+// conversations.info, and how old the full listing can get before a
+// channel that isn't cached makes us list again.
+const defaultChannelCacheTTL = 10 * time.Minute
+
+// When creating a channel finds its name taken, the listing is redone if
+// it's older than this. Anything newer would only tell us the same thing.
+const channelListInterval = time.Minute
+
+// A channel ticket whose name is taken by a channel we can't use, I.E. an
+// archived one or another ticket's, gets the next of name-2, name-3... up to this.
+const maxChannelNameSuffix = 20
+
+// channelEntry is a channel and when Slack last told us about it
+type channelEntry struct {
+	channel slack.Channel
+	checked time.Time
+}
+
+// channelCache maps channel names to the channels the bot can post in.
+// It's filled by listing every conversation at startup, after that single
+// channels are added as they're created and checked by ID as they age.
+type channelCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]channelEntry
+	listed  time.Time
+	// Names taken by channels we can't use, and when we found out
+	unusable map[string]time.Time
+	// Only one listing at a time, the others wait and use it
+	listing sync.Mutex
+	// Only one create at a time, so two tickets for the same name can't
+	// both create it. The second finds the first's channel in the cache.
+	creating sync.Mutex
+}
+
+func newChannelCache(ttl time.Duration) *channelCache {
+	return &channelCache{ttl: ttl, entries: make(map[string]channelEntry), unusable: make(map[string]time.Time)}
+}
+
+func (c *channelCache) markUnusable(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.unusable[name] = time.Now()
+}
+
+// isUnusable tells if a name was found taken within the TTL, so creates
+// can skip it without asking Slack again.
+func (c *channelCache) isUnusable(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	found, ok := c.unusable[name]
+	if ok && time.Since(found) >= c.ttl {
+		delete(c.unusable, name)
+		return false
+	}
+	return ok
+}
+
+func (c *channelCache) get(name string) (channelEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[name]
+	return entry, ok
+}
+
+func (c *channelCache) put(channel slack.Channel) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[channel.Name] = channelEntry{channel: channel, checked: time.Now()}
+}
+
+// remove drops a channel by ID, whatever name it's cached under
+func (c *channelCache) remove(channelID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name, entry := range c.entries {
+		if entry.channel.ID == channelID {
+			delete(c.entries, name)
+		}
+	}
+}
+
+func (c *channelCache) listedWithin(age time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return time.Since(c.listed) < age
+}
+
+// listChannels replaces the cache with every channel the bot can see, unless
+// someone else listed them within maxAge.
+func (s *SlackTicketService) listChannels(maxAge time.Duration) error {
+	s.channels.listing.Lock()
+	defer s.channels.listing.Unlock()
+	if s.channels.listedWithin(maxAge) {
+		return nil
+	}
+	now := time.Now()
+	entries := make(map[string]channelEntry)
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Types:           cachedConversationTypes,
+		Limit:           500,
+	}
+	for {
+		var channels []slack.Channel
+		var nextCursor string
+		err := s.callSlack("conversations.list", func() (err error) {
+			channels, nextCursor, err = s.slackClient.GetConversations(params)
+			return err
+		})
+		if err != nil {
+			// Keep what we had, it's better than nothing
+			return err
+		}
+		for _, channel := range channels {
+			entries[channel.Name] = channelEntry{channel: channel, checked: now}
+		}
+		if nextCursor == "" {
+			break
+		}
+		params.Cursor = nextCursor
+	}
+	s.channels.mutex.Lock()
+	s.channels.entries = entries
+	s.channels.listed = now
+	s.channels.mutex.Unlock()
+	u.LogPrint(1, "[SLACK] Cached %d channels", len(entries))
+	return nil
+}
+
+// cachedChannel returns the channel cached under name. One that hasn't been
+// checked within the TTL is looked up by ID first, and dropped if it has
+// been archived or renamed since.
+func (s *SlackTicketService) cachedChannel(name string) (*slack.Channel, bool, error) {
+	entry, ok := s.channels.get(name)
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Since(entry.checked) < s.channels.ttl {
+		return &entry.channel, true, nil
+	}
+	var channel *slack.Channel
+	err := s.callSlack("conversations.info", func() (err error) {
+		channel, err = s.slackClient.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: entry.channel.ID})
+		return err
+	})
+	if err != nil {
+		if err.Error() == "channel_not_found" {
+			s.channels.remove(entry.channel.ID)
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	s.channels.remove(entry.channel.ID)
+	if channel.IsArchived {
+		return nil, false, nil
+	}
+	s.channels.put(*channel)
+	if channel.Name != name {
+		return nil, false, nil
+	}
+	return channel, true, nil
+}
+
+// lookupChannel finds a channel by name. A name that isn't cached lists the
+// channels again if the listing is older than maxAge.
+func (s *SlackTicketService) lookupChannel(name string, maxAge time.Duration) (*slack.Channel, error) {
+	channel, ok, err := s.cachedChannel(name)
+	if err != nil || ok {
+		return channel, err
+	}
+	if err := s.listChannels(maxAge); err != nil {
+		return nil, err
+	}
+	channel, _, err = s.cachedChannel(name)
+	return channel, err
+}
+
+// findChannel finds the channel createNewChannel made for a name, trying the
+// names in the order it does. A channel ticket whose name was taken lives
+// under a suffix, the first of these that is row's own is the one it would reuse.
+func (s *SlackTicketService) findChannel(channelName string, maxAge time.Duration, row t.RecommendationQueryResult) (*slack.Channel, error) {
+	channelName = sanitizeChannelName(channelName)
+	attempts := 1
+	if s.channelAsTicket {
+		attempts = maxChannelNameSuffix
+	}
+	for n := 1; n <= attempts; n++ {
+		// Only the first miss lists again, the rest use that listing
+		channel, err := s.lookupChannel(channelNameWithSuffix(channelName, n), maxAge)
+		if err != nil {
+			return nil, err
+		}
+		if channel != nil && (!s.channelAsTicket || ownsChannel(channel, &row)) {
+			return channel, nil
+		}
+	}
+	return nil, nil
+}
+
+// ownsChannel tells if a channel was created for the ticket of owner, by
+// the purpose createNewChannel set on it. Any channel will do without an owner.
+func ownsChannel(channel *slack.Channel, owner *t.RecommendationQueryResult) bool {
+	return owner == nil || channel.Purpose.Value == ticketChannelPurpose(*owner)
+}
+
+// channelNameWithSuffix returns the nth name to try for a channel, the name
+// itself and then name-2, name-3... cut to fit Slack's limit.
+func channelNameWithSuffix(name string, n int) string {
+	if n < 2 {
+		return truncateChannelName(name)
+	}
+	suffix := "-" + strconv.Itoa(n)
+	if len(name) > maxChannelNameLength-len(suffix) {
+		name = name[:maxChannelNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// createNewChannel returns the channel with this name, creating it if it
+// doesn't exist. Private only matters when it is created.
+//
+// A channel ticket passes the row it's for as owner. Its channel is marked
+// with the row when created, and an existing one is only reused when it
+// carries that mark, so two recommendations whose names come out the same
+// never share a channel. When the name is taken by a channel the bot can't
+// use or by another ticket's, it moves on to the next suffix, so the same
+// names are always tried in the same order. A thread ticket's channel is
+// named by its route and shared, so any channel will do and a name that
+// can't be used is an error instead.
+func (s *SlackTicketService) createNewChannel(channelName string, private bool, owner *t.RecommendationQueryResult) (*slack.Channel, error) {
+	channelName = sanitizeChannelName(channelName)
+	s.channels.creating.Lock()
+	defer s.channels.creating.Unlock()
+	attempts := 1
+	if owner != nil {
+		attempts = maxChannelNameSuffix
+	}
+	for n := 1; n <= attempts; n++ {
+		name := channelNameWithSuffix(channelName, n)
+		if s.channels.isUnusable(name) {
+			continue
+		}
+		channel, err := s.lookupChannel(name, s.channels.ttl)
+		if err != nil {
+			return nil, err
+		}
+		if channel != nil {
+			if ownsChannel(channel, owner) {
+				return channel, nil
+			}
+			u.LogPrint(1, "[SLACK] Channel %s belongs to another ticket", name)
+			continue
+		}
+		err = s.callSlack("conversations.create", func() (err error) {
+			channel, err = s.slackClient.CreateConversation(slack.CreateConversationParams{
+				ChannelName: name,
+				IsPrivate:   private,
+			})
+			return err
+		})
+		if err == nil {
+			if owner != nil {
+				s.markChannel(channel, *owner)
+			}
+			s.channels.put(*channel)
+			return channel, nil
+		}
+		if !strings.Contains(err.Error(), "name_taken") && !strings.Contains(err.Error(), "channel already exists") {
+			return nil, err
+		}
+		// Someone else may have just created it
+		channel, err = s.lookupChannel(name, channelListInterval)
+		if err != nil {
+			return nil, err
+		}
+		if channel != nil {
+			if ownsChannel(channel, owner) {
+				return channel, nil
+			}
+			u.LogPrint(1, "[SLACK] Channel %s belongs to another ticket", name)
+			continue
+		}
+		u.LogPrint(1, "[SLACK] Channel name %s is taken by a channel we can't use", name)
+		s.channels.markUnusable(name)
+	}
+	return nil, fmt.Errorf("channel name %s is taken by a channel we can't use, I.E. an archived one or another ticket's", channelName)
+}
+
+// markChannel sets the purpose that makes a new channel owner's. If that
+// fails the ticket still gets the channel, a later create just won't reuse it.
+func (s *SlackTicketService) markChannel(channel *slack.Channel, owner t.RecommendationQueryResult) {
+	purpose := ticketChannelPurpose(owner)
+	err := s.callSlack("conversations.setPurpose", func() error {
+		_, err := s.slackClient.SetPurposeOfConversation(channel.ID, purpose)
+		return err
+	})
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to set the purpose of channel %s: %v", channel.Name, err)
+		return
+	}
+	channel.Purpose.Value = purpose
+}
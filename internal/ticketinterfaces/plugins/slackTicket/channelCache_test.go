@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+func TestCreateNewChannelOnlyReusesItsOwn(test *testing.T) {
+	vm1 := t.RecommendationQueryResult{RecommenderSubtype: "CHANGE_MACHINE_TYPE", TargetResource: "//compute.googleapis.com/projects/p/zones/z/instances/vm-1"}
+	vm2 := t.RecommendationQueryResult{RecommenderSubtype: "CHANGE_MACHINE_TYPE", TargetResource: "//compute.googleapis.com/projects/p/zones/z/instances/vm-2"}
+	// vm-1's channel already holds the name both come out as
+	existing := slack.Channel{}
+	existing.ID = "CVM1"
+	existing.Name = "resize-vm"
+	existing.Purpose.Value = ticketChannelPurpose(vm1)
+	slackFake := &fakeSlack{channels: []slack.Channel{existing}}
+	s := &SlackTicketService{slackClient: slackFake, channelAsTicket: true}
+	s.limiter = s.newSlackLimiter()
+	s.channels = newChannelCache(defaultChannelCacheTTL)
+
+	channel, err := s.createNewChannel("resize-vm", false, &vm1)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if channel.ID != "CVM1" {
+		test.Errorf("vm-1 got channel %s, want its own CVM1", channel.ID)
+	}
+
+	channel, err = s.createNewChannel("resize-vm", false, &vm2)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if channel.ID != "CNEW" || channel.Name != "resize-vm-2" {
+		test.Errorf("vm-2 got channel %s named %s, want a new resize-vm-2", channel.ID, channel.Name)
+	}
+	if len(slackFake.purposes) != 1 || slackFake.purposes[0] != ticketChannelPurpose(vm2) {
+		test.Errorf("purposes set %q, want vm-2's", slackFake.purposes)
+	}
+	// Once created it's vm-2's, and how FindTicket finds it
+	if channel, err := s.findChannel("resize-vm", channelListInterval, vm2); err != nil || channel == nil || channel.Name != "resize-vm-2" {
+		test.Errorf("found %v, %v for vm-2, want resize-vm-2", channel, err)
+	}
+
+	// A thread ticket's channel is shared, any will do
+	s.channelAsTicket = false
+	channel, err = s.createNewChannel("resize-vm", false, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if channel.ID != "CVM1" {
+		test.Errorf("thread ticket got channel %s, want the existing CVM1", channel.ID)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"google.golang.org/api/cloudidentity/v1"
+	"google.golang.org/api/option"
+
+	u "ticketservice/internal/utils"
+)
+
+// People rarely change email, a day old directory is fine
+const defaultDirectoryTTL = 24 * time.Hour
+
+// directoryEntry is what an email resolved to, no users if it didn't
+type directoryEntry struct {
+	users   []string
+	expires time.Time
+}
+
+// slackDirectory caches the Slack users behind emails and Google groups,
+// so routing rows and admins can name people the way the platform team knows them.
+type slackDirectory struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]directoryEntry
+	// Expand Google groups with Cloud Identity, created on the first group
+	resolveGroups bool
+	groups        *cloudidentity.Service
+}
+
+func newSlackDirectory(ttl time.Duration, resolveGroups bool) *slackDirectory {
+	return &slackDirectory{ttl: ttl, entries: make(map[string]directoryEntry), resolveGroups: resolveGroups}
+}
+
+func (d *slackDirectory) cached(email string) ([]string, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	entry, ok := d.entries[email]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.users, true
+}
+
+func (d *slackDirectory) store(email string, users []string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.entries[email] = directoryEntry{users: users, expires: time.Now().Add(d.ttl)}
+}
+
+// ResolveIdentities turns emails and Google group addresses into Slack user
+// IDs. Slack IDs are kept as they are, anything else is unresolved.
+func (s *SlackTicketService) ResolveIdentities(identifiers []string) ([]string, []string) {
+	var resolved, unresolved []string
+	seen := make(map[string]bool)
+	for _, identifier := range identifiers {
+		var users []string
+		switch {
+		case userIDRegex.MatchString(identifier):
+			users = []string{identifier}
+		case strings.Contains(identifier, "@"):
+			users = s.lookupEmail(strings.ToLower(identifier))
+		}
+		if len(users) == 0 {
+			unresolved = append(unresolved, identifier)
+			continue
+		}
+		for _, user := range users {
+			if !seen[user] {
+				seen[user] = true
+				resolved = append(resolved, user)
+			}
+		}
+	}
+	return resolved, unresolved
+}
+
+// lookupEmail finds the Slack user with an email, or the members of the
+// Google group with that address. Failures other than not found aren't
+// cached, so they're tried again next time.
+func (s *SlackTicketService) lookupEmail(email string) []string {
+	if users, ok := s.directory.cached(email); ok {
+		return users
+	}
+	user, err := s.lookupSlackUser(email)
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to look up %s: %v", email, err)
+		return nil
+	}
+	var users []string
+	if user != "" {
+		users = []string{user}
+	} else if s.directory.resolveGroups {
+		users, err = s.lookupGroup(email)
+		if err != nil {
+			u.LogPrint(3, "[SLACK] Failed to look up group %s: %v", email, err)
+			return nil
+		}
+	}
+	s.directory.store(email, users)
+	return users
+}
+
+// lookupSlackUser returns the ID of the Slack user with an email, empty if there is none
+func (s *SlackTicketService) lookupSlackUser(email string) (string, error) {
+	var user *slack.User
+	err := s.callSlack("users.lookupByEmail", func() error {
+		var err error
+		user, err = s.slackClient.GetUserByEmail(email)
+		return err
+	})
+	if err != nil {
+		if err.Error() == "users_not_found" {
+			return "", nil
+		}
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// lookupGroup returns the Slack users among the members of a Google group,
+// nested groups included. Members without a Slack account are skipped.
+func (s *SlackTicketService) lookupGroup(email string) ([]string, error) {
+	groups, err := s.directory.groupService()
+	if err != nil {
+		return nil, err
+	}
+	group, err := groups.Groups.Lookup().GroupKeyId(email).Do()
+	if err != nil {
+		// Not a group either, so it's nobody we know
+		u.LogPrint(1, "%s is neither a Slack user nor a Google group: %v", email, err)
+		return nil, nil
+	}
+	var users []string
+	err = groups.Groups.Memberships.SearchTransitiveMemberships(group.Name).Pages(context.Background(),
+		func(page *cloudidentity.SearchTransitiveMembershipsResponse) error {
+			for _, member := range page.Memberships {
+				for _, key := range member.PreferredMemberKey {
+					user, err := s.lookupSlackUser(strings.ToLower(key.Id))
+					if err != nil {
+						return err
+					}
+					if user != "" {
+						users = append(users, user)
+					}
+				}
+			}
+			return nil
+		})
+	return users, err
+}
+
+func (d *slackDirectory) groupService() (*cloudidentity.Service, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.groups != nil {
+		return d.groups, nil
+	}
+	groups, err := cloudidentity.NewService(context.Background(), option.WithScopes(cloudidentity.CloudIdentityGroupsReadonlyScope))
+	if err != nil {
+		return nil, err
+	}
+	d.groups = groups
+	return groups, nil
+}
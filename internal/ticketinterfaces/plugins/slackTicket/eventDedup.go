@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+
+	u "ticketservice/internal/utils"
+)
+
+// Slack retries an event up to three times over about half an hour
+const defaultEventDedupTTL = time.Hour
+
+// eventDedup remembers the IDs of events already taken for ttl, so a retried
+// delivery isn't processed twice. With a file set the IDs survive restarts,
+// which matters when a retry lands on a freshly started instance.
+type eventDedup struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	file  string
+	seen  map[string]time.Time
+}
+
+func newEventDedup(ttl time.Duration, file string) *eventDedup {
+	d := &eventDedup{ttl: ttl, file: file, seen: make(map[string]time.Time)}
+	if file == "" {
+		return d
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			u.LogPrint(3, "[SLACK] Failed to read event dedup file %s: %v", file, err)
+		}
+		return d
+	}
+	if err := json.Unmarshal(data, &d.seen); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to parse event dedup file %s: %v", file, err)
+	}
+	return d
+}
+
+// firstDelivery records an event ID, returning false if it was already recorded
+func (d *eventDedup) firstDelivery(eventID string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	now := time.Now()
+	for id, expires := range d.seen {
+		if now.After(expires) {
+			delete(d.seen, id)
+		}
+	}
+	if _, ok := d.seen[eventID]; ok {
+		return false
+	}
+	d.seen[eventID] = now.Add(d.ttl)
+	d.persist()
+	return true
+}
+
+// forget drops an event ID recorded by firstDelivery, for an event that
+// couldn't be queued after all so Slack's retry of it is taken
+func (d *eventDedup) forget(eventID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.seen[eventID]; !ok {
+		return
+	}
+	delete(d.seen, eventID)
+	d.persist()
+}
+
+// persist saves the IDs when there's a file, the caller holds the mutex
+func (d *eventDedup) persist() {
+	if d.file == "" {
+		return
+	}
+	if err := d.save(); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to write event dedup file %s: %v", d.file, err)
+	}
+}
+
+// save writes the IDs elsewhere and renames, so a crash can't leave half a file
+func (d *eventDedup) save() error {
+	data, err := json.Marshal(d.seen)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.file), 0755); err != nil {
+		return err
+	}
+	tmp := d.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.file)
+}
+
+// isOwnMessage is true for messages the bot posted itself, replying to them could loop
+func (s *SlackTicketService) isOwnMessage(message *slackevents.MessageEvent) bool {
+	if s.botID != "" && message.BotID == s.botID {
+		return true
+	}
+	return s.botUserID != "" && message.User == s.botUserID
+}
+
+// skipEvent decides whether an Events API callback is worth queueing. Retries
+// of an event already taken are dropped, as are the bot's own messages.
+// An event that isn't skipped is recorded as taken, the caller has to
+// forgetEvent the returned ID if it can't be queued.
+func (s *SlackTicketService) skipEvent(body []byte, retryNum, retryReason string) (bool, string, error) {
+	var event slackevents.EventsAPICallbackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return false, "", err
+	}
+	if event.InnerEvent != nil {
+		var message slackevents.MessageEvent
+		if err := json.Unmarshal(*event.InnerEvent, &message); err == nil && message.Type == string(slackevents.Message) && s.isOwnMessage(&message) {
+			u.LogPrint(1, "Ignoring our own message in event %s", event.EventID)
+			return true, "", nil
+		}
+	}
+	if event.EventID == "" || s.eventDedup == nil {
+		return false, "", nil
+	}
+	if !s.eventDedup.firstDelivery(event.EventID) {
+		u.LogPrint(2, "Ignoring event %s, already handled (retry %s, %s)", event.EventID, retryNum, retryReason)
+		return true, "", nil
+	}
+	if retryNum != "" {
+		u.LogPrint(2, "Processing retry %s of event %s we hadn't seen (%s)", retryNum, event.EventID, retryReason)
+	}
+	return false, event.EventID, nil
+}
+
+// forgetEvent undoes skipEvent recording an event that then couldn't be
+// queued, so Slack's retry isn't dropped as a duplicate
+func (s *SlackTicketService) forgetEvent(eventID string) {
+	if eventID == "" || s.eventDedup == nil {
+		return
+	}
+	s.eventDedup.forget(eventID)
+}
@@ -15,62 +15,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/slack-go/slack/slackevents"
 
+	"ticketservice/internal/queue"
 	u "ticketservice/internal/utils"
 )
 
-func sendFastResponseAndProcess(body []byte, c echo.Context) error {
-	// Get the URL from the request
-	url := fmt.Sprintf("https://%s%s", c.Request().Host, c.Request().URL.Path)
-	fmt.Printf("Resend to: %s\n", url)
-
-	// Create a new request with the received URL
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-
-	// Forward the request with an additional header
-	req.Header.Set("X-PROCESS-SLACK", "true")
-
-	// Add the X-Slack-Signature header
-	signature := c.Request().Header.Get("X-Slack-Signature")
-	timestamp := c.Request().Header.Get("X-Slack-Request-Timestamp")
-	req.Header.Set("X-Slack-Signature", signature)
-	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
-
-	// Create a custom RoundTripper to ignore the response body
-	transport := &http.Transport{
-		DisableKeepAlives: true,
-	}
-	client := &http.Client{Transport: transport}
-	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
-	}
-
-	go func() {
-	// Perform the request, waiting for the request to finish sending
-		_, err = client.Do(req)
-		if err != nil {
-			fmt.Println("Error:", err)
-		}
-	}()
-	// Small Delay to ensure the request is completely sent.
-	time.Sleep(time.Second)
-	c.NoContent(http.StatusAccepted)
-	return nil
-}
+// webhookJobKind is the queue job a verified webhook body is processed in
+const webhookJobKind = "slack.webhook"
 
 func (s *SlackTicketService) HandleWebhookAction(c echo.Context) error {
 	// So the problem with Slack is that they expect a response within 3 seconds
@@ -78,20 +40,17 @@ func (s *SlackTicketService) HandleWebhookAction(c echo.Context) error {
 	// So we actually need to send a response quickly and process in the background.
 	// BQ as our main datasource means it's impossible to respond within 3 seconds.
 
-	// We MUST respond within 3 seconds or a retry happens, however we could solve
-	// The retry issue with some form of caching, however that doesn't completely solve
-	// the problem, because Slack will disable events if the majority of events are over 3s
-
-	// Here is where it get's interesting, we want to support serverless deployment
-	// Serverless services generally shut down processing once a response has been sent.
-	// There are many ways to solve this problem, but in most cases it uses another outside service
-	// Ideally this should be able to run on any platform, regardless of deployment.
+	// We MUST respond within 3 seconds or a retry happens, and Slack will disable
+	// events if the majority of events are over 3s.
 
-	// I'm including it only in the Slack Plugin, because this may not be a problem for other plugins
-	// Happy to move it if we need.
+	// So once the request is verified it goes on the work queue and we answer
+	// straight away. With a persistent queue backend the job survives the
+	// instance being shut down or restarted, and a failed job is retried.
 
-	// So to get around this, and NOT use other services (PubSub, Cloud Tasks) we will call
-	// the Webhook again, but with a header that allows the service to actually process.
+	// In Socket Mode everything comes over the websocket, and there may be no signing secret to verify with
+	if s.socketMode {
+		return fmt.Errorf("Webhooks are disabled in Socket Mode")
+	}
 
 	//Verifying the request is ALWAYS first. 
 	defer c.Request().Body.Close()
@@ -103,74 +62,122 @@ func (s *SlackTicketService) HandleWebhookAction(c echo.Context) error {
 		return fmt.Errorf("Failed to Verify Request Signature")
 	}
 
-	    // Parse the event payload
-    u.LogPrint(1, "Body: %v", string(body))
-    var event slackevents.EventsAPICallbackEvent
-    err = json.Unmarshal(body, &event)
-    if err != nil {
-        return err
-    }
-    switch event.Type {
-    case slackevents.URLVerification:
-        var r *slackevents.ChallengeResponse
-        err := json.Unmarshal(body, &r)
-        if err != nil {
-            return err
-        }
-        return c.JSON(http.StatusOK, r)
-
-    case slackevents.CallbackEvent:
-		// Check if the X-PROCESS-SLACK header is set to true
-		processSlack := c.Request().Header.Get("X-PROCESS-SLACK") == "true"
-		if !processSlack {
-			u.LogPrint(1, "Recieved first webhook, will process in background")
-			sendFastResponseAndProcess(body, c)
-			return c.NoContent(http.StatusOK)
+	// Buttons, modals and slash commands arrive form encoded instead of as Events API JSON
+	var eventID string
+	if !isInteractionPayload(body) && !isSlashCommand(body) {
+		var event slackevents.EventsAPICallbackEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return err
 		}
-		var eventType *slackevents.EventsAPIInnerEvent
-		err = json.Unmarshal([]byte(*event.InnerEvent), &eventType)
-		if err != nil {
-            return err
-        }
-        if slackevents.EventsAPIType(eventType.Type) == slackevents.Message {
-            // Unmarshal the inner event into a MessageEvent
-            var messageEvent *slackevents.MessageEvent
-            err = json.Unmarshal(*event.InnerEvent, &messageEvent)
-            if err != nil {
-                return err
-            }
-            // Now you have access to the message event data
-            u.LogPrint(1, "Received message event: %v", messageEvent)
-			messageSplitBySpaces := strings.Split(messageEvent.Text, " ")
-			if len(messageSplitBySpaces) < 1 {
-				u.LogPrint(1, "Message did not have any length")
-				return nil
+		switch event.Type {
+		case slackevents.URLVerification:
+			// Slack waits for the challenge, so it's answered here
+			var r *slackevents.ChallengeResponse
+			if err := json.Unmarshal(body, &r); err != nil {
+				return err
 			}
-			// Check if it's a command
-			command := strings.ToLower(messageSplitBySpaces[0])
-			if !regexp.MustCompile(`^!`).MatchString(command) {
-				u.LogPrint(1, "Not a command: %v", command)
-				return nil
+			return c.JSON(http.StatusOK, r)
+		case slackevents.CallbackEvent:
+			header := c.Request().Header
+			skip, id, err := s.skipEvent(body, header.Get("X-Slack-Retry-Num"), header.Get("X-Slack-Retry-Reason"))
+			if err != nil {
+				return err
 			}
-			// Now let's fire up the correct command
-			if function, ok := functionMap[command]; ok {
-				// Call the function with the event and arguments
-				err := function(s, messageEvent, messageSplitBySpaces)
-				if err != nil {
-					u.LogPrint(3, "Something went wrong with function: %v", command)
-				}
-				u.LogPrint(2, "Completed Function %v", command)
-			} else {
-				// Command not found
-				u.LogPrint(1, "Command %v not found", command)
-				return nil
+			if skip {
+				return c.NoContent(http.StatusOK)
 			}
-			return nil
+			eventID = id
+		default:
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Unexpected event type: %s", event.Type))
+		}
+	}
 
-        }
+	if s.openWebhookModal(body) {
+		return c.NoContent(http.StatusOK)
+	}
 
-    default:
-        return c.String(http.StatusInternalServerError, fmt.Sprintf("Unexpected event type: %s", event.Type))
-    }
-    return nil
+	job, err := queue.Enqueue(c.Request().Context(), webhookJobKind, body)
+	if err != nil {
+		// Slack retries the event after an error, let the retry through
+		s.forgetEvent(eventID)
+		return err
+	}
+	u.LogPrint(1, "Queued webhook as job %s", job.ID)
+	// Slash commands and interactions need a 200, events take any 2xx
+	return c.NoContent(http.StatusOK)
+}
+
+// openWebhookModal opens the modal a button or slash command asks for, see
+// openReasonModal, reporting whether it was one of them.
+func (s *SlackTicketService) openWebhookModal(body []byte) bool {
+	if isInteractionPayload(body) {
+		callback, err := parseInteractionPayload(body)
+		return err == nil && s.openInteractionModal(callback)
+	}
+	if isSlashCommand(body) {
+		form, err := url.ParseQuery(string(body))
+		return err == nil && s.openSlashCommandModal(slashCommandEvent(form), form.Get("trigger_id"), form.Get("text"))
+	}
+	return false
+}
+
+// processWebhook runs a verified webhook body taken off the work queue
+func (s *SlackTicketService) processWebhook(ctx context.Context, body []byte) error {
+	if isSlashCommand(body) {
+		return s.handleSlashCommand(body)
+	}
+	if isInteractionPayload(body) {
+		return s.handleInteraction(body)
+	}
+	u.LogPrint(1, "Body: %v", string(body))
+	var event slackevents.EventsAPICallbackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return err
+	}
+	var eventType *slackevents.EventsAPIInnerEvent
+	if err := json.Unmarshal([]byte(*event.InnerEvent), &eventType); err != nil {
+		return err
+	}
+	if slackevents.EventsAPIType(eventType.Type) == slackevents.Message {
+		// Unmarshal the inner event into a MessageEvent
+		var messageEvent *slackevents.MessageEvent
+		if err := json.Unmarshal(*event.InnerEvent, &messageEvent); err != nil {
+			return err
+		}
+		return s.handleMessageEvent(messageEvent)
+	}
+	return nil
+}
+
+// handleMessageEvent runs the ! command a message starts with, if any
+func (s *SlackTicketService) handleMessageEvent(messageEvent *slackevents.MessageEvent) error {
+	// Now you have access to the message event data
+	u.LogPrint(1, "Received message event: %v", messageEvent)
+	if s.isOwnMessage(messageEvent) {
+		return nil
+	}
+	messageSplitBySpaces := strings.Split(messageEvent.Text, " ")
+	if len(messageSplitBySpaces) < 1 {
+		u.LogPrint(1, "Message did not have any length")
+		return nil
+	}
+	// Check if it's a command
+	command := strings.ToLower(messageSplitBySpaces[0])
+	if !regexp.MustCompile(`^!`).MatchString(command) {
+		u.LogPrint(1, "Not a command: %v", command)
+		return nil
+	}
+	// Now let's fire up the correct command
+	if function, ok := functionMap[command]; ok {
+		// Call the function with the event and arguments
+		err := function(s, messageCommandEvent(messageEvent), messageSplitBySpaces)
+		if err != nil {
+			u.LogPrint(3, "Something went wrong with function: %v", command)
+		}
+		u.LogPrint(2, "Completed Function %v", command)
+	} else {
+		// Command not found
+		u.LogPrint(1, "Command %v not found", command)
+	}
+	return nil
 }
\ No newline at end of file
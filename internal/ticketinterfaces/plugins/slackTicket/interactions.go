@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	u "ticketservice/internal/utils"
+)
+
+// Button clicks run the same functions as the ! commands, with the
+// arguments the command would have been typed with. The buttons asking
+// why open a modal instead, see modalActions.
+var actionMap = map[string][]string{
+	actionSnooze7d:  {"!snooze", "for", "7", "days"},
+	actionSnooze30d: {"!snooze", "for", "30", "days"},
+	actionComplete:  {"!complete"},
+}
+
+// viewSubmissionMap handles modal submissions by the modal's callback ID.
+// Modals keep the IssueKey of their ticket in the private metadata.
+var viewSubmissionMap = map[string]func(*SlackTicketService, *commandEvent, *slack.InteractionCallback) error{}
+
+// isInteractionPayload reports whether a webhook body is an interactive
+// payload, which Slack form encodes as payload=<json>, rather than an Events API event.
+func isInteractionPayload(body []byte) bool {
+	return bytes.HasPrefix(body, []byte("payload="))
+}
+
+func parseInteractionPayload(body []byte) (*slack.InteractionCallback, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		return nil, err
+	}
+	return &callback, nil
+}
+
+// splitIssueKey returns the channel and, for thread tickets, the timestamp
+// of the parent message of a ticket.
+func (s *SlackTicketService) splitIssueKey(issueKey string) (string, string) {
+	if s.channelAsTicket {
+		return issueKey, ""
+	}
+	// Thread tickets are channel-timestamp
+	channel, timestamp, _ := strings.Cut(issueKey, "-")
+	return channel, timestamp
+}
+
+// ticketEvent stands in for the message a command would have been typed in,
+// so interactions reply in the ticket's channel or thread.
+func (s *SlackTicketService) ticketEvent(issueKey, user string) *commandEvent {
+	channel, timestamp := s.splitIssueKey(issueKey)
+	return &commandEvent{
+		Channel:         channel,
+		ThreadTimeStamp: timestamp,
+		User:            user,
+	}
+}
+
+// handleInteraction runs an interaction posted to the webhook
+func (s *SlackTicketService) handleInteraction(body []byte) error {
+	callback, err := parseInteractionPayload(body)
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to parse interaction payload: %v", err)
+		return err
+	}
+	return s.runInteraction(callback)
+}
+
+// runInteraction routes button clicks and modal submissions to the
+// command functions.
+func (s *SlackTicketService) runInteraction(callback *slack.InteractionCallback) error {
+	switch callback.Type {
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			args, ok := actionMap[action.ActionID]
+			if !ok {
+				u.LogPrint(1, "Action %v not found", action.ActionID)
+				continue
+			}
+			// The buttons carry the IssueKey of their ticket
+			event := s.ticketEvent(action.Value, callback.User.ID)
+			u.LogPrint(1, "User %v clicked %v on ticket %v", callback.User.ID, action.ActionID, action.Value)
+			if err := functionMap[args[0]](s, event, args); err != nil {
+				u.LogPrint(3, "Something went wrong with action: %v", action.ActionID)
+				return err
+			}
+			u.LogPrint(2, "Completed Action %v", action.ActionID)
+		}
+		return nil
+	case slack.InteractionTypeViewSubmission:
+		function, ok := viewSubmissionMap[callback.View.CallbackID]
+		if !ok {
+			u.LogPrint(1, "View %v not found", callback.View.CallbackID)
+			return nil
+		}
+		event := s.ticketEvent(callback.View.PrivateMetadata, callback.User.ID)
+		if err := function(s, event, callback); err != nil {
+			u.LogPrint(3, "Something went wrong with view: %v", callback.View.CallbackID)
+			return err
+		}
+		u.LogPrint(2, "Completed View %v", callback.View.CallbackID)
+		return nil
+	}
+	return fmt.Errorf("unexpected interaction type: %s", callback.Type)
+}
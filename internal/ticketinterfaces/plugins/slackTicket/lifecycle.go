@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/locale"
+	"ticketservice/internal/templates"
+	u "ticketservice/internal/utils"
+)
+
+// Added to the parent message of a closed thread ticket
+const defaultClosedReaction = "white_check_mark"
+
+// Prefix of closed channel tickets when SLACK_RENAME_CLOSED is set
+const closedChannelPrefix = "closed-"
+
+// Slack channel names are at most 80 characters
+// https://api.slack.com/methods/conversations.create
+const maxChannelNameLength = 80
+
+func truncateChannelName(name string) string {
+	if len(name) > maxChannelNameLength {
+		return name[:maxChannelNameLength]
+	}
+	return name
+}
+
+func (s *SlackTicketService) closedReaction() string {
+	if reaction := s.setting("SLACK_CLOSED_REACTION"); reaction != "" {
+		return strings.Trim(reaction, ":")
+	}
+	return defaultClosedReaction
+}
+
+func (s *SlackTicketService) renameClosed() bool {
+	rename, err := strconv.ParseBool(s.setting("SLACK_RENAME_CLOSED"))
+	return err == nil && rename
+}
+
+// closeConversation marks a ticket closed in Slack. A thread ticket only
+// shares its channel, so the parent message gets a reaction. A channel
+// ticket is the whole channel, so it's archived.
+func (s *SlackTicketService) closeConversation(issueKey string) error {
+	channel, timestamp := s.splitIssueKey(issueKey)
+	if !s.channelAsTicket {
+		err := s.callSlack("reactions.add", func() error {
+			return s.slackClient.AddReaction(s.closedReaction(), slack.NewRefToMessage(channel, timestamp))
+		})
+		if err != nil && err.Error() != "already_reacted" {
+			return err
+		}
+		return nil
+	}
+	if s.renameClosed() {
+		s.renameChannel(channel, func(name string) string {
+			if strings.HasPrefix(name, closedChannelPrefix) {
+				return name
+			}
+			return truncateChannelName(closedChannelPrefix + name)
+		})
+	}
+	err := s.callSlack("conversations.archive", func() error {
+		return s.slackClient.ArchiveConversation(channel)
+	})
+	if err != nil && err.Error() != "already_archived" {
+		return err
+	}
+	// Archived channels aren't in the cache, a new ticket must not find this one
+	s.channels.remove(channel)
+	return nil
+}
+
+// reopenConversation undoes closeConversation
+func (s *SlackTicketService) reopenConversation(issueKey string) error {
+	channel, timestamp := s.splitIssueKey(issueKey)
+	if !s.channelAsTicket {
+		err := s.callSlack("reactions.remove", func() error {
+			return s.slackClient.RemoveReaction(s.closedReaction(), slack.NewRefToMessage(channel, timestamp))
+		})
+		if err != nil && err.Error() != "no_reaction" {
+			return err
+		}
+		return nil
+	}
+	err := s.callSlack("conversations.unarchive", func() error {
+		return s.slackClient.UnArchiveConversation(channel)
+	})
+	if err != nil && err.Error() != "not_archived" {
+		return err
+	}
+	s.renameChannel(channel, func(name string) string {
+		return strings.TrimPrefix(name, closedChannelPrefix)
+	})
+	return nil
+}
+
+// renameChannel renames a channel to what rename makes of its current
+// name. Failing to rename isn't worth failing the close or reopen for, the
+// old name may be taken by a newer ticket for the same resource.
+func (s *SlackTicketService) renameChannel(channelID string, rename func(name string) string) {
+	var channel *slack.Channel
+	err := s.callSlack("conversations.info", func() (err error) {
+		channel, err = s.slackClient.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: channelID})
+		return err
+	})
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to get channel %s to rename it: %v", channelID, err)
+		return
+	}
+	name := rename(channel.Name)
+	if name == channel.Name {
+		return
+	}
+	err = s.callSlack("conversations.rename", func() error {
+		_, err := s.slackClient.RenameConversation(channelID, name)
+		return err
+	})
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to rename channel %s to %s: %v", channel.Name, name, err)
+	}
+}
+
+// ReopenTicket unarchives a channel ticket, or takes the closed reaction
+// off a thread ticket.
+func (s *SlackTicketService) ReopenTicket(issueKey string) error {
+	return s.reopenConversation(issueKey)
+}
+
+// closingNote tells a thread it's closed, the thread stays where it is
+func (s *SlackTicketService) closingNote(issueKey string) error {
+	loc := locale.English
+	if ticket, err := s.store.GetTicket(issueKey); err == nil {
+		loc = templates.TicketLocale(ticket)
+	}
+	channel, timestamp := s.splitIssueKey(issueKey)
+	return s.sendSlackMessage(channel, timestamp, locale.Sprintf(loc, "This ticket is closed, !reopen reopens it"))
+}
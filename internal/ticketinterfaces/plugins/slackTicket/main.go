@@ -15,15 +15,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"regexp"
 	"strconv"
-	"sync"
-	"text/template"
+	"time"
 
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
 	
+	"ticketservice/internal/queue"
+	r "ticketservice/internal/ratelimit"
 	t "ticketservice/internal/ticketinterfaces"
 	u "ticketservice/internal/utils"
 )
@@ -31,14 +34,46 @@ import (
 var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9 ]+`)
 var slackSigningSecret = ""
 
+// slackAPI is the part of the Slack Web API the plugin uses. *webClient
+// implements it, a fake can stand in for Slack when exercising commands.
+type slackAPI interface {
+	AuthTest() (*slack.AuthTestResponse, error)
+	CreateConversation(params slack.CreateConversationParams) (*slack.Channel, error)
+	ArchiveConversation(channelID string) error
+	UnArchiveConversation(channelID string) error
+	RenameConversation(channelID, channelName string) (*slack.Channel, error)
+	SetPurposeOfConversation(channelID, purpose string) (*slack.Channel, error)
+	GetConversationInfo(input *slack.GetConversationInfoInput) (*slack.Channel, error)
+	InviteUsersToConversation(channelID string, users ...string) (*slack.Channel, error)
+	GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+	GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	SendMessage(channel string, options ...slack.MsgOption) (string, string, string, error)
+	OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
+	GetUserByEmail(email string) (*slack.User, error)
+	AddReaction(name string, item slack.ItemRef) error
+	RemoveReaction(name string, item slack.ItemRef) error
+	InviteShared(channelID string, emails []string) error
+}
+
 type SlackTicketService struct {
-	slackClient *slack.Client
+	slackClient slackAPI
 	slackSigningSecret	string
 	channelAsTicket bool
-	channelCache map[string]slack.Channel
-	cacheMutex sync.Mutex
-	titleTemplate *template.Template
-	updateTemplate *template.Template
+	// Receive events over a Socket Mode websocket instead of the webhook
+	socketMode bool
+	channels *channelCache
+	limiter *r.Limiter
+	settings map[string]string
+	// Who we are, so we can ignore our own messages
+	botID string
+	botUserID string
+	// Event IDs already taken, so Slack's retries aren't processed twice
+	eventDedup *eventDedup
+	// Slack users behind the emails and groups of the routing table
+	directory *slackDirectory
+	// Where commands read and save tickets
+	store ticketStore
 }
 
 func CreateService() t.BaseTicketService{
@@ -46,28 +81,69 @@ func CreateService() t.BaseTicketService{
 	return &service
 }
 
+// Configure stores the backend settings from the config file
+func (s *SlackTicketService) Configure(settings map[string]string) {
+	s.settings = settings
+}
+
+// setting returns a backend setting, falling back to the environment
+func (s *SlackTicketService) setting(key string) string {
+	if value, ok := s.settings[key]; ok && value != "" {
+		return value
+	}
+	return os.Getenv(key)
+}
+
 func (s *SlackTicketService) Init() error {
-	apiToken := os.Getenv("SLACK_API_TOKEN")
+	apiToken := s.setting("SLACK_API_TOKEN")
 	if apiToken == "" {
 		u.LogPrint(4,"SLACK_API_TOKEN environment variable not set")
 	}
-	ss := os.Getenv("SLACK_SIGNING_SECRET")
-	if ss == "" {
+	if sm := s.setting("SLACK_SOCKET_MODE"); sm != "" {
+		var err error
+		s.socketMode, err = strconv.ParseBool(sm)
+		if err != nil {
+			u.LogPrint(3,"Error parsing SLACK_SOCKET_MODE as bool: %v\n", err)
+		}
+	}
+	// Socket Mode doesn't take webhooks, so there is nothing to sign
+	ss := s.setting("SLACK_SIGNING_SECRET")
+	if ss == "" && !s.socketMode {
 		u.LogPrint(4,"SLACK_SIGNING_SECRET environment variable not set")
 	}
 	slackSigningSecret = ss
+	var options []slack.Option
+	apiURL := defaultSlackAPIURL
+	// Lets a local stand-in play Slack, websocket included
+	if url := s.setting("SLACK_API_URL"); url != "" {
+		options = append(options, slack.OptionAPIURL(url))
+		apiURL = url
+	}
+	appToken := s.setting("SLACK_APP_TOKEN")
+	if s.socketMode {
+		if appToken == "" {
+			u.LogPrint(4,"SLACK_APP_TOKEN environment variable not set, it's needed for Socket Mode")
+		}
+		options = append(options, slack.OptionAppLevelToken(appToken))
+	}
 	// Create a new Slack client with your API token
-	s.slackClient = slack.New(apiToken)
+	client := slack.New(apiToken, options...)
+	s.slackClient = newWebClient(client, apiURL, apiToken)
+	s.store = bigQueryStore{}
+	// Every Slack call goes through the limiter so we stay under the API tiers
+	s.limiter = s.newSlackLimiter()
 
 	// Use the Slack client in your code
-	_, err := s.slackClient.AuthTest()
+	auth, err := s.slackClient.AuthTest()
 	if err != nil {
 		log.Fatalf("Error authenticating with Slack: %s", err)
 	}
+	s.botID = auth.BotID
+	s.botUserID = auth.UserID
 	log.Println("Successfully authenticated with Slack!")
 	// Let's see if the environment wants to use channel as ticket
 	// or thread as ticket
-	cAsT := os.Getenv("SLACK_CHANNEL_AS_TICKET")
+	cAsT := s.setting("SLACK_CHANNEL_AS_TICKET")
 	defaultValue := true
 	if cAsT != "" {
 		var err error
@@ -77,58 +153,53 @@ func (s *SlackTicketService) Init() error {
 		}
 	}
 	s.channelAsTicket = defaultValue
-	u.LogPrint(1, "Loading Title Template")
-	s.titleTemplate, err = template.ParseFiles("ticketTitleTpl.txt")
-	if err != nil {
-        u.LogPrint(4, "Error loading title template: %s", err)
-    }
-	u.LogPrint(1, "Loading Message Template")
-	// An argument could be made for making this an ENV. I'm flexible
-	s.updateTemplate, err = template.ParseFiles("updateTicketTpl.txt")
-    if err != nil {
-        u.LogPrint(4, "Error loading update template: %s", err)
-    }
 	u.LogPrint(1,"CHANNEL_AS_TICKET is set to "+strconv.FormatBool(s.channelAsTicket))
 	u.LogPrint(1, "Creating Channel Cache")
-	s.channelCache = make(map[string]slack.Channel)
-	err = s.updateChannelCache(true)
+	channelCacheTTL := defaultChannelCacheTTL
+	if ttl := s.setting("SLACK_CHANNEL_CACHE_TTL"); ttl != "" {
+		channelCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			u.LogPrint(3,"Error parsing SLACK_CHANNEL_CACHE_TTL, using %v: %v", defaultChannelCacheTTL, err)
+			channelCacheTTL = defaultChannelCacheTTL
+		}
+	}
+	s.channels = newChannelCache(channelCacheTTL)
+	err = s.listChannels(0)
 	if err != nil {
 		u.LogPrint(4, "Error creating channel cache: %s", err)
 	}
-	return nil
-}
-
-// Function to update the cache
-func (s *SlackTicketService) updateChannelCache(lock bool) error {
-	if(lock){
-		s.cacheMutex.Lock()
-		defer s.cacheMutex.Unlock()
-	}
-	// Clear the cache
-	s.channelCache = make(map[string]slack.Channel)
-
-	var cursor string
-	for {
-		params := &slack.GetConversationsParameters{
-			ExcludeArchived: true,
-			Cursor:          cursor,
-			Limit:           500,
-		}
-
-		channels, nextCursor, err := s.slackClient.GetConversations(params)
+	dedupTTL := defaultEventDedupTTL
+	if ttl := s.setting("SLACK_EVENT_DEDUP_TTL"); ttl != "" {
+		dedupTTL, err = time.ParseDuration(ttl)
 		if err != nil {
-			return err
+			u.LogPrint(3,"Error parsing SLACK_EVENT_DEDUP_TTL, using %v: %v", defaultEventDedupTTL, err)
+			dedupTTL = defaultEventDedupTTL
 		}
-
-		// Populate the cache
-		for _, channel := range channels {
-			s.channelCache[channel.Name] = channel
+	}
+	s.eventDedup = newEventDedup(dedupTTL, s.setting("SLACK_EVENT_DEDUP_FILE"))
+	directoryTTL := defaultDirectoryTTL
+	if ttl := s.setting("SLACK_DIRECTORY_TTL"); ttl != "" {
+		directoryTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			u.LogPrint(3,"Error parsing SLACK_DIRECTORY_TTL, using %v: %v", defaultDirectoryTTL, err)
+			directoryTTL = defaultDirectoryTTL
 		}
-
-		if nextCursor == "" {
-			break
+	}
+	resolveGroups := true
+	if rg := s.setting("SLACK_RESOLVE_GROUPS"); rg != "" {
+		resolveGroups, err = strconv.ParseBool(rg)
+		if err != nil {
+			u.LogPrint(3,"Error parsing SLACK_RESOLVE_GROUPS as bool: %v\n", err)
+			resolveGroups = true
 		}
-		cursor = nextCursor
+	}
+	s.directory = newSlackDirectory(directoryTTL, resolveGroups)
+	// Webhooks and Socket Mode requests are processed off the work queue
+	queue.Register(webhookJobKind, s.processWebhook)
+	queue.Register(socketJobKind, s.processSocketJob)
+	if s.socketMode {
+		u.LogPrint(1, "Starting Socket Mode")
+		go s.runSocketMode(context.Background(), socketmode.New(client))
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/locale"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// Callback IDs of the modals, see viewSubmissionMap
+const (
+	snoozeModalID  = "snooze_modal"
+	dismissModalID = "dismiss_modal"
+)
+
+// Block and action IDs of the modal inputs
+const (
+	durationBlockID  = "duration"
+	durationActionID = "duration_select"
+	reasonBlockID    = "reason"
+	reasonActionID   = "reason_select"
+	commentBlockID   = "comment"
+	commentActionID  = "comment_input"
+)
+
+// modalActions are the buttons that open a modal asking why
+var modalActions = map[string]string{
+	actionSnoozeCustom: snoozeModalID,
+	actionDismiss:      dismissModalID,
+}
+
+// modalCommands are the slash commands that open a modal asking why when
+// they're run without arguments
+var modalCommands = map[string]string{
+	"snooze":  snoozeModalID,
+	"dismiss": dismissModalID,
+}
+
+// Slack caps plain text inputs at 3000 characters, comments don't need that many
+const maxCommentLength = 2000
+
+// Snooze lengths offered by the modal, in days
+var snoozeDurations = []int{7, 14, 30, 90, 180, 365}
+
+// reasonLabels are the English labels of each reason
+var reasonLabels = map[string]string{
+	t.ReasonFalsePositive: "False positive",
+	t.ReasonPlanned:       "Planned",
+	t.ReasonBlocked:       "Blocked",
+	t.ReasonNotWorthIt:    "Not worth it",
+}
+
+func init() {
+	viewSubmissionMap[snoozeModalID] = snoozeModalSubmission
+	viewSubmissionMap[dismissModalID] = dismissModalSubmission
+}
+
+func reasonSelect(loc string) *slack.InputBlock {
+	options := make([]*slack.OptionBlockObject, len(t.Reasons))
+	for i, reason := range t.Reasons {
+		options[i] = slack.NewOptionBlockObject(reason, plainText(locale.Sprintf(loc, reasonLabels[reason])), nil)
+	}
+	return slack.NewInputBlock(reasonBlockID, plainText(locale.Sprintf(loc, "Reason")), nil,
+		slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plainText(locale.Sprintf(loc, "Pick a reason")), reasonActionID, options...))
+}
+
+func durationSelect(loc string) *slack.InputBlock {
+	options := make([]*slack.OptionBlockObject, len(snoozeDurations))
+	for i, days := range snoozeDurations {
+		options[i] = slack.NewOptionBlockObject(strconv.Itoa(days), plainText(locale.Sprintf(loc, "%d days", days)), nil)
+	}
+	element := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, durationActionID, options...)
+	element.InitialOption = options[0]
+	return slack.NewInputBlock(durationBlockID, plainText(locale.Sprintf(loc, "Snooze for")), nil, element)
+}
+
+func commentInput(loc string) *slack.InputBlock {
+	element := slack.NewPlainTextInputBlockElement(plainText(locale.Sprintf(loc, "Anything others should know")), commentActionID)
+	element.Multiline = true
+	element.MaxLength = maxCommentLength
+	block := slack.NewInputBlock(commentBlockID, plainText(locale.Sprintf(loc, "Comment")), nil, element)
+	block.Optional = true
+	return block
+}
+
+// reasonModal builds the snooze or dismiss modal of a ticket. The IssueKey
+// goes in the private metadata so the submission can find the ticket.
+func reasonModal(callbackID string, ticket *t.Ticket) slack.ModalViewRequest {
+	loc := templates.TicketLocale(ticket)
+	title, submit := "Snooze ticket", "Snooze"
+	blocks := []slack.Block{durationSelect(loc)}
+	if callbackID == dismissModalID {
+		title, submit = "Dismiss ticket", "Dismiss"
+		blocks = nil
+	}
+	blocks = append(blocks, reasonSelect(loc), commentInput(loc))
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      callbackID,
+		PrivateMetadata: ticket.IssueKey,
+		Title:           plainText(locale.Sprintf(loc, title)),
+		Submit:          plainText(locale.Sprintf(loc, submit)),
+		Close:           plainText(locale.Sprintf(loc, "Cancel")),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// openReasonModal opens the snooze or dismiss modal of a ticket for whoever
+// clicked or ran the command. A trigger_id expires 3 seconds after the click,
+// so this happens before the request is queued, knowing nothing but the
+// IssueKey. The ticket is looked up, and the user authorized, on submission.
+func (s *SlackTicketService) openReasonModal(event *commandEvent, triggerID, issueKey, callbackID string) {
+	ticket := &t.Ticket{IssueKey: issueKey}
+	err := s.callSlack("views.open", func() error {
+		_, err := s.slackClient.OpenView(triggerID, reasonModal(callbackID, ticket))
+		return err
+	})
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to open %s: %v", callbackID, err)
+		s.reply(event, templates.TicketLocale(nil), "Something went wrong")
+	}
+}
+
+// openInteractionModal opens the modal of a button asking why, reporting
+// whether the interaction was one. Those have nothing left to queue.
+func (s *SlackTicketService) openInteractionModal(callback *slack.InteractionCallback) bool {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return false
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		callbackID, ok := modalActions[action.ActionID]
+		if !ok {
+			continue
+		}
+		// The buttons carry the IssueKey of their ticket
+		u.LogPrint(1, "User %v clicked %v on ticket %v", callback.User.ID, action.ActionID, action.Value)
+		s.openReasonModal(s.ticketEvent(action.Value, callback.User.ID), callback.TriggerID, action.Value, callbackID)
+		return true
+	}
+	return false
+}
+
+// openSlashCommandModal opens the modal of /reco snooze or /reco dismiss run
+// without arguments, reporting whether the command was one of them.
+func (s *SlackTicketService) openSlashCommandModal(event *commandEvent, triggerID, text string) bool {
+	fields := s.slashCommandTicket(event, strings.Fields(text))
+	if len(fields) != 1 {
+		return false
+	}
+	callbackID, ok := modalCommands[strings.ToLower(fields[0])]
+	if !ok {
+		return false
+	}
+	issueKey := event.Channel
+	if !s.channelAsTicket {
+		if event.ThreadTimeStamp == "" {
+			// runSlashCommand tells them to name the ticket
+			return false
+		}
+		issueKey = fmt.Sprintf("%v-%v", event.Channel, event.ThreadTimeStamp)
+	}
+	u.LogPrint(1, "Received slash command: %v %v", event.SlashCommand, fields)
+	s.openReasonModal(event, triggerID, issueKey, callbackID)
+	return true
+}
+
+// modalValue returns what was picked or typed into an input of a submitted modal
+func modalValue(callback *slack.InteractionCallback, blockID, actionID string) string {
+	if callback.View.State == nil {
+		return ""
+	}
+	action := callback.View.State.Values[blockID][actionID]
+	if action.SelectedOption.Value != "" {
+		return action.SelectedOption.Value
+	}
+	return action.Value
+}
+
+func snoozeModalSubmission(s *SlackTicketService, event *commandEvent, callback *slack.InteractionCallback) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "snooze this ticket") {
+		return nil
+	}
+	days, err := strconv.Atoi(modalValue(callback, durationBlockID, durationActionID))
+	if err != nil {
+		return fmt.Errorf("invalid snooze duration: %w", err)
+	}
+	return s.snoozeTicket(event, &ticket, time.Duration(days)*24*time.Hour,
+		modalValue(callback, reasonBlockID, reasonActionID),
+		modalValue(callback, commentBlockID, commentActionID))
+}
+
+func dismissModalSubmission(s *SlackTicketService, event *commandEvent, callback *slack.InteractionCallback) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "dismiss this ticket") {
+		return nil
+	}
+	return s.dismissTicket(event, &ticket,
+		modalValue(callback, reasonBlockID, reasonActionID),
+		modalValue(callback, commentBlockID, commentActionID))
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/authz"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// click is a button click on the ticket C123
+func click(user, actionID string) *slack.InteractionCallback {
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, TriggerID: "trigger"}
+	callback.User.ID = user
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionID, Value: "C123"}}
+	return callback
+}
+
+// submission is the submitted modal of the ticket C123, values by block ID
+func submission(user, callbackID string, values map[string]string) *slack.InteractionCallback {
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission}
+	callback.User.ID = user
+	callback.View.CallbackID = callbackID
+	callback.View.PrivateMetadata = "C123"
+	callback.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{}}
+	actionIDs := map[string]string{durationBlockID: durationActionID, reasonBlockID: reasonActionID, commentBlockID: commentActionID}
+	for blockID, value := range values {
+		action := slack.BlockAction{Value: value}
+		if blockID != commentBlockID {
+			action = slack.BlockAction{SelectedOption: slack.OptionBlockObject{Value: value}}
+		}
+		callback.View.State.Values[blockID] = map[string]slack.BlockAction{actionIDs[blockID]: action}
+	}
+	return callback
+}
+
+func TestModalsOpenBeforeQueueing(test *testing.T) {
+	tests := []struct {
+		name   string
+		open   func(s *SlackTicketService) bool
+		wantID string
+	}{
+		{"snooze button", func(s *SlackTicketService) bool { return s.openInteractionModal(click("UOWNER", actionSnoozeCustom)) }, snoozeModalID},
+		{"dismiss button", func(s *SlackTicketService) bool { return s.openInteractionModal(click("UOWNER", actionDismiss)) }, dismissModalID},
+		{"other button", func(s *SlackTicketService) bool { return s.openInteractionModal(click("UOWNER", actionComplete)) }, ""},
+		{"/reco snooze", func(s *SlackTicketService) bool {
+			return s.openSlashCommandModal(&commandEvent{Channel: "C123", User: "UOWNER"}, "trigger", "snooze")
+		}, snoozeModalID},
+		{"/reco dismiss", func(s *SlackTicketService) bool {
+			return s.openSlashCommandModal(&commandEvent{Channel: "C123", User: "UOWNER"}, "trigger", "Dismiss")
+		}, dismissModalID},
+		{"/reco dismiss with a reason", func(s *SlackTicketService) bool {
+			return s.openSlashCommandModal(&commandEvent{Channel: "C123", User: "UOWNER"}, "trigger", "dismiss planned")
+		}, ""},
+		{"/reco status", func(s *SlackTicketService) bool {
+			return s.openSlashCommandModal(&commandEvent{Channel: "C123", User: "UOWNER"}, "trigger", "status")
+		}, ""},
+	}
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			// Even a stranger gets the modal, they are refused when submitting it
+			s, slackFake, store := newCommandTest(test, "New")
+			opened := tt.open(s)
+			if opened != (tt.wantID != "") {
+				test.Fatalf("opened a modal %v, want %v", opened, tt.wantID != "")
+			}
+			if !opened {
+				if len(slackFake.views) != 0 {
+					test.Errorf("opened %d modals for a request that gets queued", len(slackFake.views))
+				}
+				return
+			}
+			if len(slackFake.views) != 1 {
+				test.Fatalf("opened %d modals, want 1", len(slackFake.views))
+			}
+			if view := slackFake.views[0]; view.CallbackID != tt.wantID || view.PrivateMetadata != "C123" {
+				test.Errorf("opened %s for %q, want %s for C123", view.CallbackID, view.PrivateMetadata, tt.wantID)
+			}
+			if len(store.saved)+len(store.history)+len(slackFake.posted) != 0 {
+				test.Error("changed the ticket before the modal was submitted")
+			}
+		})
+	}
+}
+
+func TestModalSubmission(test *testing.T) {
+	s, slackFake, store := newCommandTest(test, "New")
+	values := map[string]string{reasonBlockID: t.ReasonPlanned, commentBlockID: "moving next quarter"}
+	if err := s.runInteraction(submission("UOWNER", dismissModalID, values)); err != nil {
+		test.Fatal(err)
+	}
+	if len(store.saved) != 1 {
+		test.Fatalf("saved %d ticket rows, want 1", len(store.saved))
+	}
+	if saved := store.saved[0]; saved.Status != "Dismissed" || saved.Reason != t.ReasonPlanned || saved.Comment != "moving next quarter" {
+		test.Errorf("saved %s with reason %q and comment %q", saved.Status, saved.Reason, saved.Comment)
+	}
+	if len(store.suppressions) != 1 || store.suppressions[0].Owner != "UOWNER" {
+		test.Errorf("suppressed %v, want the resource owned by UOWNER", store.suppressions)
+	}
+
+	s, _, store = newCommandTest(test, "New")
+	values = map[string]string{durationBlockID: "14", reasonBlockID: t.ReasonBlocked}
+	if err := s.runInteraction(submission("UOWNER", snoozeModalID, values)); err != nil {
+		test.Fatal(err)
+	}
+	if len(store.saved) != 1 || store.saved[0].Status != "Snoozed" || store.saved[0].Reason != t.ReasonBlocked {
+		test.Errorf("saved %v, want it snoozed as blocked", store.saved)
+	}
+
+	// Whoever submits the modal is authorized then
+	s, slackFake, store = newCommandTest(test, "New")
+	if err := s.runInteraction(submission("USTRANGER", dismissModalID, map[string]string{reasonBlockID: t.ReasonPlanned})); err != nil {
+		test.Fatal(err)
+	}
+	if len(store.saved)+len(store.suppressions) != 0 {
+		test.Error("dismissed the ticket for a stranger")
+	}
+	if len(store.history) != 1 || store.history[0].Event != authz.EventDenied {
+		test.Errorf("recorded %v, want the denial", store.history)
+	}
+	if len(slackFake.posted) != 1 {
+		test.Errorf("replied %q, want a refusal", slackFake.posted)
+	}
+}
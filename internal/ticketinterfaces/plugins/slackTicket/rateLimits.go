@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	r "ticketservice/internal/ratelimit"
+	u "ticketservice/internal/utils"
+)
+
+// Default limits per Slack Web API method, based on the published tiers.
+// https://api.slack.com/docs/rate-limits
+// Slack allows short bursts, but we'd rather not rely on it.
+var defaultSlackLimits = map[string]r.Limit{
+	"conversations.create":       {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.list":         {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.archive":      {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.unarchive":    {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.rename":       {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.setPurpose":   {PerMinute: 20, Burst: 2}, // Tier 2
+	"conversations.invite":       {PerMinute: 50, Burst: 5}, // Tier 3
+	"conversations.inviteShared": {PerMinute: 20, Burst: 2}, // Tier 2
+	"chat.postMessage":           {PerMinute: 60, Burst: 5}, // Special, roughly 1 per second
+	"users.lookupByEmail":        {PerMinute: 50, Burst: 5}, // Tier 3
+}
+
+// Anything we haven't listed gets treated as Tier 3
+var fallbackSlackLimit = r.Limit{PerMinute: 50, Burst: 5}
+
+func (s *SlackTicketService) newSlackLimiter() *r.Limiter {
+	limits := make(map[string]r.Limit)
+	for method, limit := range defaultSlackLimits {
+		limits[method] = limit
+	}
+	if overrides := s.setting("SLACK_RATE_LIMITS"); overrides != "" {
+		parsed, err := r.ParseLimits(overrides)
+		if err != nil {
+			u.LogPrint(3, "Error parsing SLACK_RATE_LIMITS, using defaults: %v", err)
+		}
+		for method, limit := range parsed {
+			limits[method] = limit
+		}
+	}
+	maxRetries := 5
+	if mr := s.setting("SLACK_MAX_RETRIES"); mr != "" {
+		var err error
+		maxRetries, err = strconv.Atoi(mr)
+		if err != nil {
+			u.LogPrint(3, "Error parsing SLACK_MAX_RETRIES as int: %v", err)
+			maxRetries = 5
+		}
+	}
+	return r.NewLimiter(limits, fallbackSlackLimit, r.RetryPolicy{
+		MaxRetries:  maxRetries,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		RetryAfter:  slackRetryAfter,
+	})
+}
+
+// slackRetryAfter recognizes both forms of rate limiting Slack uses,
+// an HTTP 429 with a Retry-After header and an ok:false "ratelimited" response.
+func slackRetryAfter(err error) (time.Duration, bool) {
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return rateLimited.RetryAfter, true
+	}
+	if err.Error() == "ratelimited" {
+		return 0, true
+	}
+	return 0, false
+}
+
+// callSlack runs fn under the limiter for the given Slack API method.
+func (s *SlackTicketService) callSlack(method string, fn func() error) error {
+	return s.limiter.Do(context.Background(), method, fn)
+}
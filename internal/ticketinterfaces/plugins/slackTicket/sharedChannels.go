@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	b "ticketservice/internal/bigqueryfunctions"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// Conversation types the channel cache lists. Private channels only show
+// up once the bot is in them, which it is for every channel it created.
+var cachedConversationTypes = []string{"public_channel", "private_channel"}
+
+// A route Target that is a channel ID names an existing channel, I.E. one
+// shared with another organization, instead of a channel to create. Channel
+// names are lower case so they can't be mistaken for one.
+var channelIDRegex = regexp.MustCompile(`^[CG][A-Z0-9]{8,}$`)
+
+// routeOptions looks up the route a ticket came from. Tickets created over
+// the API don't have a project, so they get the defaults.
+func (s *SlackTicketService) routeOptions(ticket *t.Ticket, row t.RecommendationQueryResult) b.RouteOptions {
+	if row.ProjectId == "" {
+		return b.RouteOptions{}
+	}
+	options, err := b.GetRouteOptions(row.ProjectId, ticket.TargetContact)
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to get the route options of %s: %v", ticket.TargetContact, err)
+	}
+	return options
+}
+
+// inviteShared invites people outside the workspace to a channel with Slack
+// Connect. They have to accept before they can see it.
+func (s *SlackTicketService) inviteShared(channelID string, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	return s.callSlack("conversations.inviteShared", func() error {
+		return s.slackClient.InviteShared(channelID, emails)
+	})
+}
+
+// inviteExternal invites a route's external people to a ticket's channel. It
+// only logs failures, the ticket is still useful to everyone else.
+func (s *SlackTicketService) inviteExternal(channelID string, options b.RouteOptions) {
+	if err := s.inviteShared(channelID, options.ExternalInvites); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to invite %s to %s with Slack Connect: %v", strings.Join(options.ExternalInvites, ", "), channelID, err)
+	}
+}
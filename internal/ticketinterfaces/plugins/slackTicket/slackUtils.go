@@ -15,7 +15,6 @@
 package main
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -28,7 +27,8 @@ import (
 
 	"github.com/slack-go/slack"
 
-	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/policy"
+	"ticketservice/internal/templates"
 	t "ticketservice/internal/ticketinterfaces"
 	u "ticketservice/internal/utils"
 )
@@ -61,90 +61,61 @@ func verifyRequestSignature(header http.Header, body []byte) bool {
     return equal
 }
 
-func (s *SlackTicketService) createNewChannel(channelName string) (*slack.Channel, error){
-	// Lock the cache because there could be multiple 
-	// goroutines checking channels
-	// and if we create a channel, we don't want to try 
-	// creating multiple.
-	re := regexp.MustCompile(`[\s@#._/:\\*?"<>|]+`)
-	channelName = re.ReplaceAllString(channelName, "-")
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-	channel, exists := s.channelCache[channelName]
-	if exists {
-		// The channel exists, simply return the channel
-		return &channel, nil
-	}
-	// Create channel if it doesn't exist
-	newChannel, err := s.slackClient.CreateConversation(slack.CreateConversationParams{
-		ChannelName: channelName,
-	})
-	if err != nil {
-		// If channel name exists we need to update the cache.
-		if strings.Contains(err.Error(), "name_taken") || strings.Contains(err.Error(), "channel already exists") {
+var channelNameRegex = regexp.MustCompile(`[\s@#._/:\\*?"<>|]+`)
 
-			err = s.updateChannelCache(false)// False lock because it's already locked
-			if err != nil {
-				// Many more errors may come after this because something
-				// went terribly wrong, and now the cache is cleared
-				u.LogPrint(3, "Error creating channel cache: %s", err)
-				return nil, err
-			}
-			// Use recursion since we need to confirm it's created?
-			s.cacheMutex.Unlock()
-			return s.createNewChannel(channelName)
-		} else {
-			return nil, err
-		}
-	}
-	// Add channel to cache
-	s.channelCache[newChannel.Name] = *newChannel
-	return newChannel, nil
+// sanitizeChannelName replaces characters Slack doesn't allow in channel names
+func sanitizeChannelName(channelName string) string {
+	return channelNameRegex.ReplaceAllString(channelName, "-")
 }
 
-
-func (s *SlackTicketService) createChannelAsTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+// channelTicketName sets the ticket Subject and returns the channel name
+// a channel as ticket will be created with.
+func (s *SlackTicketService) channelTicketName(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
 	lastSlashIndex := strings.LastIndex(row.TargetResource, "/")
 	secondToLast := strings.LastIndex(row.TargetResource[:lastSlashIndex], "/")
-	now := time.Now().Format(time.RFC3339)
-	ticket.CreationDate = now
-	ticket.LastUpdateDate = now
-	ticket.LastPingDate = now
-	ticket.SnoozeDate = time.Now().AddDate(0,0,7).Format(time.RFC3339)
 	ticket.Subject = fmt.Sprintf("%s-%s",
 			row.RecommenderSubtype,
 			nonAlphanumericRegex.ReplaceAllString(
 				row.TargetResource[secondToLast+1:],
 				""))
 	ticket.RecommenderID = row.RecommenderName
-	ticket.UserRecommendation = false
-	
+
 	// Create Ticket Title
-	var titleBuffer bytes.Buffer
-	err := s.titleTemplate.Execute(&titleBuffer, map[string]interface{}{"Row": row, "Ticket": ticket})
+	channelName, err := templates.Render(templates.Title, row, ticket)
 	if err != nil {
 		u.LogPrint(3,"Error Executing Channel Name Template")
 		return "", err
 	}
-	channelName := titleBuffer.String()
 	channelName = strings.ReplaceAll(channelName, " ", "")
-	// According to this document the string length can be a max of 80
-	// https://api.slack.com/methods/conversations.create
-	sliceLength := 80
-	stringLength := len(channelName) - 1
-	if stringLength  < sliceLength {
-		sliceLength = stringLength
+	return truncateChannelName(strings.ToLower(channelName)), nil
+}
+
+func (s *SlackTicketService) createChannelAsTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+	now := time.Now().Format(time.RFC3339)
+	ticket.CreationDate = now
+	ticket.LastUpdateDate = now
+	ticket.LastPingDate = now
+	snoozeDays := policy.Current().Match(row.RecommenderName, row.RecommenderSubtype).SnoozeDays
+	ticket.SnoozeDate = time.Now().AddDate(0,0,snoozeDays).Format(time.RFC3339)
+	ticket.UserRecommendation = false
+	channelName, err := s.channelTicketName(ticket, row)
+	if err != nil {
+		return "", err
 	}
-	channelName = strings.ToLower(channelName[0:sliceLength])
+	options := s.routeOptions(ticket, row)
 	u.LogPrint(1,"Creating Channel: "+channelName)
-	channel, err := s.createNewChannel(channelName)
+	channel, err := s.createNewChannel(channelName, options.Private, &row)
 	if err != nil {
 		u.LogPrint(3,"Error creating channel")
 		return "", err
 	}
+	s.inviteExternal(channel.ID, options)
 
 	ticket.IssueKey = channel.ID
-	_, err = s.slackClient.InviteUsersToConversation(channel.ID, ticket.Assignee...)
+	err = s.callSlack("conversations.invite", func() error {
+		_, err := s.slackClient.InviteUsersToConversation(channel.ID, ticket.Assignee...)
+		return err
+	})
 	if err != nil {
 		// If user is already in channel we should continue
 		if err.Error() != "already_in_channel" {
@@ -154,7 +125,7 @@ func (s *SlackTicketService) createChannelAsTicket(ticket *t.Ticket, row t.Recom
 		u.LogPrint(1,"User(s) were already in channel")
 	}
 	// Ping Channel with details of the Recommendation
-	err = s.UpdateTicket(ticket, row)
+	err = s.UpdateTicket(ticket, row, t.EventCreated)
 	if err != nil {
 		u.LogPrint(3, "Failed to Update Ticket")
 		return "", err
@@ -163,38 +134,99 @@ func (s *SlackTicketService) createChannelAsTicket(ticket *t.Ticket, row t.Recom
 	return channel.ID, nil
 }
 
-func (s *SlackTicketService) createThreadAsTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
-	u.LogPrint(1, "Creating Thread As Ticket")
-	now := time.Now().Format(time.RFC3339)
-	ticket.CreationDate = now
-	ticket.LastUpdateDate = now
-	ticket.LastPingDate = now
-	ticket.SnoozeDate = time.Now().AddDate(0,0,7).Format(time.RFC3339)
-	ticket.UserRecommendation = false
+// threadTicketChannel sets the ticket Subject and returns the channel
+// the ticket thread will be started in.
+func (s *SlackTicketService) threadTicketChannel(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
 	// Create Ticket Title
-	var titleBuffer bytes.Buffer
-	err := s.titleTemplate.Execute(&titleBuffer, map[string]interface{}{"Row": row, "Ticket": ticket})
+	title, err := templates.Render(templates.Title, row, ticket)
 	if err != nil {
 		u.LogPrint(3,"Error Executing Title Name Template")
 		return "", err
 	}
 	// Set Ticket Title / Subject
-	ticket.Subject = titleBuffer.String()
+	ticket.Subject = title
 	ticket.RecommenderID = row.RecommenderName
-	channelName := strings.ToLower(ticket.TargetContact)
+	if channelIDRegex.MatchString(ticket.TargetContact) {
+		return ticket.TargetContact, nil
+	}
+	// Replace multiple characters to conform to Slack channel name restrictions
+	return sanitizeChannelName(strings.ToLower(ticket.TargetContact)), nil
+}
 
-	// Replace multiple characters using regex to conform to Slack channel name restrictions
-	re := regexp.MustCompile(`[\s@#._/:\\*?"<>|]+`)
-	channelName = re.ReplaceAllString(channelName, "-")
+// ticketMetadataEventType marks the first message of a thread ticket
+const ticketMetadataEventType = "recommendation_ticket"
 
-	u.LogPrint(1, "Creating Channel: "+channelName)
-	channel, err := s.createNewChannel(channelName)
+// ticketMetadata is attached to the first message of a thread ticket, so
+// FindTicket can tell which recommendation a thread was started for.
+func ticketMetadata(row t.RecommendationQueryResult) slack.SlackMetadata {
+	return slack.SlackMetadata{
+		EventType: ticketMetadataEventType,
+		EventPayload: map[string]interface{}{
+			"target_resource":     row.TargetResource,
+			"recommender_subtype": row.RecommenderSubtype,
+		},
+	}
+}
+
+// maxChannelPurposeLength is the longest purpose Slack keeps
+const maxChannelPurposeLength = 250
+
+// ticketChannelPurpose is set on the channel of a channel ticket when it's
+// created, so a channel found under the ticket's name can be told apart
+// from one another ticket, or someone else, already took the name with.
+func ticketChannelPurpose(row t.RecommendationQueryResult) string {
+	purpose := "Recommendation ticket: " + row.RecommenderSubtype + " for " + row.TargetResource
+	if len(purpose) > maxChannelPurposeLength {
+		purpose = purpose[:maxChannelPurposeLength]
+	}
+	return purpose
+}
+
+// isTicketMessage tells if a message started the thread ticket for row
+func isTicketMessage(message slack.Message, row t.RecommendationQueryResult) bool {
+	metadata := message.Metadata
+	if metadata.EventType != ticketMetadataEventType {
+		return false
+	}
+	return metadata.EventPayload["target_resource"] == row.TargetResource &&
+		metadata.EventPayload["recommender_subtype"] == row.RecommenderSubtype
+}
+
+func (s *SlackTicketService) createThreadAsTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+	u.LogPrint(1, "Creating Thread As Ticket")
+	now := time.Now().Format(time.RFC3339)
+	ticket.CreationDate = now
+	ticket.LastUpdateDate = now
+	ticket.LastPingDate = now
+	snoozeDays := policy.Current().Match(row.RecommenderName, row.RecommenderSubtype).SnoozeDays
+	ticket.SnoozeDate = time.Now().AddDate(0,0,snoozeDays).Format(time.RFC3339)
+	ticket.UserRecommendation = false
+	channelName, err := s.threadTicketChannel(ticket, row)
 	if err != nil {
-		u.LogPrint(3, "Error creating channel for thread as ticket: %s\n", err)
 		return "", err
 	}
+
+	var channel *slack.Channel
+	if channelIDRegex.MatchString(channelName) {
+		// Post into an existing channel, I.E. one shared with another
+		// organization. The bot has to be a member already.
+		channel = &slack.Channel{}
+		channel.ID = channelName
+	} else {
+		options := s.routeOptions(ticket, row)
+		u.LogPrint(1, "Creating Channel: "+channelName)
+		channel, err = s.createNewChannel(channelName, options.Private, nil)
+		if err != nil {
+			u.LogPrint(3, "Error creating channel for thread as ticket: %s\n", err)
+			return "", err
+		}
+		s.inviteExternal(channel.ID, options)
+	}
 	// Invite users to the channel
-	_, err = s.slackClient.InviteUsersToConversation(channel.ID, ticket.Assignee...)
+	err = s.callSlack("conversations.invite", func() error {
+		_, err := s.slackClient.InviteUsersToConversation(channel.ID, ticket.Assignee...)
+		return err
+	})
 	if err != nil {
 		// If user is already in channel we should continue
 		if err.Error() != "already_in_channel" {
@@ -205,8 +237,15 @@ func (s *SlackTicketService) createThreadAsTicket(ticket *t.Ticket, row t.Recomm
 	}
 	u.LogPrint(1, "Sending Initial Message in thread")
 	// Send message to the created channel to create "ticket/thread"
-	messageOptions := slack.MsgOptionText(ticket.Subject, false)
-	_ ,timestamp, err := s.slackClient.PostMessage(channel.ID, messageOptions)
+	messageOptions := []slack.MsgOption{
+		slack.MsgOptionText(ticket.Subject, false),
+		slack.MsgOptionMetadata(ticketMetadata(row)),
+	}
+	var timestamp string
+	err = s.callSlack("chat.postMessage", func() (err error) {
+		_, timestamp, err = s.slackClient.PostMessage(channel.ID, messageOptions...)
+		return err
+	})
 	if err != nil {
 		u.LogPrint(3, "Failed to send message to channel")
 		return channel.ID, err
@@ -214,7 +253,7 @@ func (s *SlackTicketService) createThreadAsTicket(ticket *t.Ticket, row t.Recomm
 
 	ticket.IssueKey = channel.ID + "-" + timestamp
 
-	err = s.UpdateTicket(ticket, row)
+	err = s.UpdateTicket(ticket, row, t.EventCreated)
 	if err != nil {
 		u.LogPrint(3, "Failed to Update Ticket")
 		return "", err
@@ -225,18 +264,32 @@ func (s *SlackTicketService) createThreadAsTicket(ticket *t.Ticket, row t.Recomm
 
 // C = Channel, t = ThreadTimeStamp, m = message you want to send
 func (s *SlackTicketService) sendSlackMessage(c string, t string, m string) error{
+	return s.postSlackMessage(c, t, slack.MsgOptionText(m, false))
+}
+
+// sendSlackBlocks posts a Block Kit message, text is what notifications show
+func (s *SlackTicketService) sendSlackBlocks(c string, t string, text string, blocks []slack.Block) error {
+	return s.postSlackMessage(c, t, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...))
+}
+
+func (s *SlackTicketService) postSlackMessage(c string, t string, options ...slack.MsgOption) error {
 	// Send the message to the channel in which the event occurred
-	//u.LogPrint(1, "Sending message to channel: %s, timestamp: %s, with message: %s", c,t,m)
-	message := slack.MsgOptionText(m, false)
 	if !s.channelAsTicket {
-		_, _, _, err := s.slackClient.SendMessage(c, slack.MsgOptionTS(t), message)
+		options = append(options, slack.MsgOptionTS(t))
+		err := s.callSlack("chat.postMessage", func() error {
+			_, _, _, err := s.slackClient.SendMessage(c, options...)
+			return err
+		})
 		if err != nil {
 			u.LogPrint(3, "Failed to respond in thread: %v", err)
 			return err
 		}
 		return nil
 	}
-	_, _, err := s.slackClient.PostMessage(c, message)
+	err := s.callSlack("chat.postMessage", func() error {
+		_, _, err := s.slackClient.PostMessage(c, options...)
+		return err
+	})
 	if err != nil {
 		u.LogPrint(3,"Error sending message: %s\n", err)
 		return err
@@ -249,7 +302,7 @@ func (s *SlackTicketService) parseAndGetTicket(channel, timestamp string) (t.Tic
 	if !s.channelAsTicket {
 		issueKey = fmt.Sprintf("%v-%v", channel, timestamp)
 	}
-	ticket, err := b.GetTicketByIssueKey(issueKey)
+	ticket, err := s.store.GetTicket(issueKey)
 	if err != nil {
 		u.LogPrint(3, "[SLACK] Error getting ticket from Bigquery: %v", err)
 		return t.Ticket{}, err
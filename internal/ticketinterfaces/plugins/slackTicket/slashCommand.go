@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"ticketservice/internal/templates"
+	u "ticketservice/internal/utils"
+)
+
+// Commands that don't act on the ticket of the channel or thread
+var ticketlessCommands = map[string]bool{
+	"!list": true,
+	"!help": true,
+}
+
+// threadIssueKeyRegex matches the IssueKey of a thread ticket, channel-timestamp
+var threadIssueKeyRegex = regexp.MustCompile(`^[CG][A-Z0-9]{8,}-[0-9]+\.[0-9]+$`)
+
+// isSlashCommand reports whether a webhook body is a slash command,
+// which Slack form encodes like interactive payloads.
+func isSlashCommand(body []byte) bool {
+	form, err := url.ParseQuery(string(body))
+	return err == nil && form.Get("command") != ""
+}
+
+// slashCommandEvent is where a slash command posted to the webhook came from
+func slashCommandEvent(form url.Values) *commandEvent {
+	return &commandEvent{
+		Channel:      form.Get("channel_id"),
+		User:         form.Get("user_id"),
+		SlashCommand: form.Get("command"),
+		ResponseURL:  form.Get("response_url"),
+	}
+}
+
+// slashCommandTicket takes the IssueKey a slash command starts with off its
+// fields and points event at that ticket's thread. Slack never says which
+// thread a slash command was run in, so in thread mode the ticket has to be named.
+func (s *SlackTicketService) slashCommandTicket(event *commandEvent, fields []string) []string {
+	if s.channelAsTicket || len(fields) == 0 || !threadIssueKeyRegex.MatchString(fields[0]) {
+		return fields
+	}
+	event.Channel, event.ThreadTimeStamp = s.splitIssueKey(fields[0])
+	return fields[1:]
+}
+
+// handleSlashCommand runs a slash command posted to the webhook
+func (s *SlackTicketService) handleSlashCommand(body []byte) error {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to parse slash command: %v", err)
+		return err
+	}
+	return s.runSlashCommand(slashCommandEvent(form), form.Get("text"))
+}
+
+// runSlashCommand runs /reco <command> [arguments] as the ! command of
+// the same name, answering only the person who ran it. In thread mode it's
+// /reco <IssueKey> <command> [arguments].
+func (s *SlackTicketService) runSlashCommand(event *commandEvent, text string) error {
+	splitText := s.slashCommandTicket(event, strings.Fields(text))
+	if len(splitText) == 0 {
+		splitText = []string{"help"}
+	}
+	command := "!" + strings.ToLower(splitText[0])
+	splitText[0] = command
+	u.LogPrint(1, "Received slash command: %v %v", event.SlashCommand, splitText)
+	function, ok := functionMap[command]
+	if !ok {
+		u.LogPrint(1, "Command %v not found", command)
+		return s.reply(event, templates.TicketLocale(nil), "Unknown command, try %s help", event.SlashCommand)
+	}
+	if !s.channelAsTicket && event.ThreadTimeStamp == "" && !ticketlessCommands[command] {
+		// A thread ticket can't be found from the channel alone
+		return s.reply(event, templates.TicketLocale(nil), "Start %s with the IssueKey of the ticket, %s list shows them", event.SlashCommand, event.SlashCommand)
+	}
+	if err := function(s, event, splitText); err != nil {
+		u.LogPrint(3, "Something went wrong with slash command: %v", command)
+		return err
+	}
+	u.LogPrint(2, "Completed Function %v", command)
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"ticketservice/internal/queue"
+	u "ticketservice/internal/utils"
+)
+
+// Socket Mode reconnects after this long when it fails to connect, doubling up to the max
+const (
+	socketModeBaseBackoff = time.Second
+	socketModeMaxBackoff  = time.Minute
+)
+
+// slashCommandPayload is a slash command as sent over Socket Mode
+type slashCommandPayload struct {
+	slack.SlashCommand
+}
+
+// commandEvent is where the slash command came from
+func (p slashCommandPayload) commandEvent() *commandEvent {
+	return &commandEvent{
+		Channel:      p.ChannelID,
+		User:         p.UserID,
+		SlashCommand: p.Command,
+		ResponseURL:  p.ResponseURL,
+	}
+}
+
+// runSocketMode receives events, interactions and slash commands over the
+// Socket Mode websocket until ctx is done. Slack only opens the connection
+// outwards, so nothing has to reach the service.
+func (s *SlackTicketService) runSocketMode(ctx context.Context, client *socketmode.Client) {
+	go func() {
+		for evt := range client.Events {
+			s.handleSocketEvent(client, evt)
+		}
+	}()
+	backoff := socketModeBaseBackoff
+	for {
+		started := time.Now()
+		err := client.RunContext(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that stayed up for a while starts the backoff over
+		if time.Since(started) > socketModeMaxBackoff {
+			backoff = socketModeBaseBackoff
+		}
+		u.LogPrint(3, "[SLACK] Socket Mode connection failed, reconnecting in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > socketModeMaxBackoff {
+			backoff = socketModeMaxBackoff
+		}
+	}
+}
+
+// socketJobKind is the queue job a Socket Mode request is processed in
+const socketJobKind = "slack.socket"
+
+// socketJob is a Socket Mode request as it's kept on the work queue
+type socketJob struct {
+	Type    socketmode.EventType
+	Payload json.RawMessage
+}
+
+// handleSocketEvent queues a request and acks it straight away, Slack
+// retries anything not acked within 3 seconds. A request that can't be
+// queued isn't acked, so Slack delivers it again.
+func (s *SlackTicketService) handleSocketEvent(client *socketmode.Client, evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		u.LogPrint(1, "Connecting to Slack with Socket Mode")
+	case socketmode.EventTypeConnected:
+		u.LogPrint(2, "Connected to Slack with Socket Mode")
+	case socketmode.EventTypeConnectionError, socketmode.EventTypeInvalidAuth:
+		u.LogPrint(3, "[SLACK] Socket Mode %v: %v", evt.Type, evt.Data)
+	case socketmode.EventTypeEventsAPI, socketmode.EventTypeInteractive, socketmode.EventTypeSlashCommand:
+		if evt.Request == nil {
+			return
+		}
+		var eventID string
+		if evt.Type == socketmode.EventTypeEventsAPI {
+			retryNum := ""
+			if evt.Request.RetryAttempt > 0 {
+				retryNum = strconv.Itoa(evt.Request.RetryAttempt)
+			}
+			skip, id, err := s.skipEvent(evt.Request.Payload, retryNum, evt.Request.RetryReason)
+			if err != nil {
+				// It won't read any better next time
+				client.Ack(*evt.Request)
+				u.LogPrint(3, "[SLACK] Failed to read Socket Mode event: %v", err)
+				return
+			}
+			if skip {
+				client.Ack(*evt.Request)
+				return
+			}
+			eventID = id
+		}
+		if s.openSocketModal(evt.Type, evt.Request.Payload) {
+			client.Ack(*evt.Request)
+			return
+		}
+		payload, err := json.Marshal(socketJob{Type: evt.Type, Payload: evt.Request.Payload})
+		if err == nil {
+			_, err = queue.Enqueue(context.Background(), socketJobKind, payload)
+		}
+		if err != nil {
+			s.forgetEvent(eventID)
+			u.LogPrint(3, "[SLACK] Failed to queue Socket Mode %v: %v", evt.Type, err)
+			return
+		}
+		client.Ack(*evt.Request)
+	}
+}
+
+// openSocketModal opens the modal a button or slash command asks for, see
+// openReasonModal, reporting whether it was one of them.
+func (s *SlackTicketService) openSocketModal(eventType socketmode.EventType, payload json.RawMessage) bool {
+	switch eventType {
+	case socketmode.EventTypeInteractive:
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal(payload, &callback); err != nil {
+			return false
+		}
+		return s.openInteractionModal(&callback)
+	case socketmode.EventTypeSlashCommand:
+		var command slashCommandPayload
+		if err := json.Unmarshal(payload, &command); err != nil {
+			return false
+		}
+		return s.openSlashCommandModal(command.commandEvent(), command.TriggerID, command.Text)
+	}
+	return false
+}
+
+// processSocketJob runs a request the same way as when it's posted to the webhook
+func (s *SlackTicketService) processSocketJob(ctx context.Context, data []byte) error {
+	var job socketJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return err
+	}
+	switch job.Type {
+	case socketmode.EventTypeEventsAPI:
+		// The websocket is already authenticated, there's no token to check
+		event, err := slackevents.ParseEvent(job.Payload, slackevents.OptionNoVerifyToken())
+		if err != nil {
+			return err
+		}
+		if message, ok := event.InnerEvent.Data.(*slackevents.MessageEvent); ok {
+			return s.handleMessageEvent(message)
+		}
+		u.LogPrint(1, "Ignoring %v event", event.InnerEvent.Type)
+		return nil
+	case socketmode.EventTypeInteractive:
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal(job.Payload, &callback); err != nil {
+			return err
+		}
+		return s.runInteraction(&callback)
+	case socketmode.EventTypeSlashCommand:
+		var payload slashCommandPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		return s.runSlashCommand(payload.commandEvent(), payload.Text)
+	}
+	return fmt.Errorf("unexpected Socket Mode request %v", job.Type)
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+
+	"ticketservice/internal/queue"
+)
+
+// fakeSocketSlack plays Slack for Socket Mode: apps.connections.open hands
+// out a websocket that sends the envelopes it's given and collects the acks.
+type fakeSocketSlack struct {
+	server    *httptest.Server
+	envelopes chan string
+	acks      chan string
+}
+
+func newFakeSocketSlack(test *testing.T) *fakeSocketSlack {
+	f := &fakeSocketSlack{envelopes: make(chan string), acks: make(chan string, 10)}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		url := "ws" + strings.TrimPrefix(f.server.URL, "http") + "/link"
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": url})
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello"}`)); err != nil {
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				var ack socketmode.Response
+				if err := conn.ReadJSON(&ack); err != nil {
+					return
+				}
+				f.acks <- ack.EnvelopeID
+			}
+		}()
+		for {
+			select {
+			case envelope := <-f.envelopes:
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(envelope)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	})
+	f.server = httptest.NewServer(mux)
+	test.Cleanup(f.server.Close)
+	return f
+}
+
+// messageEnvelope is a message event as Slack delivers it over Socket Mode
+func messageEnvelope(envelopeID, eventID string, retryAttempt int) string {
+	return fmt.Sprintf(`{"envelope_id":%q,"type":"events_api","retry_attempt":%d,"retry_reason":"","accepts_response_payload":false,
+		"payload":{"type":"event_callback","event_id":%q,"event":{"type":"message","channel":"C123","user":"U1","text":"!status","ts":"1700000000.000100"}}}`,
+		envelopeID, retryAttempt, eventID)
+}
+
+// nextAck waits for the next envelope to be acked
+func (f *fakeSocketSlack) nextAck(test *testing.T) string {
+	select {
+	case id := <-f.acks:
+		return id
+	case <-time.After(5 * time.Second):
+		test.Fatal("no ack within 5s")
+		return ""
+	}
+}
+
+// failingQueue can't take anything, like a queue whose backend is down.
+// Each attempt is signalled on tried.
+type failingQueue struct {
+	queue.Queue
+	tried chan struct{}
+}
+
+func (q failingQueue) Enqueue(ctx context.Context, kind string, payload []byte) (*queue.Job, error) {
+	q.tried <- struct{}{}
+	return nil, errors.New("queue is down")
+}
+
+// queuedEvents takes the Socket Mode jobs off q and returns their event IDs
+func queuedEvents(test *testing.T, q queue.Queue) []string {
+	var ids []string
+	for {
+		job, err := q.Dequeue(context.Background(), time.Minute)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if job == nil {
+			return ids
+		}
+		if job.Kind != socketJobKind {
+			test.Errorf("queued a %s job, want %s", job.Kind, socketJobKind)
+		}
+		var queued socketJob
+		if err := json.Unmarshal(job.Payload, &queued); err != nil {
+			test.Fatal(err)
+		}
+		var callback struct {
+			EventID string `json:"event_id"`
+		}
+		if err := json.Unmarshal(queued.Payload, &callback); err != nil {
+			test.Fatal(err)
+		}
+		ids = append(ids, callback.EventID)
+	}
+}
+
+func TestSocketModeQueuesEventsOnce(test *testing.T) {
+	fake := newFakeSocketSlack(test)
+	memory := queue.NewMemoryQueue()
+	previous := queue.Current()
+	queue.SetCurrent(memory)
+	test.Cleanup(func() { queue.SetCurrent(previous) })
+
+	s := &SlackTicketService{eventDedup: newEventDedup(time.Hour, "")}
+	// What Init makes of SLACK_API_URL and SLACK_APP_TOKEN
+	api := slack.New("xoxb-test", slack.OptionAPIURL(fake.server.URL+"/"), slack.OptionAppLevelToken("xapp-test"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.runSocketMode(ctx, socketmode.New(api))
+
+	fake.envelopes <- messageEnvelope("env1", "Ev1", 0)
+	if id := fake.nextAck(test); id != "env1" {
+		test.Fatalf("acked %s, want env1", id)
+	}
+	if ids := queuedEvents(test, memory); strings.Join(ids, ",") != "Ev1" {
+		test.Errorf("queued %v, want Ev1", ids)
+	}
+
+	// Slack redelivers an event it didn't see acked, that's acked and dropped
+	fake.envelopes <- messageEnvelope("env2", "Ev1", 1)
+	if id := fake.nextAck(test); id != "env2" {
+		test.Fatalf("acked %s, want env2", id)
+	}
+	if ids := queuedEvents(test, memory); len(ids) != 0 {
+		test.Errorf("queued %v again", ids)
+	}
+
+	// An event that can't be queued isn't acked, so its redelivery is taken
+	failing := failingQueue{tried: make(chan struct{}, 1)}
+	queue.SetCurrent(failing)
+	fake.envelopes <- messageEnvelope("env3", "Ev2", 0)
+	select {
+	case <-failing.tried:
+	case <-time.After(5 * time.Second):
+		test.Fatal("env3 wasn't queued within 5s")
+	}
+	queue.SetCurrent(memory)
+	fake.envelopes <- messageEnvelope("env4", "Ev2", 1)
+	// Envelopes are handled in order, an ack of env3 would come first
+	if id := fake.nextAck(test); id != "env4" {
+		test.Fatalf("acked %s, want env4", id)
+	}
+	if ids := queuedEvents(test, memory); strings.Join(ids, ",") != "Ev2" {
+		test.Errorf("queued %v, want Ev2", ids)
+	}
+}
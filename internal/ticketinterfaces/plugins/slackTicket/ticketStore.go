@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	b "ticketservice/internal/bigqueryfunctions"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// ticketStore is where commands read tickets and save what they change.
+// bigQueryStore keeps them in the ticket and history tables, a fake can
+// stand in for them when exercising commands.
+type ticketStore interface {
+	GetTicket(issueKey string) (*t.Ticket, error)
+	GetTicketSubtype(ticket *t.Ticket) (string, error)
+	AppendTickets(tickets []*t.Ticket) error
+	AppendHistory(entries []*t.TicketHistory) error
+	SuppressResource(targetResource, subtype, reason, owner string) error
+	LiftResourceSuppressions(targetResource, subtype string) error
+}
+
+// bigQueryStore is the ticketStore of the ticket and history tables
+type bigQueryStore struct{}
+
+func (bigQueryStore) GetTicket(issueKey string) (*t.Ticket, error) {
+	return b.GetTicketByIssueKey(issueKey)
+}
+
+func (bigQueryStore) GetTicketSubtype(ticket *t.Ticket) (string, error) {
+	return b.GetTicketSubtype(ticket)
+}
+
+func (bigQueryStore) AppendTickets(tickets []*t.Ticket) error {
+	return b.AppendTicketsToTable("", tickets)
+}
+
+func (bigQueryStore) AppendHistory(entries []*t.TicketHistory) error {
+	return b.AppendHistory("", entries)
+}
+
+func (bigQueryStore) SuppressResource(targetResource, subtype, reason, owner string) error {
+	return b.SuppressResource("", targetResource, subtype, reason, owner)
+}
+
+func (bigQueryStore) LiftResourceSuppressions(targetResource, subtype string) error {
+	return b.LiftResourceSuppressions("", targetResource, subtype)
+}
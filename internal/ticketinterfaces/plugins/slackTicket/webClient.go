@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const defaultSlackAPIURL = "https://slack.com/api/"
+
+// webClient is the Slack client plus the Web API methods it doesn't have.
+// Those report rate limiting the way the client does, so the limiter treats
+// every call alike.
+type webClient struct {
+	*slack.Client
+	apiURL     string
+	token      string
+	httpClient *http.Client
+}
+
+func newWebClient(client *slack.Client, apiURL string, token string) *webClient {
+	return &webClient{
+		Client:     client,
+		apiURL:     apiURL,
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// InviteShared invites people outside the workspace to a channel with
+// Slack Connect.
+func (c *webClient) InviteShared(channelID string, emails []string) error {
+	return c.post("conversations.inviteShared", url.Values{
+		"channel": {channelID},
+		"emails":  {strings.Join(emails, ",")},
+	})
+}
+
+// post calls a Web API method. An HTTP 429 comes back as a
+// *slack.RateLimitedError carrying Retry-After, an ok:false as its error code.
+func (c *webClient) post(method string, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost, c.apiURL+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Without a usable header the limiter falls back to its own backoff
+		retryAfter, _ := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64)
+		return &slack.RateLimitedError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s: %s: %w", method, resp.Status, err)
+	}
+	if !result.OK {
+		return errors.New(result.Error)
+	}
+	return nil
+}
@@ -21,25 +21,114 @@ import (
 	"strings"
 	"time"
 
+	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 
 	t "ticketservice/internal/ticketinterfaces"
+	"ticketservice/internal/authz"
 	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/locale"
+	"ticketservice/internal/policy"
+	"ticketservice/internal/templates"
 	u "ticketservice/internal/utils"
 )
 
-var functionMap = map[string]func(*SlackTicketService, *slackevents.MessageEvent, []string) error{
+// commandEvent is where a command came from, a message, a button or a slash command
+type commandEvent struct {
+	Channel         string
+	ThreadTimeStamp string
+	User            string
+	// Slash commands are answered privately through their response URL
+	SlashCommand string
+	ResponseURL  string
+}
+
+// messageCommandEvent is the command typed in a message
+func messageCommandEvent(event *slackevents.MessageEvent) *commandEvent {
+	return &commandEvent{
+		Channel:         event.Channel,
+		ThreadTimeStamp: event.ThreadTimeStamp,
+		User:            event.User,
+	}
+}
+
+var functionMap = map[string]func(*SlackTicketService, *commandEvent, []string) error{
 	// All commands should be lower case.
 	"!snooze": snoozeFunction,
-	"!close": completeFunction,
+	"!close": closeFunction,
 	"!complete": completeFunction,
+	"!assign": assignFunction,
+	"!status": statusFunction,
+	"!list": listFunction,
+	"!help": helpFunction,
+	"!dismiss": dismissFunction,
+	"!reopen": reopenFunction,
+	"!comment": commentFunction,
+}
+
+// respond posts to where the command came from, privately for slash commands
+func (s *SlackTicketService) respond(event *commandEvent, options ...slack.MsgOption) error {
+	if event.ResponseURL == "" {
+		return s.postSlackMessage(event.Channel, event.ThreadTimeStamp, options...)
+	}
+	options = append(options, slack.MsgOptionResponseURL(event.ResponseURL, slack.ResponseTypeEphemeral))
+	err := s.callSlack("response_url", func() error {
+		_, _, err := s.slackClient.PostMessage(event.Channel, options...)
+		return err
+	})
+	if err != nil {
+		u.LogPrint(3, "Failed to respond to slash command: %v", err)
+	}
+	return err
+}
+
+// reply answers a command with a message translated to loc
+func (s *SlackTicketService) reply(event *commandEvent, loc, message string, args ...interface{}) error {
+	return s.respond(event, slack.MsgOptionText(locale.Sprintf(loc, message, args...), false))
+}
+
+// replyWithEvent answers a command with the message of a ticket event.
+// Once a change is saved handlers ignore what it returns, the failure is
+// already logged and a retry of the job would save the change again.
+func (s *SlackTicketService) replyWithEvent(event *commandEvent, ticket *t.Ticket, name string) error {
+	message, err := templates.Render(name, t.RecommendationQueryResult{}, ticket)
+	if err != nil {
+		u.LogPrint(3, "[SLACK] Failed to render %s template: %v", name, err)
+		return s.reply(event, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	return s.respond(event, slack.MsgOptionText(message, false))
 }
 
-func snoozeFunction(s *SlackTicketService, event *slackevents.MessageEvent, splitText []string) error {
+// authorize checks the user behind a command may take action on the
+// ticket, telling them why not when they may not.
+func (s *SlackTicketService) authorize(event *commandEvent, ticket *t.Ticket, action string) bool {
+	err := authz.Authorize(event.User, action, ticket)
+	if err == nil {
+		return true
+	}
+	loc := templates.TicketLocale(ticket)
+	reason := err.Error()
+	if denied, ok := err.(*authz.DeniedError); ok {
+		reason = locale.Sprintf(loc, denied.Reason)
+	}
+	s.reply(event, loc, "Sorry, you can't %s: %s", locale.Sprintf(loc, action), reason)
+	return false
+}
+
+func snoozeFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	// Replies are in the ticket's language, so find it first
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "snooze this ticket") {
+		return nil
+	}
+	loc := templates.TicketLocale(&ticket)
 	if len(splitText) < 2 {
 		u.LogPrint(1, "Did not recieve enough arguments for Snooze. IE. !Snooze for x days")
 		// Send a message response here.
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Not enough arguments")
+		return s.reply(event, loc, "Not enough arguments")
 	}
 	
 	response := strings.Join(splitText[1:], " ")
@@ -55,7 +144,7 @@ func snoozeFunction(s *SlackTicketService, event *slackevents.MessageEvent, spli
 	if len(valueMatches) < 2 || len(unitMatches) < 2 {
 		u.LogPrint(2, "Failed to extract duration from the response")
 		// Send a message response here.
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Invalid duration format")
+		return s.reply(event, loc, "Invalid duration format")
 	}
 
 	// Parse the numeric value from the matches
@@ -63,7 +152,7 @@ func snoozeFunction(s *SlackTicketService, event *slackevents.MessageEvent, spli
 	if err != nil {
 		u.LogPrint(2, "Failed to parse duration value:", err)
 		// Send a message response here.
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Invalid duration format")
+		return s.reply(event, loc, "Invalid duration format")
 	}
 
 	// Convert the duration unit to lowercase for consistency
@@ -81,7 +170,7 @@ func snoozeFunction(s *SlackTicketService, event *slackevents.MessageEvent, spli
 	default:
 		u.LogPrint(2, "Invalid duration unit")
 		// Send a message response here.
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Invalid duration unit")
+		return s.reply(event, loc, "Invalid duration unit")
 	}
 
 	// Calculate the total duration based on the value and the time unit
@@ -89,35 +178,376 @@ func snoozeFunction(s *SlackTicketService, event *slackevents.MessageEvent, spli
 
 	// Now you have the parsed duration as a time.Duration object
 	u.LogPrint(2, "Parsed duration:", duration)
-	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
-	if err != nil {
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Something went wrong getting ticket")
+	return s.snoozeTicket(event, &ticket, duration, "", "")
+}
+
+// saveTicket writes the new state of the ticket and what happened to its history
+func (s *SlackTicketService) saveTicket(event *commandEvent, ticket *t.Ticket, action string) error {
+	ticket.LastUpdateDate = time.Now().Format(time.RFC3339)
+	if err := s.store.AppendTickets([]*t.Ticket{ticket}); err != nil {
+		u.LogPrint(3, "[SLACK] Something went wrong updating ticket in BQ: %v", err)
+		return err
+	}
+	entry := &t.TicketHistory{
+		IssueKey: ticket.IssueKey,
+		Event:    action,
+		User:     event.User,
+		Reason:   ticket.Reason,
+		Comment:  ticket.Comment,
+	}
+	if err := s.store.AppendHistory([]*t.TicketHistory{entry}); err != nil {
+		// The ticket is already saved, a missing history entry isn't worth failing for
+		u.LogPrint(3, "[SLACK] Something went wrong recording ticket history in BQ: %v", err)
 	}
+	return nil
+}
+
+// snoozeTicket snoozes the ticket for duration, recording why
+func (s *SlackTicketService) snoozeTicket(event *commandEvent, ticket *t.Ticket, duration time.Duration, reason, comment string) error {
 	ticket.SnoozeDate = time.Now().Add(duration).Format(time.RFC3339)
-	ticket.LastUpdateDate = time.Now().Format(time.RFC3339)
 	ticket.Status = "Snoozed"
-	if err := b.AppendTicketsToTable("", []*t.Ticket{&ticket}); err != nil {
-		u.LogPrint(3, "[SLACK] Something went wrong updating ticket in BQ: %v", err)
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Something went wrong")
+	ticket.Reason = reason
+	ticket.Comment = comment
+	if err := s.saveTicket(event, ticket, t.EventSnoozed); err != nil {
+		return s.reply(event, templates.TicketLocale(ticket), "Something went wrong")
 	}
-	
-	return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, fmt.Sprintf("Snoozed Until: %s", ticket.SnoozeDate))
+	s.replyWithEvent(event, ticket, t.EventSnoozed)
+	return nil
+}
+
+// closeFunction closes the ticket without it being resolved
+func closeFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	return s.closeTicketFromCommand(event, t.EventClosed)
+}
+
+// completeFunction closes the ticket because the recommendation was acted on
+func completeFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	return s.closeTicketFromCommand(event, t.EventResolved)
 }
 
-func completeFunction(s *SlackTicketService, event *slackevents.MessageEvent, splitText []string) error {
+func (s *SlackTicketService) closeTicketFromCommand(event *commandEvent, ticketEvent string) error {
 
 	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
 	if err != nil {
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Something went wrong getting ticket")
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "close this ticket") {
+		return nil
 	}
+	return s.closeTicket(event, &ticket, ticketEvent, "", "")
+}
 
-	ticket.LastUpdateDate = time.Now().Format(time.RFC3339)
+// closeTicket closes the ticket, recording why
+func (s *SlackTicketService) closeTicket(event *commandEvent, ticket *t.Ticket, ticketEvent, reason, comment string) error {
 	ticket.Status = "Closed"
+	ticket.Reason = reason
+	ticket.Comment = comment
+	if err := s.saveTicket(event, ticket, ticketEvent); err != nil {
+		return s.reply(event, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	// The reply goes first, an archived channel takes no more messages
+	s.replyWithEvent(event, ticket, ticketEvent)
+	if err := s.closeConversation(ticket.IssueKey); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to close %s in Slack: %v", ticket.IssueKey, err)
+	}
+	return nil
+}
+
+// dismissTicket closes the ticket for good. The recommendation is suppressed
+// for the resource, owned by whoever dismissed it, so it won't come back
+// until the ticket is reopened or the suppression is lifted.
+func (s *SlackTicketService) dismissTicket(event *commandEvent, ticket *t.Ticket, reason, comment string) error {
+	subtype, err := s.store.GetTicketSubtype(ticket)
+	if err != nil {
+		// Without the subtype every recommendation for the resource is suppressed
+		u.LogPrint(2, "[SLACK] Failed to look up the recommendation of %s: %v", ticket.IssueKey, err)
+	}
+	suppressionReason := strings.TrimSpace(reason + " " + comment)
+	if err := s.store.SuppressResource(ticket.TargetResource, subtype, suppressionReason, event.User); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to suppress the recommendation of %s: %v", ticket.IssueKey, err)
+		return s.reply(event, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	ticket.Status = "Dismissed"
+	ticket.Reason = reason
+	ticket.Comment = comment
+	if err := s.saveTicket(event, ticket, t.EventDismissed); err != nil {
+		return s.reply(event, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	s.replyWithEvent(event, ticket, t.EventDismissed)
+	if err := s.closeConversation(ticket.IssueKey); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to close %s in Slack: %v", ticket.IssueKey, err)
+	}
+	return nil
+}
+
+// dismissFunction dismisses the recommendation for the resource with a
+// reason, I.E. !dismiss planned moving to a new machine type next quarter.
+// The button and the slash command without arguments open the dismiss modal instead.
+func dismissFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "dismiss this ticket") {
+		return nil
+	}
+	if len(splitText) < 2 || reasonLabels[strings.ToLower(splitText[1])] == "" {
+		u.LogPrint(1, "Did not recieve a reason for Dismiss. IE. !dismiss planned")
+		return s.reply(event, templates.TicketLocale(&ticket), "Give a reason: %s", strings.Join(t.Reasons, ", "))
+	}
+	return s.dismissTicket(event, &ticket, strings.ToLower(splitText[1]), strings.Join(splitText[2:], " "))
+}
 
-	if err := b.AppendTicketsToTable("", []*t.Ticket{&ticket}); err != nil {
+// reopenFunction reopens a closed or dismissed ticket, the next reminder
+// follows the usual snooze days.
+func reopenFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "reopen this ticket") {
+		return nil
+	}
+	if ticket.Status != "Closed" && ticket.Status != "Dismissed" {
+		return s.reply(event, templates.TicketLocale(&ticket), "This ticket is not closed")
+	}
+	if err := s.reopenConversation(ticket.IssueKey); err != nil {
+		u.LogPrint(3, "[SLACK] Failed to reopen %s in Slack: %v", ticket.IssueKey, err)
+		return s.reply(event, templates.TicketLocale(&ticket), "Something went wrong")
+	}
+	subtype, err := s.store.GetTicketSubtype(&ticket)
+	if err != nil {
+		u.LogPrint(2, "[SLACK] Failed to look up the recommendation of %s: %v", ticket.IssueKey, err)
+	}
+	if ticket.Status == "Dismissed" {
+		// Otherwise the suppression keeps the reopened ticket from any reminder
+		if err := s.store.LiftResourceSuppressions(ticket.TargetResource, subtype); err != nil {
+			u.LogPrint(3, "[SLACK] Failed to lift the suppression of %s: %v", ticket.IssueKey, err)
+			return s.reply(event, templates.TicketLocale(&ticket), "Something went wrong")
+		}
+	}
+	snoozeDays := policy.Current().Match(ticket.RecommenderID, subtype).SnoozeDays
+	ticket.SnoozeDate = time.Now().AddDate(0, 0, snoozeDays).Format(time.RFC3339)
+	ticket.Status = "Reopened"
+	ticket.Reason = ""
+	ticket.Comment = ""
+	if err := s.saveTicket(event, &ticket, t.EventReopened); err != nil {
+		return s.reply(event, templates.TicketLocale(&ticket), "Something went wrong")
+	}
+	s.replyWithEvent(event, &ticket, t.EventReopened)
+	return nil
+}
+
+// commentFunction records a note in the ticket history, I.E. !comment waiting on the vendor
+func commentFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "comment on this ticket") {
+		return nil
+	}
+	loc := templates.TicketLocale(&ticket)
+	comment := strings.TrimSpace(strings.Join(splitText[1:], " "))
+	if comment == "" {
+		u.LogPrint(1, "Did not recieve a comment. IE. !comment waiting on the vendor")
+		return s.reply(event, loc, "Not enough arguments")
+	}
+	entry := &t.TicketHistory{
+		IssueKey: ticket.IssueKey,
+		Event:    t.EventCommented,
+		User:     event.User,
+		Comment:  comment,
+	}
+	if err := s.store.AppendHistory([]*t.TicketHistory{entry}); err != nil {
+		u.LogPrint(3, "[SLACK] Something went wrong recording ticket history in BQ: %v", err)
+		return s.reply(event, loc, "Something went wrong")
+	}
+	// Recorded, a retry would record it twice
+	s.reply(event, loc, "Comment recorded")
+	return nil
+}
+
+var mentionRegex = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|[^>]*)?>`)
+
+// Slack user IDs, anything else doesn't belong in a query
+var userIDRegex = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+
+// mentions formats user IDs as Slack mentions
+func mentions(users []string) string {
+	formatted := make([]string, len(users))
+	for i, user := range users {
+		formatted[i] = "<@" + user + ">"
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// ticketDate formats a date read from BigQuery for loc, falling back to the raw value
+func ticketDate(loc, value string) string {
+	date, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return value
+	}
+	return locale.Date(loc, date) + " (" + locale.RelativeDate(loc, date, time.Now()) + ")"
+}
+
+// assignFunction reassigns the ticket to the mentioned users and invites them
+func assignFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	if !s.authorize(event, &ticket, "assign this ticket") {
+		return nil
+	}
+	loc := templates.TicketLocale(&ticket)
+	var users []string
+	for _, match := range mentionRegex.FindAllStringSubmatch(strings.Join(splitText[1:], " "), -1) {
+		users = append(users, match[1])
+	}
+	if len(users) == 0 {
+		u.LogPrint(1, "Did not recieve anyone to assign. IE. !assign @user")
+		return s.reply(event, loc, "Mention who to assign, I.E. !assign @user")
+	}
+	channel, _ := s.splitIssueKey(ticket.IssueKey)
+	err = s.callSlack("conversations.invite", func() error {
+		_, err := s.slackClient.InviteUsersToConversation(channel, users...)
+		return err
+	})
+	if err != nil && err.Error() != "already_in_channel" {
+		u.LogPrint(3, "[SLACK] Failed to invite users to channel: %v", err)
+		return s.reply(event, loc, "Something went wrong")
+	}
+	ticket.Assignee = users
+	ticket.LastUpdateDate = time.Now().Format(time.RFC3339)
+	if err := s.store.AppendTickets([]*t.Ticket{&ticket}); err != nil {
 		u.LogPrint(3, "[SLACK] Something went wrong updating ticket in BQ: %v", err)
-		return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, "Something went wrong")
+		return s.reply(event, loc, "Something went wrong")
 	}
-	
-	return s.sendSlackMessage(event.Channel, event.ThreadTimeStamp, fmt.Sprintf("This ticket has been closed"))
+	entry := &t.TicketHistory{
+		IssueKey: ticket.IssueKey,
+		Event:    t.EventAssigned,
+		User:     event.User,
+		Comment:  strings.Join(users, ", "),
+	}
+	if err := s.store.AppendHistory([]*t.TicketHistory{entry}); err != nil {
+		u.LogPrint(3, "[SLACK] Something went wrong recording ticket history in BQ: %v", err)
+	}
+	// Saved, a retry would save it twice
+	s.reply(event, loc, "Assigned to %s", mentions(users))
+	return nil
+}
+
+// statusFunction shows the state of the ticket
+func statusFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	ticket, err := s.parseAndGetTicket(event.Channel, event.ThreadTimeStamp)
+	if err != nil {
+		return s.reply(event, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	loc := templates.TicketLocale(&ticket)
+	lines := []string{
+		"*" + ticket.Subject + "*",
+		locale.Sprintf(loc, "Status: %s", ticket.Status),
+		locale.Sprintf(loc, "Assigned to: %s", mentions(ticket.Assignee)),
+		locale.Sprintf(loc, "Created: %s", ticketDate(loc, ticket.CreationDate)),
+		locale.Sprintf(loc, "Next reminder: %s", ticketDate(loc, ticket.SnoozeDate)),
+		locale.Sprintf(loc, "Recommender: %s", ticket.RecommenderID),
+	}
+	if ticket.Reason != "" {
+		lines = append(lines, locale.Sprintf(loc, "Reason: %s", locale.Sprintf(loc, reasonLabels[ticket.Reason])))
+	}
+	if ticket.Comment != "" {
+		lines = append(lines, locale.Sprintf(loc, "Comment: %s", ticket.Comment))
+	}
+	if ticket.TargetResource != "" {
+		lines = append(lines, locale.Sprintf(loc, "Resource: %s", fmt.Sprintf("<%s|%s>",
+			templates.ConsoleURL(ticket.TargetResource),
+			templates.ShortResource(ticket.TargetResource))))
+		// The recommendation may have gone from the export since, the ticket is still worth showing
+		row, err := b.GetRecommendation(ticket.TargetResource, ticket.RecommenderID)
+		if err != nil {
+			u.LogPrint(2, "[SLACK] Could not get recommendation of ticket %v: %v", ticket.IssueKey, err)
+		} else {
+			lines = append(lines, locale.Sprintf(loc, "Recommendation type: %s", row.RecommenderSubtype))
+			if row.ImpactCostUnit != 0 {
+				lines = append(lines, locale.Sprintf(loc, "Savings: %s",
+					locale.Currency(loc, float64(row.ImpactCostUnit), row.ImpactCurrencyCode)))
+			}
+			lines = append(lines, locale.Sprintf(loc, "Details: %s", row.Description))
+		}
+	}
+	return s.respond(event, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+}
+
+// Longest list we post, Slack truncates long messages anyway
+const maxListedTickets = 20
+
+// listFunction lists the open tickets assigned to whoever asked
+func listFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	loc := templates.TicketLocale(nil)
+	if !userIDRegex.MatchString(event.User) {
+		u.LogPrint(3, "[SLACK] Unexpected user ID: %v", event.User)
+		return s.reply(event, loc, "Something went wrong")
+	}
+	tickets, err := b.GetOpenTicketsByAssignee(event.User)
+	if err != nil {
+		return s.reply(event, loc, "Something went wrong")
+	}
+	if len(tickets) == 0 {
+		return s.reply(event, loc, "You have no open tickets")
+	}
+	lines := []string{locale.Sprintf(loc, "Your open tickets:")}
+	for i, ticket := range tickets {
+		if i == maxListedTickets {
+			lines = append(lines, locale.Sprintf(loc, "...and %d more", len(tickets)-maxListedTickets))
+			break
+		}
+		channel, _ := s.splitIssueKey(ticket.IssueKey)
+		line := fmt.Sprintf("• <#%s> %s (%s)", channel, ticket.Subject, ticket.Status)
+		if !s.channelAsTicket {
+			// What a slash command needs to find the thread
+			line += fmt.Sprintf(" `%s`", ticket.IssueKey)
+		}
+		lines = append(lines, line)
+	}
+	return s.respond(event, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+}
+
+// commandHelp describes the commands for !help, in the order they are listed
+var commandHelp = []struct {
+	usage       string
+	description string
+}{
+	{"snooze for <n> days|months|years", "Snooze the ticket"},
+	{"close", "Close the ticket without resolving it"},
+	{"complete", "Close the ticket as resolved"},
+	{"dismiss <reason> [comment]", "Dismiss the recommendation for this resource for good, saying why"},
+	{"reopen", "Reopen a closed ticket"},
+	{"comment <text>", "Record a note in the ticket history"},
+	{"assign @user", "Reassign the ticket and invite the user"},
+	{"status", "Show the state of the ticket"},
+	{"list", "List your open tickets"},
+	{"help", "List the commands"},
+}
+
+// helpFunction lists the commands, as slash commands when asked with one
+func helpFunction(s *SlackTicketService, event *commandEvent, splitText []string) error {
+	loc := templates.TicketLocale(nil)
+	prefix := "!"
+	if event.SlashCommand != "" {
+		prefix = event.SlashCommand + " "
+	}
+	lines := []string{locale.Sprintf(loc, "Commands:")}
+	for _, command := range commandHelp {
+		commandPrefix := prefix
+		if event.SlashCommand != "" && !s.channelAsTicket && !ticketlessCommands["!"+strings.Fields(command.usage)[0]] {
+			// Slash commands name the thread ticket they're for
+			commandPrefix += "<IssueKey> "
+		}
+		lines = append(lines, fmt.Sprintf("`%s%s` %s", commandPrefix, command.usage, locale.Sprintf(loc, command.description)))
+	}
+	return s.respond(event, slack.MsgOptionText(strings.Join(lines, "\n"), false))
 }
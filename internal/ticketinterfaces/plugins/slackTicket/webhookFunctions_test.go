@@ -0,0 +1,412 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+
+	"ticketservice/internal/authz"
+	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// fakeSlack records what the plugin asks of Slack
+type fakeSlack struct {
+	posted     []string
+	archived   []string
+	unarchived []string
+	invited    []string
+	views      []slack.ModalViewRequest
+	purposes   []string
+	// What conversations.list returns
+	channels []slack.Channel
+}
+
+func (f *fakeSlack) AuthTest() (*slack.AuthTestResponse, error) {
+	return &slack.AuthTestResponse{UserID: "UBOT", BotID: "BBOT"}, nil
+}
+
+func (f *fakeSlack) CreateConversation(params slack.CreateConversationParams) (*slack.Channel, error) {
+	for _, existing := range f.channels {
+		if existing.Name == params.ChannelName {
+			return nil, errors.New("name_taken")
+		}
+	}
+	channel := &slack.Channel{}
+	channel.ID = "CNEW"
+	channel.Name = params.ChannelName
+	return channel, nil
+}
+
+func (f *fakeSlack) ArchiveConversation(channelID string) error {
+	f.archived = append(f.archived, channelID)
+	return nil
+}
+
+func (f *fakeSlack) UnArchiveConversation(channelID string) error {
+	f.unarchived = append(f.unarchived, channelID)
+	return nil
+}
+
+func (f *fakeSlack) RenameConversation(channelID, channelName string) (*slack.Channel, error) {
+	channel := &slack.Channel{}
+	channel.ID = channelID
+	channel.Name = channelName
+	return channel, nil
+}
+
+func (f *fakeSlack) SetPurposeOfConversation(channelID, purpose string) (*slack.Channel, error) {
+	f.purposes = append(f.purposes, purpose)
+	channel := &slack.Channel{}
+	channel.ID = channelID
+	channel.Purpose.Value = purpose
+	return channel, nil
+}
+
+func (f *fakeSlack) GetConversationInfo(input *slack.GetConversationInfoInput) (*slack.Channel, error) {
+	channel := &slack.Channel{}
+	channel.ID = input.ChannelID
+	channel.Name = "ticket"
+	return channel, nil
+}
+
+func (f *fakeSlack) InviteUsersToConversation(channelID string, users ...string) (*slack.Channel, error) {
+	f.invited = append(f.invited, users...)
+	return &slack.Channel{}, nil
+}
+
+func (f *fakeSlack) GetConversations(params *slack.GetConversationsParameters) ([]slack.Channel, string, error) {
+	return f.channels, "", nil
+}
+
+func (f *fakeSlack) GetConversationHistory(params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	return &slack.GetConversationHistoryResponse{}, nil
+}
+
+func (f *fakeSlack) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return "", "", err
+	}
+	f.posted = append(f.posted, values.Get("text"))
+	return channelID, "1700000000.000100", nil
+}
+
+func (f *fakeSlack) SendMessage(channel string, options ...slack.MsgOption) (string, string, string, error) {
+	_, timestamp, err := f.PostMessage(channel, options...)
+	return channel, timestamp, "", err
+}
+
+func (f *fakeSlack) OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error) {
+	if triggerID == "" {
+		return nil, errors.New("invalid_trigger_id")
+	}
+	f.views = append(f.views, view)
+	return &slack.ViewResponse{}, nil
+}
+
+func (f *fakeSlack) GetUserByEmail(email string) (*slack.User, error) {
+	return nil, errors.New("users_not_found")
+}
+
+func (f *fakeSlack) AddReaction(name string, item slack.ItemRef) error { return nil }
+
+func (f *fakeSlack) RemoveReaction(name string, item slack.ItemRef) error { return nil }
+
+func (f *fakeSlack) InviteShared(channelID string, emails []string) error { return nil }
+
+// fakeStore holds a single ticket and records what the commands save
+type fakeStore struct {
+	ticket       t.Ticket
+	saved        []*t.Ticket
+	history      []*t.TicketHistory
+	suppressions []*t.Suppression
+	lifted       []string
+}
+
+func (f *fakeStore) GetTicket(issueKey string) (*t.Ticket, error) {
+	if issueKey != f.ticket.IssueKey {
+		return nil, b.ErrTicketNotFound
+	}
+	ticket := f.ticket
+	return &ticket, nil
+}
+
+func (f *fakeStore) GetTicketSubtype(ticket *t.Ticket) (string, error) {
+	return "CHANGE_MACHINE_TYPE", nil
+}
+
+func (f *fakeStore) AppendTickets(tickets []*t.Ticket) error {
+	f.saved = append(f.saved, tickets...)
+	return nil
+}
+
+func (f *fakeStore) AppendHistory(entries []*t.TicketHistory) error {
+	f.history = append(f.history, entries...)
+	return nil
+}
+
+func (f *fakeStore) SuppressResource(targetResource, subtype, reason, owner string) error {
+	f.suppressions = append(f.suppressions, &t.Suppression{TargetResource: targetResource, RecommenderSubtype: subtype, Reason: reason, Owner: owner})
+	return nil
+}
+
+func (f *fakeStore) LiftResourceSuppressions(targetResource, subtype string) error {
+	f.lifted = append(f.lifted, targetResource+" "+subtype)
+	return nil
+}
+
+// useTestTemplates renders every event as its name and the IssueKey
+func useTestTemplates(test *testing.T) {
+	dir := test.TempDir()
+	defaults := templates.Paths{}
+	for _, kind := range templates.Kinds {
+		path := filepath.Join(dir, kind+".txt")
+		if err := os.WriteFile(path, []byte(kind+" {{.Ticket.IssueKey}}"), 0o644); err != nil {
+			test.Fatal(err)
+		}
+		defaults[kind] = path
+	}
+	library, problems := templates.Load(defaults, nil, nil, nil)
+	if len(problems) > 0 {
+		test.Fatalf("loading templates: %v", problems)
+	}
+	previous := templates.Current()
+	templates.SetCurrent(library)
+	test.Cleanup(func() { templates.SetCurrent(previous) })
+}
+
+// newCommandTest returns a channel ticket service backed by fakes, with
+// authorization on and UOWNER assigned to ticket C123 in status.
+func newCommandTest(test *testing.T, status string) (*SlackTicketService, *fakeSlack, *fakeStore) {
+	slackFake := &fakeSlack{}
+	store := &fakeStore{ticket: t.Ticket{
+		IssueKey:       "C123",
+		Status:         status,
+		Assignee:       []string{"UOWNER"},
+		TargetContact:  "team",
+		TargetResource: "//compute.googleapis.com/projects/p/zones/z/instances/vm-1",
+		RecommenderID:  "google.compute.instance.MachineTypeRecommender",
+	}}
+	s := &SlackTicketService{slackClient: slackFake, channelAsTicket: true, store: store}
+	s.limiter = s.newSlackLimiter()
+	s.channels = newChannelCache(defaultChannelCacheTTL)
+
+	useTestTemplates(test)
+	authz.SetCurrent(&authz.Rules{Enabled: true})
+	authz.SetRecorder(store.AppendHistory)
+	// No route owners, only the assignee may act
+	b.SetRoutingCache(&b.RoutingCache{})
+	test.Cleanup(func() {
+		authz.SetCurrent(nil)
+		authz.SetRecorder(nil)
+		b.SetRoutingCache(nil)
+	})
+	return s, slackFake, store
+}
+
+// runCommand runs a command typed in the ticket's channel
+func runCommand(test *testing.T, s *SlackTicketService, user, text string) {
+	splitText := strings.Split(text, " ")
+	function, ok := functionMap[splitText[0]]
+	if !ok {
+		test.Fatalf("no command %s", splitText[0])
+	}
+	if err := function(s, &commandEvent{Channel: "C123", User: user}, splitText); err != nil {
+		test.Fatalf("%s: unexpected error: %v", text, err)
+	}
+}
+
+func TestCommandsChangeTicket(test *testing.T) {
+	tests := []struct {
+		text       string
+		status     string
+		wantStatus string
+		// Empty when the command writes no history
+		wantEvent string
+		wantReply string
+	}{
+		{"!snooze 3 days", "New", "Snoozed", t.EventSnoozed, "snoozed C123"},
+		{"!close", "New", "Closed", t.EventClosed, "closed C123"},
+		{"!dismiss planned moving next quarter", "New", "Dismissed", t.EventDismissed, "dismissed C123"},
+		{"!reopen", "Closed", "Reopened", t.EventReopened, "reopened C123"},
+		{"!assign <@U2>", "New", "New", t.EventAssigned, "Assigned to <@U2>"},
+		{"!comment waiting on the vendor", "New", "", t.EventCommented, "Comment recorded"},
+	}
+	for _, tt := range tests {
+		test.Run(tt.text, func(test *testing.T) {
+			s, slackFake, store := newCommandTest(test, tt.status)
+			runCommand(test, s, "UOWNER", tt.text)
+
+			if tt.wantStatus == "" {
+				if len(store.saved) != 0 {
+					test.Errorf("saved %d ticket rows, want none", len(store.saved))
+				}
+			} else if len(store.saved) != 1 {
+				test.Fatalf("saved %d ticket rows, want 1", len(store.saved))
+			} else if store.saved[0].Status != tt.wantStatus {
+				test.Errorf("saved status %q, want %q", store.saved[0].Status, tt.wantStatus)
+			}
+
+			if tt.wantEvent == "" {
+				if len(store.history) != 0 {
+					test.Errorf("recorded %d history rows, want none", len(store.history))
+				}
+			} else if len(store.history) != 1 {
+				test.Fatalf("recorded %d history rows, want 1", len(store.history))
+			} else if entry := store.history[0]; entry.Event != tt.wantEvent || entry.User != "UOWNER" || entry.IssueKey != "C123" {
+				test.Errorf("recorded %s by %s on %s, want %s by UOWNER on C123", entry.Event, entry.User, entry.IssueKey, tt.wantEvent)
+			}
+
+			if len(slackFake.posted) != 1 || slackFake.posted[0] != tt.wantReply {
+				test.Errorf("replied %q, want %q", slackFake.posted, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestCommandDetails(test *testing.T) {
+	s, slackFake, store := newCommandTest(test, "New")
+	runCommand(test, s, "UOWNER", "!dismiss planned moving next quarter")
+	if saved := store.saved[0]; saved.Reason != t.ReasonPlanned || saved.Comment != "moving next quarter" {
+		test.Errorf("dismissed with reason %q and comment %q", saved.Reason, saved.Comment)
+	}
+	if len(slackFake.archived) != 1 || slackFake.archived[0] != "C123" {
+		test.Errorf("archived %v, want the ticket channel", slackFake.archived)
+	}
+	if len(store.suppressions) != 1 {
+		test.Fatalf("created %d suppressions, want 1", len(store.suppressions))
+	}
+	want := t.Suppression{
+		TargetResource:     "//compute.googleapis.com/projects/p/zones/z/instances/vm-1",
+		RecommenderSubtype: "CHANGE_MACHINE_TYPE",
+		Reason:             "planned moving next quarter",
+		Owner:              "UOWNER",
+	}
+	if got := store.suppressions[0]; got.TargetResource != want.TargetResource || got.RecommenderSubtype != want.RecommenderSubtype || got.Reason != want.Reason || got.Owner != want.Owner {
+		test.Errorf("suppressed %v, want %v", got, &want)
+	}
+
+	s, slackFake, store = newCommandTest(test, "New")
+	runCommand(test, s, "UOWNER", "!assign <@U2> <@U3|someone>")
+	if assignee := store.saved[0].Assignee; strings.Join(assignee, ",") != "U2,U3" {
+		test.Errorf("assigned %v, want U2 and U3", assignee)
+	}
+	if strings.Join(slackFake.invited, ",") != "U2,U3" {
+		test.Errorf("invited %v, want U2 and U3", slackFake.invited)
+	}
+	if comment := store.history[0].Comment; comment != "U2, U3" {
+		test.Errorf("recorded assigning %q, want U2 and U3", comment)
+	}
+
+	s, slackFake, store = newCommandTest(test, "Closed")
+	runCommand(test, s, "UOWNER", "!reopen")
+	if len(slackFake.unarchived) != 1 || slackFake.unarchived[0] != "C123" {
+		test.Errorf("unarchived %v, want the ticket channel", slackFake.unarchived)
+	}
+	if store.saved[0].SnoozeDate == "" {
+		test.Error("reopened without a snooze date")
+	}
+	if len(store.lifted) != 0 {
+		test.Errorf("lifted %v for a closed ticket", store.lifted)
+	}
+
+	s, _, store = newCommandTest(test, "Dismissed")
+	runCommand(test, s, "UOWNER", "!reopen")
+	if strings.Join(store.lifted, ",") != want.TargetResource+" "+want.RecommenderSubtype {
+		test.Errorf("lifted %v, want the dismissal of the resource", store.lifted)
+	}
+
+	s, _, store = newCommandTest(test, "New")
+	runCommand(test, s, "UOWNER", "!comment waiting on the vendor")
+	if comment := store.history[0].Comment; comment != "waiting on the vendor" {
+		test.Errorf("recorded comment %q", comment)
+	}
+}
+
+func TestCommandsDenied(test *testing.T) {
+	tests := []struct {
+		text   string
+		status string
+	}{
+		{"!snooze 3 days", "New"},
+		{"!close", "New"},
+		{"!dismiss planned", "New"},
+		{"!reopen", "Closed"},
+		{"!assign <@U2>", "New"},
+		{"!comment waiting on the vendor", "New"},
+	}
+	for _, tt := range tests {
+		test.Run(tt.text, func(test *testing.T) {
+			s, slackFake, store := newCommandTest(test, tt.status)
+			runCommand(test, s, "USTRANGER", tt.text)
+
+			if len(store.saved) != 0 {
+				test.Errorf("saved %d ticket rows, want none", len(store.saved))
+			}
+			if len(store.history) != 1 {
+				test.Fatalf("recorded %d history rows, want the denial", len(store.history))
+			}
+			if entry := store.history[0]; entry.Event != authz.EventDenied || entry.User != "USTRANGER" || entry.IssueKey != "C123" {
+				test.Errorf("recorded %s by %s on %s, want a denial of USTRANGER on C123", entry.Event, entry.User, entry.IssueKey)
+			}
+			if len(slackFake.posted) != 1 || !strings.HasPrefix(slackFake.posted[0], "Sorry, you can't") {
+				test.Errorf("replied %q, want a refusal", slackFake.posted)
+			}
+			if len(slackFake.archived)+len(slackFake.unarchived)+len(slackFake.invited) != 0 {
+				test.Error("changed the channel for a denied command")
+			}
+			if len(store.suppressions)+len(store.lifted) != 0 {
+				test.Error("changed suppressions for a denied command")
+			}
+		})
+	}
+}
+
+func TestThreadSlashCommandNamesTicket(test *testing.T) {
+	s, slackFake, store := newCommandTest(test, "New")
+	s.channelAsTicket = false
+	store.ticket.IssueKey = "C0123456789-1700000000.000100"
+
+	// Slack doesn't say which thread it was run in
+	event := &commandEvent{Channel: "C0123456789", User: "UOWNER", SlashCommand: "/reco"}
+	if err := s.runSlashCommand(event, "complete"); err != nil {
+		test.Fatal(err)
+	}
+	if len(store.saved) != 0 {
+		test.Errorf("saved %d ticket rows without an IssueKey, want none", len(store.saved))
+	}
+	if want := "Start /reco with the IssueKey of the ticket, /reco list shows them"; len(slackFake.posted) != 1 || slackFake.posted[0] != want {
+		test.Errorf("replied %q, want %q", slackFake.posted, want)
+	}
+
+	event = &commandEvent{Channel: "C0123456789", User: "UOWNER", SlashCommand: "/reco"}
+	if err := s.runSlashCommand(event, "C0123456789-1700000000.000100 complete"); err != nil {
+		test.Fatal(err)
+	}
+	if len(store.saved) != 1 || store.saved[0].IssueKey != store.ticket.IssueKey {
+		test.Fatalf("saved %v, want the named ticket", store.saved)
+	}
+	if event.ThreadTimeStamp != "1700000000.000100" {
+		test.Errorf("replying in thread %q, want the ticket's", event.ThreadTimeStamp)
+	}
+}
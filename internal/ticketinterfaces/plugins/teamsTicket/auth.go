@@ -0,0 +1,248 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Bot Framework rotates its keys every few weeks, a day old set is fine.
+// A token signed with a key we don't know fetches them again, but not more
+// often than keyRefreshInterval so bad tokens can't make us hammer the JWKS.
+const (
+	keySetTTL          = 24 * time.Hour
+	keyRefreshInterval = 5 * time.Minute
+	// How far apart our clock and the Bot Framework's may be
+	clockSkew = 5 * time.Minute
+)
+
+// jsonWebKey is one key of a JWKS, only RSA keys are used to sign tokens
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// tokenVerifier checks the bearer tokens the Bot Framework sends with every
+// activity, so only Teams can post to /webhooks.
+// https://learn.microsoft.com/en-us/azure/bot-service/rest-api/bot-framework-rest-connector-authentication
+type tokenVerifier struct {
+	mutex    sync.Mutex
+	jwksURL  string
+	issuer   string
+	audience string
+	client   *http.Client
+	keys     map[string]*rsa.PublicKey
+	fetched  time.Time
+}
+
+func newTokenVerifier(jwksURL, issuer, audience string, client *http.Client) *tokenVerifier {
+	return &tokenVerifier{
+		jwksURL:  jwksURL,
+		issuer:   issuer,
+		audience: audience,
+		client:   client,
+		keys:     make(map[string]*rsa.PublicKey),
+	}
+}
+
+// refresh fetches the signing keys from the JWKS
+func (v *tokenVerifier) refresh() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.fetch()
+}
+
+// fetch replaces the keys, the caller holds the mutex
+func (v *tokenVerifier) fetch() error {
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", v.jwksURL, resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("reading %s: %w", v.jwksURL, err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		key, err := rsaPublicKey(jwk)
+		if err != nil {
+			return fmt.Errorf("key %s of %s: %w", jwk.Kid, v.jwksURL, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+	v.fetched = time.Now()
+	return nil
+}
+
+func rsaPublicKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent is too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// key returns the signing key with this ID, fetching the keys again when
+// they're old or don't have it.
+func (v *tokenVerifier) key(kid string) (*rsa.PublicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetched)
+	if age >= keySetTTL || (!ok && age >= keyRefreshInterval) {
+		if err := v.fetch(); err != nil {
+			// Old keys are still better than none
+			if !ok {
+				return nil, err
+			}
+			return key, nil
+		}
+		key, ok = v.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// tokenClaims are the claims of a Bot Framework token we check
+type tokenClaims struct {
+	Issuer     string   `json:"iss"`
+	Audience   audience `json:"aud"`
+	Expires    int64    `json:"exp"`
+	NotBefore  int64    `json:"nbf"`
+	ServiceURL string   `json:"serviceurl"`
+}
+
+// audience is a string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, aud := range a {
+		if aud == value {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks the Authorization header of an activity is a token signed
+// by the Bot Framework for this bot, and that it was issued for the
+// serviceUrl the activity names.
+func (v *tokenVerifier) verify(authorization, serviceURL string) error {
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return fmt.Errorf("no bearer token")
+	}
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unexpected signing algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed token signature: %w", err)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("bad token signature")
+	}
+
+	var claims tokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return fmt.Errorf("malformed token claims: %w", err)
+	}
+	now := time.Now()
+	if claims.Issuer != v.issuer {
+		return fmt.Errorf("token issued by %q", claims.Issuer)
+	}
+	if !claims.Audience.contains(v.audience) {
+		return fmt.Errorf("token isn't for this bot")
+	}
+	if claims.Expires == 0 || now.After(time.Unix(claims.Expires, 0).Add(clockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-clockSkew)) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if claims.ServiceURL != "" && withSlash(claims.ServiceURL) != withSlash(serviceURL) {
+		return fmt.Errorf("token issued for %s, not %s", claims.ServiceURL, serviceURL)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
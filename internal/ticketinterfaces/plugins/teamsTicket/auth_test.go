@@ -0,0 +1,239 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer     = "https://api.botframework.com"
+	testAudience   = "test-app-id"
+	testServiceURL = "https://smba.trafficmanager.net/emea/"
+)
+
+// fakeJWKS serves a key set that can change, counting how often it's fetched
+type fakeJWKS struct {
+	mutex   sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetches int
+	server  *httptest.Server
+}
+
+func newFakeJWKS(test *testing.T, keys map[string]*rsa.PublicKey) *fakeJWKS {
+	f := &fakeJWKS{keys: keys}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.fetches++
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for kid, key := range f.keys {
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	test.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeJWKS) setKeys(keys map[string]*rsa.PublicKey) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.keys = keys
+}
+
+func (f *fakeJWKS) fetchCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.fetches
+}
+
+func newTestKey(test *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return key
+}
+
+func encodeSegment(test *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken returns an Authorization header with a token signed by key
+func signToken(test *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	signed := encodeSegment(test, header) + "." + encodeSegment(test, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		test.Fatal(err)
+	}
+	return "Bearer " + signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims are the claims of a token the Bot Framework would send us
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":        testIssuer,
+		"aud":        testAudience,
+		"exp":        now.Add(time.Hour).Unix(),
+		"nbf":        now.Add(-time.Minute).Unix(),
+		"serviceurl": testServiceURL,
+	}
+}
+
+func TestVerifyToken(test *testing.T) {
+	key := newTestKey(test)
+	otherKey := newTestKey(test)
+	jwks := newFakeJWKS(test, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	verifier := newTokenVerifier(jwks.server.URL, testIssuer, testAudience, jwks.server.Client())
+	if err := verifier.refresh(); err != nil {
+		test.Fatal(err)
+	}
+
+	header := map[string]interface{}{"alg": "RS256", "kid": "k1"}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	now := time.Now()
+	tests := []struct {
+		name          string
+		authorization string
+		serviceURL    string
+		// Empty when the token should be accepted
+		wantErr string
+	}{
+		{"valid", signToken(test, key, header, validClaims()), testServiceURL, ""},
+		{"audience list", signToken(test, key, header, with("aud", []string{"other", testAudience})), testServiceURL, ""},
+		{"service URL without slash", signToken(test, key, header, validClaims()), strings.TrimSuffix(testServiceURL, "/"), ""},
+		{"expired within skew", signToken(test, key, header, with("exp", now.Add(-time.Minute).Unix())), testServiceURL, ""},
+		{"not before within skew", signToken(test, key, header, with("nbf", now.Add(time.Minute).Unix())), testServiceURL, ""},
+		{"no bearer", strings.TrimPrefix(signToken(test, key, header, validClaims()), "Bearer "), testServiceURL, "no bearer token"},
+		{"malformed", "Bearer abc.def", testServiceURL, "malformed token"},
+		{"bad signature", signToken(test, otherKey, header, validClaims()), testServiceURL, "bad token signature"},
+		{"not RS256", signToken(test, key, map[string]interface{}{"alg": "HS256", "kid": "k1"}, validClaims()), testServiceURL, "unexpected signing algorithm"},
+		{"unsigned", signToken(test, key, map[string]interface{}{"alg": "none", "kid": "k1"}, validClaims()), testServiceURL, "unexpected signing algorithm"},
+		{"wrong issuer", signToken(test, key, header, with("iss", "https://example.com")), testServiceURL, "token issued by"},
+		{"wrong audience", signToken(test, key, header, with("aud", "other-app")), testServiceURL, "isn't for this bot"},
+		{"expired", signToken(test, key, header, with("exp", now.Add(-10*time.Minute).Unix())), testServiceURL, "token expired"},
+		{"no expiry", signToken(test, key, header, with("exp", nil)), testServiceURL, "token expired"},
+		{"not valid yet", signToken(test, key, header, with("nbf", now.Add(10*time.Minute).Unix())), testServiceURL, "not valid yet"},
+		{"other service URL", signToken(test, key, header, validClaims()), "https://attacker.example.com/", "token issued for"},
+	}
+	for _, tt := range tests {
+		test.Run(tt.name, func(test *testing.T) {
+			err := verifier.verify(tt.authorization, tt.serviceURL)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				test.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				test.Errorf("accepted, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				test.Errorf("got %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenUnknownKey(test *testing.T) {
+	key := newTestKey(test)
+	newKey := newTestKey(test)
+	jwks := newFakeJWKS(test, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	verifier := newTokenVerifier(jwks.server.URL, testIssuer, testAudience, jwks.server.Client())
+	if err := verifier.refresh(); err != nil {
+		test.Fatal(err)
+	}
+	token := signToken(test, newKey, map[string]interface{}{"alg": "RS256", "kid": "k2"}, validClaims())
+
+	// Just fetched, a key we don't know doesn't fetch again
+	if err := verifier.verify(token, testServiceURL); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		test.Errorf("got %v, want an unknown signing key", err)
+	}
+	// Not even once the Bot Framework has rotated to it
+	jwks.setKeys(map[string]*rsa.PublicKey{"k1": &key.PublicKey, "k2": &newKey.PublicKey})
+	if err := verifier.verify(token, testServiceURL); err == nil {
+		test.Error("accepted a key we shouldn't have fetched yet")
+	}
+	if fetches := jwks.fetchCount(); fetches != 1 {
+		test.Errorf("fetched the keys %d times, want 1", fetches)
+	}
+
+	// After keyRefreshInterval an unknown key fetches the keys again
+	verifier.mutex.Lock()
+	verifier.fetched = time.Now().Add(-keyRefreshInterval)
+	verifier.mutex.Unlock()
+	if err := verifier.verify(token, testServiceURL); err != nil {
+		test.Errorf("unexpected error: %v", err)
+	}
+	if fetches := jwks.fetchCount(); fetches != 2 {
+		test.Errorf("fetched the keys %d times, want 2", fetches)
+	}
+	// And the keys it had are still known without fetching
+	old := signToken(test, key, map[string]interface{}{"alg": "RS256", "kid": "k1"}, validClaims())
+	if err := verifier.verify(old, testServiceURL); err != nil {
+		test.Errorf("unexpected error: %v", err)
+	}
+	if fetches := jwks.fetchCount(); fetches != 2 {
+		test.Errorf("fetched the keys %d times, want 2", fetches)
+	}
+}
+
+func TestVerifyTokenKeepsKeysWhenJWKSFails(test *testing.T) {
+	key := newTestKey(test)
+	jwks := newFakeJWKS(test, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	verifier := newTokenVerifier(jwks.server.URL, testIssuer, testAudience, jwks.server.Client())
+	if err := verifier.refresh(); err != nil {
+		test.Fatal(err)
+	}
+	// The keys are due a refresh but the JWKS is down
+	jwks.server.Close()
+	verifier.mutex.Lock()
+	verifier.fetched = time.Now().Add(-keySetTTL)
+	verifier.mutex.Unlock()
+	token := signToken(test, key, map[string]interface{}{"alg": "RS256", "kid": "k1"}, validClaims())
+	if err := verifier.verify(token, testServiceURL); err != nil {
+		test.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/policy"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// CreateTicket posts the ticket's card. A route Target that is a channel
+// gets a new thread for every ticket, one that is a thread gets the card as
+// a reply.
+func (s *TeamsTicketService) CreateTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+	now := time.Now().Format(time.RFC3339)
+	ticket.CreationDate = now
+	ticket.LastUpdateDate = now
+	ticket.LastPingDate = now
+	snoozeDays := policy.Current().Match(row.RecommenderName, row.RecommenderSubtype).SnoozeDays
+	ticket.SnoozeDate = time.Now().AddDate(0, 0, snoozeDays).Format(time.RFC3339)
+	ticket.UserRecommendation = false
+	title, err := templates.Render(templates.Title, row, ticket)
+	if err != nil {
+		u.LogPrint(3, "[TEAMS] Error Executing Title Template")
+		return "", err
+	}
+	ticket.Subject = title
+	ticket.RecommenderID = row.RecommenderName
+	message, err := templates.Render(t.EventCreated, row, ticket)
+	if err != nil {
+		return "", err
+	}
+	card := cardActivity(ticketCard(ticket, row, message))
+
+	if isThread(ticket.TargetContact) {
+		id, err := s.sendActivity(s.serviceURL, ticket.TargetContact, card)
+		if err != nil {
+			u.LogPrint(3, "[TEAMS] Failed to post ticket to thread %s: %v", ticket.TargetContact, err)
+			return "", err
+		}
+		ticket.IssueKey = ticket.TargetContact + issueKeySeparator + id
+	} else {
+		conversation, err := s.createConversation(ticket.TargetContact, card)
+		if err != nil {
+			u.LogPrint(3, "[TEAMS] Failed to post ticket to channel %s: %v", ticket.TargetContact, err)
+			return "", err
+		}
+		ticket.IssueKey = conversation
+	}
+	u.LogPrint(2, "[TEAMS] Created ticket %s", ticket.IssueKey)
+	return ticket.IssueKey, nil
+}
+
+// UpdateTicket posts the message for a lifecycle event to the ticket's thread
+func (s *TeamsTicketService) UpdateTicket(ticket *t.Ticket, row t.RecommendationQueryResult, event string) error {
+	message, err := templates.Render(event, row, ticket)
+	if err != nil {
+		return err
+	}
+	conversation, _ := splitIssueKey(ticket.IssueKey)
+	reply := textActivity(message)
+	if richEvents[event] {
+		reply = cardActivity(ticketCard(ticket, row, message))
+	}
+	_, err = s.sendActivity(s.serviceURL, conversation, reply)
+	return err
+}
+
+// CloseTicket takes the buttons off the ticket's card. Teams threads can't
+// be closed, the thread stays where it is.
+func (s *TeamsTicketService) CloseTicket(issueKey string) error {
+	ticket, err := b.GetTicketByIssueKey(issueKey)
+	if err != nil {
+		return err
+	}
+	if ticket.Status != "Dismissed" {
+		ticket.Status = "Closed"
+	}
+	return s.updateCard(s.serviceURL, ticket)
+}
+
+// ReopenTicket puts the buttons back on the ticket's card
+func (s *TeamsTicketService) ReopenTicket(issueKey string) error {
+	ticket, err := b.GetTicketByIssueKey(issueKey)
+	if err != nil {
+		return err
+	}
+	ticket.Status = "Reopened"
+	return s.updateCard(s.serviceURL, ticket)
+}
+
+func (s *TeamsTicketService) GetTicket(issueKey string) (t.Ticket, error) {
+	// Teams only holds the messages, the ticket lives in BQ
+	ticket, err := b.GetTicketByIssueKey(issueKey)
+	if err != nil {
+		return t.Ticket{}, err
+	}
+	return *ticket, nil
+}
+
+// updateCard replaces the first card of a ticket with its current state
+func (s *TeamsTicketService) updateCard(serviceURL string, ticket *t.Ticket) error {
+	conversation, card := splitIssueKey(ticket.IssueKey)
+	if card == "" {
+		return nil
+	}
+	return s.updateActivity(serviceURL, conversation, card, cardActivity(statusCard(ticket)))
+}
@@ -0,0 +1,292 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	r "ticketservice/internal/ratelimit"
+	u "ticketservice/internal/utils"
+)
+
+// The parts of the Bot Framework activity schema we use
+// https://learn.microsoft.com/en-us/azure/bot-service/rest-api/bot-framework-rest-connector-api-reference
+type activity struct {
+	Type         string               `json:"type"`
+	ID           string               `json:"id,omitempty"`
+	ServiceURL   string               `json:"serviceUrl,omitempty"`
+	ChannelID    string               `json:"channelId,omitempty"`
+	From         *channelAccount      `json:"from,omitempty"`
+	Conversation *conversationAccount `json:"conversation,omitempty"`
+	ReplyToID    string               `json:"replyToId,omitempty"`
+	Text         string               `json:"text,omitempty"`
+	TextFormat   string               `json:"textFormat,omitempty"`
+	Attachments  []attachment         `json:"attachments,omitempty"`
+	// What an Action.Submit button of a card carries
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type channelAccount struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	AadObjectID string `json:"aadObjectId,omitempty"`
+}
+
+type conversationAccount struct {
+	ID       string `json:"id"`
+	IsGroup  bool   `json:"isGroup,omitempty"`
+	TenantID string `json:"tenantId,omitempty"`
+}
+
+type attachment struct {
+	ContentType string      `json:"contentType"`
+	Content     interface{} `json:"content"`
+}
+
+const activityMessage = "message"
+
+// textActivity is a plain message, Teams renders a subset of markdown
+func textActivity(text string) *activity {
+	return &activity{Type: activityMessage, Text: text, TextFormat: "markdown"}
+}
+
+// cardActivity is a message holding a single Adaptive Card
+func cardActivity(card *adaptiveCard) *activity {
+	return &activity{
+		Type:        activityMessage,
+		Attachments: []attachment{{ContentType: adaptiveCardContentType, Content: card}},
+	}
+}
+
+// httpError is a Bot Framework call that didn't succeed
+type httpError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Teams allows a bot about 7 messages a second per conversation and 60 per
+// 30 seconds across them. We'd rather not get close.
+// https://learn.microsoft.com/en-us/microsoftteams/platform/bots/how-to/rate-limit
+var defaultTeamsLimits = map[string]r.Limit{
+	"conversations.create": {PerMinute: 60, Burst: 3},
+	"activities.send":      {PerMinute: 100, Burst: 5},
+	"activities.update":    {PerMinute: 100, Burst: 5},
+}
+
+// Anything we haven't listed, I.E. fetching tokens, isn't limited by Teams
+var fallbackTeamsLimit = r.Limit{PerMinute: 100, Burst: 5}
+
+func (s *TeamsTicketService) newTeamsLimiter() *r.Limiter {
+	limits := make(map[string]r.Limit)
+	for method, limit := range defaultTeamsLimits {
+		limits[method] = limit
+	}
+	if overrides := s.setting("TEAMS_RATE_LIMITS"); overrides != "" {
+		parsed, err := r.ParseLimits(overrides)
+		if err != nil {
+			u.LogPrint(3, "Error parsing TEAMS_RATE_LIMITS, using defaults: %v", err)
+		}
+		for method, limit := range parsed {
+			limits[method] = limit
+		}
+	}
+	maxRetries := 5
+	if mr := s.setting("TEAMS_MAX_RETRIES"); mr != "" {
+		var err error
+		maxRetries, err = strconv.Atoi(mr)
+		if err != nil {
+			u.LogPrint(3, "Error parsing TEAMS_MAX_RETRIES as int: %v", err)
+			maxRetries = 5
+		}
+	}
+	return r.NewLimiter(limits, fallbackTeamsLimit, r.RetryPolicy{
+		MaxRetries:  maxRetries,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		RetryAfter:  teamsRetryAfter,
+	})
+}
+
+// teamsRetryAfter recognizes a 429, with the Retry-After header if Teams sent one
+func teamsRetryAfter(err error) (time.Duration, bool) {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return httpErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// botToken is the bot's access token for the Bot Framework
+type botToken struct {
+	mutex   sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// accessToken returns the bot's token, fetching a new one with the app's
+// credentials when it's about to run out.
+func (s *TeamsTicketService) accessToken() (string, error) {
+	s.token.mutex.Lock()
+	defer s.token.mutex.Unlock()
+	if s.token.value != "" && time.Until(s.token.expires) > 5*time.Minute {
+		return s.token.value, nil
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.appID},
+		"client_secret": {s.appPassword},
+		"scope":         {"https://api.botframework.com/.default"},
+	}
+	resp, err := s.client.PostForm(s.tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("fetching a Bot Framework token: %w", &httpError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	s.token.value = token.AccessToken
+	s.token.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token.value, nil
+}
+
+// callTeams sends a request to the Bot Framework under the limiter for
+// method, decoding the response into out when it's not nil.
+func (s *TeamsTicketService) callTeams(method, httpMethod, endpoint string, in, out interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return s.limiter.Do(context.Background(), method, func() error {
+		token, err := s.accessToken()
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(httpMethod, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			httpErr := &httpError{StatusCode: resp.StatusCode, Body: string(body)}
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				httpErr.RetryAfter = time.Duration(seconds) * time.Second
+			}
+			return httpErr
+		}
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+}
+
+// activitiesURL is where a conversation's messages are posted
+func activitiesURL(serviceURL, conversationID string) string {
+	return withSlash(serviceURL) + "v3/conversations/" + url.PathEscape(conversationID) + "/activities"
+}
+
+// createConversation starts a new thread in a channel with the message,
+// returning the ID of the conversation, which is the thread.
+func (s *TeamsTicketService) createConversation(channelID string, message *activity) (string, error) {
+	params := map[string]interface{}{
+		"isGroup":     true,
+		"channelData": map[string]interface{}{"channel": map[string]string{"id": channelID}},
+		"activity":    message,
+	}
+	var created struct {
+		ID         string `json:"id"`
+		ActivityID string `json:"activityId"`
+	}
+	err := s.callTeams("conversations.create", http.MethodPost, s.serviceURL+"v3/conversations", params, &created)
+	if err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("Teams didn't return the new conversation")
+	}
+	return created.ID, nil
+}
+
+// sendActivity posts a message to a conversation and returns its ID
+func (s *TeamsTicketService) sendActivity(serviceURL, conversationID string, message *activity) (string, error) {
+	var sent struct {
+		ID string `json:"id"`
+	}
+	err := s.callTeams("activities.send", http.MethodPost, activitiesURL(serviceURL, conversationID), message, &sent)
+	return sent.ID, err
+}
+
+// updateActivity replaces a message the bot posted, I.E. a ticket card
+func (s *TeamsTicketService) updateActivity(serviceURL, conversationID, activityID string, message *activity) error {
+	message.ID = activityID
+	return s.callTeams("activities.update", http.MethodPut,
+		activitiesURL(serviceURL, conversationID)+"/"+url.PathEscape(activityID), message, nil)
+}
+
+// A channel ticket is the thread its card started, the conversation ID of
+// which ends with the ID of that card. A ticket posted into an existing
+// thread is the thread and the card, joined with this.
+const issueKeySeparator = "|"
+
+// threadMessageID returns the ID of the message that started a thread
+func threadMessageID(conversationID string) string {
+	_, messageID, _ := strings.Cut(conversationID, ";messageid=")
+	return messageID
+}
+
+// isThread tells if a route target is an existing thread rather than a channel
+func isThread(target string) bool {
+	return strings.Contains(target, ";messageid=")
+}
+
+// splitIssueKey returns the conversation of a ticket and the ID of its card
+func splitIssueKey(issueKey string) (string, string) {
+	if conversation, card, ok := strings.Cut(issueKey, issueKeySeparator); ok {
+		return conversation, card
+	}
+	return issueKey, threadMessageID(issueKey)
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"ticketservice/internal/locale"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	// The newest version every Teams client renders
+	adaptiveCardVersion = "1.4"
+)
+
+// Actions of the ticket buttons, Teams posts a click to /webhooks as a
+// message activity whose value is the data of the button.
+const (
+	actionSnooze7d  = "snooze_7d"
+	actionSnooze30d = "snooze_30d"
+	actionComplete  = "complete"
+	actionClose     = "close"
+)
+
+// Teams cuts off long text, keep the card readable
+const (
+	maxTitleLength = 150
+	maxTextLength  = 3000
+)
+
+// richEvents are posted as cards, other events stay plain text
+var richEvents = map[string]bool{
+	t.EventCreated:  true,
+	t.EventReminder: true,
+}
+
+// adaptiveCard is the part of the Adaptive Card schema we use
+// https://adaptivecards.io/explorer/
+type adaptiveCard struct {
+	Type    string        `json:"type"`
+	Schema  string        `json:"$schema"`
+	Version string        `json:"version"`
+	Body    []interface{} `json:"body"`
+	Actions []cardAction  `json:"actions,omitempty"`
+}
+
+type textBlock struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Wrap   bool   `json:"wrap"`
+	Weight string `json:"weight,omitempty"`
+	Size   string `json:"size,omitempty"`
+}
+
+type factSet struct {
+	Type  string `json:"type"`
+	Facts []fact `json:"facts"`
+}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type cardAction struct {
+	Type  string     `json:"type"`
+	Title string     `json:"title"`
+	Style string     `json:"style,omitempty"`
+	Data  actionData `json:"data"`
+}
+
+// actionData is what a button sends back. The first card of a ticket is
+// posted before the ticket has an IssueKey, so its buttons don't carry one.
+type actionData struct {
+	Action   string `json:"action"`
+	IssueKey string `json:"issueKey,omitempty"`
+}
+
+func newCard(title string) *adaptiveCard {
+	return &adaptiveCard{
+		Type:    "AdaptiveCard",
+		Schema:  adaptiveCardSchema,
+		Version: adaptiveCardVersion,
+		Body: []interface{}{
+			textBlock{Type: "TextBlock", Text: templates.Truncate(maxTitleLength, title), Wrap: true, Weight: "Bolder", Size: "Medium"},
+		},
+	}
+}
+
+func (c *adaptiveCard) text(text string) {
+	c.Body = append(c.Body, textBlock{Type: "TextBlock", Text: templates.Truncate(maxTextLength, text), Wrap: true})
+}
+
+// withActions adds the ticket buttons
+func (c *adaptiveCard) withActions(ticket *t.Ticket) *adaptiveCard {
+	loc := templates.TicketLocale(ticket)
+	button := func(action, title, style string) cardAction {
+		return cardAction{
+			Type:  "Action.Submit",
+			Title: locale.Sprintf(loc, title),
+			Style: style,
+			Data:  actionData{Action: action, IssueKey: ticket.IssueKey},
+		}
+	}
+	c.Actions = []cardAction{
+		button(actionSnooze7d, "Snooze 7d", ""),
+		button(actionSnooze30d, "Snooze 30d", ""),
+		button(actionComplete, "Mark complete", "positive"),
+		button(actionClose, "Close", "destructive"),
+	}
+	return c
+}
+
+// ticketCard lays out a ticket message like the Slack one: a title, the
+// savings and resource, the rendered template and the buttons.
+func ticketCard(ticket *t.Ticket, row t.RecommendationQueryResult, message string) *adaptiveCard {
+	loc := templates.TicketLocale(ticket)
+	title := ticket.Subject
+	if title == "" {
+		title = row.RecommenderSubtype
+	}
+	card := newCard(title)
+	var facts []fact
+	if row.ImpactCostUnit != 0 {
+		facts = append(facts, fact{
+			Title: locale.Sprintf(loc, "Savings"),
+			Value: locale.Currency(loc, float64(row.ImpactCostUnit), row.ImpactCurrencyCode),
+		})
+	}
+	if row.TargetResource != "" {
+		facts = append(facts, fact{
+			Title: locale.Sprintf(loc, "Resource"),
+			Value: fmt.Sprintf("[%s](%s)", templates.ShortResource(row.TargetResource), templates.ConsoleURL(row.TargetResource)),
+		})
+	}
+	if len(facts) > 0 {
+		card.Body = append(card.Body, factSet{Type: "FactSet", Facts: facts})
+	}
+	card.text(message)
+	return card.withActions(ticket)
+}
+
+// statusCard replaces the first card of a ticket once it has been acted on.
+// The details are in the thread, what matters now is the state. Closed
+// tickets lose their buttons.
+func statusCard(ticket *t.Ticket) *adaptiveCard {
+	loc := templates.TicketLocale(ticket)
+	card := newCard(ticket.Subject)
+	card.text(locale.Sprintf(loc, "Status: %s", ticket.Status))
+	if ticket.Status == "Snoozed" {
+		card.text(locale.Sprintf(loc, "Next reminder: %s", ticketDate(loc, ticket.SnoozeDate)))
+	}
+	if ticket.Status == "Closed" || ticket.Status == "Dismissed" {
+		return card
+	}
+	return card.withActions(ticket)
+}
+
+// ticketDate formats a date stored on a ticket for loc
+func ticketDate(loc, value string) string {
+	date, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return value
+	}
+	return locale.Date(loc, date) + " (" + locale.RelativeDate(loc, date, time.Now()) + ")"
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"ticketservice/internal/locale"
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// renderedCard is a card activity as Teams receives it
+type renderedCard struct {
+	Attachments []struct {
+		ContentType string `json:"contentType"`
+		Content     struct {
+			Type    string `json:"type"`
+			Schema  string `json:"$schema"`
+			Version string `json:"version"`
+			Body    []struct {
+				Type   string `json:"type"`
+				Text   string `json:"text"`
+				Weight string `json:"weight"`
+				Facts  []fact `json:"facts"`
+			} `json:"body"`
+			Actions []struct {
+				Type  string     `json:"type"`
+				Title string     `json:"title"`
+				Data  actionData `json:"data"`
+			} `json:"actions"`
+		} `json:"content"`
+	} `json:"attachments"`
+}
+
+// render sends a card through JSON the way it's posted
+func render(test *testing.T, card *adaptiveCard) renderedCard {
+	data, err := json.Marshal(cardActivity(card))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var rendered renderedCard
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		test.Fatal(err)
+	}
+	if len(rendered.Attachments) != 1 {
+		test.Fatalf("got %d attachments, want 1", len(rendered.Attachments))
+	}
+	return rendered
+}
+
+func actionsOf(rendered renderedCard) []string {
+	var actions []string
+	for _, action := range rendered.Attachments[0].Content.Actions {
+		actions = append(actions, action.Data.Action)
+	}
+	return actions
+}
+
+func TestTicketCard(test *testing.T) {
+	ticket := &t.Ticket{IssueKey: "19:abc@thread.tacv2;messageid=1", Subject: "Resize vm-1"}
+	row := t.RecommendationQueryResult{
+		RecommenderSubtype: "CHANGE_MACHINE_TYPE",
+		TargetResource:     "//compute.googleapis.com/projects/p/zones/us-central1-a/instances/vm-1",
+		ImpactCostUnit:     12,
+		ImpactCurrencyCode: "USD",
+	}
+	rendered := render(test, ticketCard(ticket, row, "Use a smaller machine type"))
+	attachment := rendered.Attachments[0]
+	if attachment.ContentType != adaptiveCardContentType {
+		test.Errorf("content type %q", attachment.ContentType)
+	}
+	card := attachment.Content
+	if card.Type != "AdaptiveCard" || card.Schema != adaptiveCardSchema || card.Version != adaptiveCardVersion {
+		test.Errorf("got a %s %s of %s", card.Type, card.Version, card.Schema)
+	}
+	if len(card.Body) != 3 {
+		test.Fatalf("got %d body elements, want title, facts and message", len(card.Body))
+	}
+	if title := card.Body[0]; title.Text != "Resize vm-1" || title.Weight != "Bolder" {
+		test.Errorf("title %q weighing %q", title.Text, title.Weight)
+	}
+	facts := card.Body[1].Facts
+	wantFacts := []fact{
+		{Title: "Savings", Value: locale.Currency(locale.English, 12, "USD")},
+		{Title: "Resource", Value: "[vm-1](https://console.cloud.google.com/compute/instancesDetail/zones/us-central1-a/instances/vm-1?project=p)"},
+	}
+	if len(facts) != len(wantFacts) {
+		test.Fatalf("got facts %v, want %v", facts, wantFacts)
+	}
+	for i := range wantFacts {
+		if facts[i] != wantFacts[i] {
+			test.Errorf("fact %d is %v, want %v", i, facts[i], wantFacts[i])
+		}
+	}
+	if message := card.Body[2].Text; message != "Use a smaller machine type" {
+		test.Errorf("message %q", message)
+	}
+	wantActions := []string{actionSnooze7d, actionSnooze30d, actionComplete, actionClose}
+	if actions := actionsOf(rendered); strings.Join(actions, ",") != strings.Join(wantActions, ",") {
+		test.Errorf("actions %v, want %v", actions, wantActions)
+	}
+	for _, action := range card.Actions {
+		if action.Type != "Action.Submit" || action.Data.IssueKey != ticket.IssueKey {
+			test.Errorf("%s is an %s for %q", action.Data.Action, action.Type, action.Data.IssueKey)
+		}
+	}
+}
+
+func TestTicketCardWithoutDetails(test *testing.T) {
+	// The first card of a ticket goes out before it has an IssueKey
+	ticket := &t.Ticket{}
+	row := t.RecommendationQueryResult{RecommenderSubtype: "CHANGE_MACHINE_TYPE"}
+	card := render(test, ticketCard(ticket, row, "message")).Attachments[0].Content
+	if card.Body[0].Text != "CHANGE_MACHINE_TYPE" {
+		test.Errorf("title %q, want the subtype", card.Body[0].Text)
+	}
+	if len(card.Body) != 2 {
+		test.Errorf("got %d body elements, want no facts", len(card.Body))
+	}
+	for _, action := range card.Actions {
+		if action.Data.IssueKey != "" {
+			test.Errorf("%s carries IssueKey %q", action.Data.Action, action.Data.IssueKey)
+		}
+	}
+	data, _ := json.Marshal(card.Actions[0].Data)
+	if strings.Contains(string(data), "issueKey") {
+		test.Errorf("button data %s has an empty issueKey", data)
+	}
+}
+
+func TestTicketCardTruncates(test *testing.T) {
+	ticket := &t.Ticket{Subject: strings.Repeat("長", maxTitleLength+10)}
+	card := render(test, ticketCard(ticket, t.RecommendationQueryResult{}, strings.Repeat("x", maxTextLength+10))).Attachments[0].Content
+	if title := card.Body[0].Text; utf8.RuneCountInString(title) != maxTitleLength || !strings.HasSuffix(title, "...") {
+		test.Errorf("title is %d characters, want %d ending in ...", utf8.RuneCountInString(title), maxTitleLength)
+	}
+	if message := card.Body[len(card.Body)-1].Text; len(message) != maxTextLength {
+		test.Errorf("message is %d characters, want %d", len(message), maxTextLength)
+	}
+}
+
+func TestStatusCard(test *testing.T) {
+	snoozeDate := time.Now().AddDate(0, 0, 7).Format(time.RFC3339)
+	tests := []struct {
+		status      string
+		wantTexts   int
+		wantActions bool
+	}{
+		{"Snoozed", 3, true},
+		{"Reopened", 2, true},
+		{"Closed", 2, false},
+		{"Dismissed", 2, false},
+	}
+	for _, tt := range tests {
+		ticket := &t.Ticket{IssueKey: "19:abc@thread.tacv2", Subject: "Resize vm-1", Status: tt.status, SnoozeDate: snoozeDate}
+		rendered := render(test, statusCard(ticket))
+		card := rendered.Attachments[0].Content
+		if len(card.Body) != tt.wantTexts {
+			test.Errorf("%s: got %d body elements, want %d", tt.status, len(card.Body), tt.wantTexts)
+		}
+		if status := card.Body[1].Text; status != "Status: "+tt.status {
+			test.Errorf("%s: status reads %q", tt.status, status)
+		}
+		if hasActions := len(card.Actions) > 0; hasActions != tt.wantActions {
+			test.Errorf("%s: has buttons %v, want %v", tt.status, hasActions, tt.wantActions)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"ticketservice/internal/authz"
+	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/locale"
+	"ticketservice/internal/queue"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// activityJobKind is the queue job a verified activity is processed in
+const activityJobKind = "teams.activity"
+
+// HandleWebhookAction takes the activities the Bot Framework posts to the
+// bot's messaging endpoint, which should be /webhooks. Teams gives up on an
+// answer after 15 seconds, so like Slack's webhooks they're verified, put
+// on the work queue and answered straight away.
+func (s *TeamsTicketService) HandleWebhookAction(c echo.Context) error {
+	defer c.Request().Body.Close()
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	var incoming activity
+	if err := json.Unmarshal(body, &incoming); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	//Verifying the request is ALWAYS first.
+	if err := s.verifier.verify(c.Request().Header.Get("Authorization"), incoming.ServiceURL); err != nil {
+		u.LogPrint(2, "[TEAMS] Rejected activity: %v", err)
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	// Only the card buttons do anything, the rest, I.E. the bot being added
+	// to a team, is acknowledged and dropped
+	if incoming.Type != activityMessage || len(incoming.Value) == 0 || incoming.Conversation == nil {
+		return c.NoContent(http.StatusOK)
+	}
+	job, err := queue.Enqueue(c.Request().Context(), activityJobKind, body)
+	if err != nil {
+		return err
+	}
+	u.LogPrint(1, "[TEAMS] Queued activity as job %s", job.ID)
+	return c.NoContent(http.StatusOK)
+}
+
+// issueKeyOf works out the ticket a button was clicked on. Only the first
+// card of a ticket lacks the IssueKey, and that card either started the
+// thread, making the thread the ticket, or is a reply in a shared thread.
+func issueKeyOf(incoming *activity, data actionData) string {
+	if data.IssueKey != "" {
+		return data.IssueKey
+	}
+	conversation := incoming.Conversation.ID
+	if incoming.ReplyToID == "" || incoming.ReplyToID == threadMessageID(conversation) {
+		return conversation
+	}
+	return conversation + issueKeySeparator + incoming.ReplyToID
+}
+
+// userOf returns who clicked. Teams users are known by their Azure AD
+// object ID, which is what the routing table and AUTHZ_ADMINS should use.
+func userOf(incoming *activity) string {
+	if incoming.From == nil {
+		return ""
+	}
+	if incoming.From.AadObjectID != "" {
+		return incoming.From.AadObjectID
+	}
+	return incoming.From.ID
+}
+
+// processActivity runs a button click taken off the work queue
+func (s *TeamsTicketService) processActivity(ctx context.Context, body []byte) error {
+	var incoming activity
+	if err := json.Unmarshal(body, &incoming); err != nil {
+		return err
+	}
+	var data actionData
+	if err := json.Unmarshal(incoming.Value, &data); err != nil {
+		return err
+	}
+	issueKey := issueKeyOf(&incoming, data)
+	ticket, err := b.GetTicketByIssueKey(issueKey)
+	if err != nil {
+		u.LogPrint(3, "[TEAMS] Error getting ticket %s from Bigquery: %v", issueKey, err)
+		return s.reply(&incoming, templates.TicketLocale(nil), "Something went wrong getting ticket")
+	}
+	user := userOf(&incoming)
+	u.LogPrint(1, "User %v clicked %v on ticket %v", user, data.Action, issueKey)
+	switch data.Action {
+	case actionSnooze7d, actionSnooze30d:
+		if !s.authorize(&incoming, user, ticket, "snooze this ticket") {
+			return nil
+		}
+		days := 7
+		if data.Action == actionSnooze30d {
+			days = 30
+		}
+		return s.snoozeTicket(&incoming, user, ticket, time.Duration(days)*24*time.Hour)
+	case actionComplete:
+		if !s.authorize(&incoming, user, ticket, "close this ticket") {
+			return nil
+		}
+		return s.closeTicket(&incoming, user, ticket, t.EventResolved)
+	case actionClose:
+		if !s.authorize(&incoming, user, ticket, "close this ticket") {
+			return nil
+		}
+		return s.closeTicket(&incoming, user, ticket, t.EventClosed)
+	}
+	u.LogPrint(1, "Action %v not found", data.Action)
+	return nil
+}
+
+// reply answers a click in its thread with a message translated to loc
+func (s *TeamsTicketService) reply(incoming *activity, loc, message string, args ...interface{}) error {
+	return s.replyWith(incoming, textActivity(locale.Sprintf(loc, message, args...)))
+}
+
+func (s *TeamsTicketService) replyWith(incoming *activity, message *activity) error {
+	_, err := s.sendActivity(incoming.ServiceURL, incoming.Conversation.ID, message)
+	if err != nil {
+		u.LogPrint(3, "[TEAMS] Failed to reply in %s: %v", incoming.Conversation.ID, err)
+	}
+	return err
+}
+
+// replyWithEvent answers a click with the message of a ticket event
+func (s *TeamsTicketService) replyWithEvent(incoming *activity, ticket *t.Ticket, name string) error {
+	message, err := templates.Render(name, t.RecommendationQueryResult{}, ticket)
+	if err != nil {
+		u.LogPrint(3, "[TEAMS] Failed to render %s template: %v", name, err)
+		return s.reply(incoming, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	return s.replyWith(incoming, textActivity(message))
+}
+
+// authorize checks the user who clicked may take action on the ticket,
+// telling them why not when they may not.
+func (s *TeamsTicketService) authorize(incoming *activity, user string, ticket *t.Ticket, action string) bool {
+	err := authz.Authorize(user, action, ticket)
+	if err == nil {
+		return true
+	}
+	loc := templates.TicketLocale(ticket)
+	reason := err.Error()
+	if denied, ok := err.(*authz.DeniedError); ok {
+		reason = locale.Sprintf(loc, denied.Reason)
+	}
+	s.reply(incoming, loc, "Sorry, you can't %s: %s", locale.Sprintf(loc, action), reason)
+	return false
+}
+
+// saveTicket writes the new state of the ticket and what happened to its history
+func (s *TeamsTicketService) saveTicket(user string, ticket *t.Ticket, action string) error {
+	ticket.LastUpdateDate = time.Now().Format(time.RFC3339)
+	if err := b.AppendTicketsToTable("", []*t.Ticket{ticket}); err != nil {
+		u.LogPrint(3, "[TEAMS] Something went wrong updating ticket in BQ: %v", err)
+		return err
+	}
+	entry := &t.TicketHistory{
+		IssueKey: ticket.IssueKey,
+		Event:    action,
+		User:     user,
+	}
+	if err := b.AppendHistory("", []*t.TicketHistory{entry}); err != nil {
+		// The ticket is already saved, a missing history entry isn't worth failing for
+		u.LogPrint(3, "[TEAMS] Something went wrong recording ticket history in BQ: %v", err)
+	}
+	return nil
+}
+
+// snoozeTicket snoozes the ticket for duration
+func (s *TeamsTicketService) snoozeTicket(incoming *activity, user string, ticket *t.Ticket, duration time.Duration) error {
+	ticket.SnoozeDate = time.Now().Add(duration).Format(time.RFC3339)
+	ticket.Status = "Snoozed"
+	ticket.Reason = ""
+	ticket.Comment = ""
+	if err := s.saveTicket(user, ticket, t.EventSnoozed); err != nil {
+		return s.reply(incoming, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	return s.finish(incoming, ticket, t.EventSnoozed)
+}
+
+// closeTicket closes the ticket, ticketEvent tells if it was resolved
+func (s *TeamsTicketService) closeTicket(incoming *activity, user string, ticket *t.Ticket, ticketEvent string) error {
+	ticket.Status = "Closed"
+	ticket.Reason = ""
+	ticket.Comment = ""
+	if err := s.saveTicket(user, ticket, ticketEvent); err != nil {
+		return s.reply(incoming, templates.TicketLocale(ticket), "Something went wrong")
+	}
+	return s.finish(incoming, ticket, ticketEvent)
+}
+
+// finish tells the thread what happened and brings the card up to date.
+// The ticket is already saved, so failures are only logged, a retry of
+// the job would save it again.
+func (s *TeamsTicketService) finish(incoming *activity, ticket *t.Ticket, ticketEvent string) error {
+	s.replyWithEvent(incoming, ticket, ticketEvent)
+	if err := s.updateCard(incoming.ServiceURL, ticket); err != nil {
+		u.LogPrint(3, "[TEAMS] Failed to update the card of %s: %v", ticket.IssueKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ticketservice/internal/queue"
+	r "ticketservice/internal/ratelimit"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// Where the Bot Framework lives, each can be pointed elsewhere, I.E. at a
+// local stand-in.
+const (
+	defaultServiceURL  = "https://smba.trafficmanager.net/teams/"
+	defaultTokenURL    = "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token"
+	defaultJWKSURL     = "https://login.botframework.com/v1/.well-known/keys"
+	defaultTokenIssuer = "https://api.botframework.com"
+)
+
+type TeamsTicketService struct {
+	settings map[string]string
+	// The bot's Azure app registration
+	appID       string
+	appPassword string
+	// Where new tickets are posted, replies go to the serviceUrl of the activity
+	serviceURL string
+	tokenURL   string
+	// Our token for the Bot Framework, fetched when it runs out
+	token *botToken
+	// Verifies the tokens the Bot Framework sends with activities
+	verifier *tokenVerifier
+	limiter  *r.Limiter
+	client   *http.Client
+}
+
+func CreateService() t.BaseTicketService {
+	var service TeamsTicketService
+	return &service
+}
+
+// Configure stores the backend settings from the config file
+func (s *TeamsTicketService) Configure(settings map[string]string) {
+	s.settings = settings
+}
+
+// setting returns a backend setting, falling back to the environment
+func (s *TeamsTicketService) setting(key string) string {
+	if value, ok := s.settings[key]; ok && value != "" {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// settingOr returns a backend setting, or fallback when it isn't set
+func (s *TeamsTicketService) settingOr(key, fallback string) string {
+	if value := s.setting(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (s *TeamsTicketService) Init() error {
+	s.appID = s.setting("TEAMS_APP_ID")
+	if s.appID == "" {
+		u.LogPrint(4, "TEAMS_APP_ID environment variable not set")
+	}
+	s.appPassword = s.setting("TEAMS_APP_PASSWORD")
+	if s.appPassword == "" {
+		u.LogPrint(4, "TEAMS_APP_PASSWORD environment variable not set")
+	}
+	s.serviceURL = withSlash(s.settingOr("TEAMS_SERVICE_URL", defaultServiceURL))
+	s.tokenURL = s.settingOr("TEAMS_TOKEN_URL", defaultTokenURL)
+	s.client = &http.Client{Timeout: 30 * time.Second}
+	s.token = &botToken{}
+	s.verifier = newTokenVerifier(
+		s.settingOr("TEAMS_JWKS_URL", defaultJWKSURL),
+		s.settingOr("TEAMS_TOKEN_ISSUER", defaultTokenIssuer),
+		s.appID,
+		s.client)
+	// Every Bot Framework call goes through the limiter so we stay under its limits
+	s.limiter = s.newTeamsLimiter()
+	// Fetch the keys now, so a wrong TEAMS_JWKS_URL shows up at startup
+	if err := s.verifier.refresh(); err != nil {
+		u.LogPrint(3, "[TEAMS] Failed to fetch the token signing keys: %v", err)
+	}
+	// Activities are processed off the work queue
+	queue.Register(activityJobKind, s.processActivity)
+	u.LogPrint(1, "[TEAMS] Posting tickets to %s", s.serviceURL)
+	return nil
+}
+
+// withSlash makes sure a base URL ends with a slash, so paths can be appended
+func withSlash(url string) string {
+	if strings.HasSuffix(url, "/") {
+		return url
+	}
+	return url + "/"
+}
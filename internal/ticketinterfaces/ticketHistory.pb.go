@@ -0,0 +1,190 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        v3.12.4
+// source: ticketHistory.proto
+
+package ticketinterfaces
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TicketHistory struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IssueKey  string `protobuf:"bytes,1,opt,name=IssueKey,proto3" json:"IssueKey,omitempty"`
+	EventDate string `protobuf:"bytes,2,opt,name=EventDate,proto3" json:"EventDate,omitempty"`
+	Event     string `protobuf:"bytes,3,opt,name=Event,proto3" json:"Event,omitempty"`
+	User      string `protobuf:"bytes,4,opt,name=User,proto3" json:"User,omitempty"`
+	Reason    string `protobuf:"bytes,5,opt,name=Reason,proto3" json:"Reason,omitempty"`
+	Comment   string `protobuf:"bytes,6,opt,name=Comment,proto3" json:"Comment,omitempty"`
+}
+
+func (x *TicketHistory) Reset() {
+	*x = TicketHistory{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ticketHistory_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TicketHistory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TicketHistory) ProtoMessage() {}
+
+func (x *TicketHistory) ProtoReflect() protoreflect.Message {
+	mi := &file_ticketHistory_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TicketHistory.ProtoReflect.Descriptor instead.
+func (*TicketHistory) Descriptor() ([]byte, []int) {
+	return file_ticketHistory_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TicketHistory) GetIssueKey() string {
+	if x != nil {
+		return x.IssueKey
+	}
+	return ""
+}
+
+func (x *TicketHistory) GetEventDate() string {
+	if x != nil {
+		return x.EventDate
+	}
+	return ""
+}
+
+func (x *TicketHistory) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *TicketHistory) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *TicketHistory) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *TicketHistory) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+var File_ticketHistory_proto protoreflect.FileDescriptor
+
+var file_ticketHistory_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xa5, 0x01, 0x0a, 0x0d, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74,
+	0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x49, 0x73, 0x73, 0x75, 0x65,
+	0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x49, 0x73, 0x73, 0x75, 0x65,
+	0x4b, 0x65, 0x79, 0x12, 0x1c, 0x0a, 0x09, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x44, 0x61, 0x74, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x44, 0x61, 0x74,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x55, 0x73, 0x65, 0x72, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x55, 0x73, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x52,
+	0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x52, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x43, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x43, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x74, 0x42, 0x14, 0x5a,
+	0x12, 0x2e, 0x2f, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61,
+	0x63, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_ticketHistory_proto_rawDescOnce sync.Once
+	file_ticketHistory_proto_rawDescData = file_ticketHistory_proto_rawDesc
+)
+
+func file_ticketHistory_proto_rawDescGZIP() []byte {
+	file_ticketHistory_proto_rawDescOnce.Do(func() {
+		file_ticketHistory_proto_rawDescData = protoimpl.X.CompressGZIP(file_ticketHistory_proto_rawDescData)
+	})
+	return file_ticketHistory_proto_rawDescData
+}
+
+var file_ticketHistory_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_ticketHistory_proto_goTypes = []interface{}{
+	(*TicketHistory)(nil), // 0: TicketHistory
+}
+var file_ticketHistory_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_ticketHistory_proto_init() }
+func file_ticketHistory_proto_init() {
+	if File_ticketHistory_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_ticketHistory_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TicketHistory); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_ticketHistory_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ticketHistory_proto_goTypes,
+		DependencyIndexes: file_ticketHistory_proto_depIdxs,
+		MessageInfos:      file_ticketHistory_proto_msgTypes,
+	}.Build()
+	File_ticketHistory_proto = out.File
+	file_ticketHistory_proto_rawDesc = nil
+	file_ticketHistory_proto_goTypes = nil
+	file_ticketHistory_proto_depIdxs = nil
+}
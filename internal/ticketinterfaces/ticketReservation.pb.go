@@ -0,0 +1,264 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        v3.12.4
+// source: ticketReservation.proto
+
+package ticketinterfaces
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TicketReservation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TargetResource     string   `protobuf:"bytes,1,opt,name=TargetResource,proto3" json:"TargetResource,omitempty"`
+	RecommenderID      string   `protobuf:"bytes,2,opt,name=RecommenderID,proto3" json:"RecommenderID,omitempty"`
+	RecommenderSubtype string   `protobuf:"bytes,3,opt,name=RecommenderSubtype,proto3" json:"RecommenderSubtype,omitempty"`
+	ProjectID          string   `protobuf:"bytes,4,opt,name=ProjectID,proto3" json:"ProjectID,omitempty"`
+	State              string   `protobuf:"bytes,5,opt,name=State,proto3" json:"State,omitempty"`
+	IssueKey           string   `protobuf:"bytes,6,opt,name=IssueKey,proto3" json:"IssueKey,omitempty"`
+	TargetContact      string   `protobuf:"bytes,7,opt,name=TargetContact,proto3" json:"TargetContact,omitempty"`
+	Subject            string   `protobuf:"bytes,8,opt,name=Subject,proto3" json:"Subject,omitempty"`
+	Assignee           []string `protobuf:"bytes,9,rep,name=Assignee,proto3" json:"Assignee,omitempty"`
+	Owner              string   `protobuf:"bytes,10,opt,name=Owner,proto3" json:"Owner,omitempty"`
+	CreationDate       string   `protobuf:"bytes,11,opt,name=CreationDate,proto3" json:"CreationDate,omitempty"`
+	LastUpdateDate     string   `protobuf:"bytes,12,opt,name=LastUpdateDate,proto3" json:"LastUpdateDate,omitempty"`
+	Locale             string   `protobuf:"bytes,13,opt,name=Locale,proto3" json:"Locale,omitempty"`
+}
+
+func (x *TicketReservation) Reset() {
+	*x = TicketReservation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_ticketReservation_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TicketReservation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TicketReservation) ProtoMessage() {}
+
+func (x *TicketReservation) ProtoReflect() protoreflect.Message {
+	mi := &file_ticketReservation_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TicketReservation.ProtoReflect.Descriptor instead.
+func (*TicketReservation) Descriptor() ([]byte, []int) {
+	return file_ticketReservation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TicketReservation) GetTargetResource() string {
+	if x != nil {
+		return x.TargetResource
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetRecommenderID() string {
+	if x != nil {
+		return x.RecommenderID
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetRecommenderSubtype() string {
+	if x != nil {
+		return x.RecommenderSubtype
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetProjectID() string {
+	if x != nil {
+		return x.ProjectID
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetIssueKey() string {
+	if x != nil {
+		return x.IssueKey
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetTargetContact() string {
+	if x != nil {
+		return x.TargetContact
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetAssignee() []string {
+	if x != nil {
+		return x.Assignee
+	}
+	return nil
+}
+
+func (x *TicketReservation) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetCreationDate() string {
+	if x != nil {
+		return x.CreationDate
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetLastUpdateDate() string {
+	if x != nil {
+		return x.LastUpdateDate
+	}
+	return ""
+}
+
+func (x *TicketReservation) GetLocale() string {
+	if x != nil {
+		return x.Locale
+	}
+	return ""
+}
+
+var File_ticketReservation_proto protoreflect.FileDescriptor
+
+var file_ticketReservation_proto_rawDesc = []byte{
+	0x0a, 0x17, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x73, 0x65, 0x72, 0x76, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xb7, 0x03, 0x0a, 0x11, 0x54, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x73, 0x65, 0x72, 0x76, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x26, 0x0a, 0x0e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52,
+	0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x24, 0x0a, 0x0d, 0x52, 0x65, 0x63, 0x6f, 0x6d,
+	0x6d, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d,
+	0x52, 0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x49, 0x44, 0x12, 0x2e, 0x0a,
+	0x12, 0x52, 0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x53, 0x75, 0x62, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x12, 0x52, 0x65, 0x63, 0x6f, 0x6d,
+	0x6d, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x53, 0x75, 0x62, 0x74, 0x79, 0x70, 0x65, 0x12, 0x1c, 0x0a,
+	0x09, 0x50, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x49, 0x44, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x50, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x49, 0x44, 0x12, 0x14, 0x0a, 0x05, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x12, 0x1a, 0x0a, 0x08, 0x49, 0x73, 0x73, 0x75, 0x65, 0x4b, 0x65, 0x79, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x49, 0x73, 0x73, 0x75, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x24, 0x0a,
+	0x0d, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x63, 0x74, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x74,
+	0x61, 0x63, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x53, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x12, 0x1a, 0x0a,
+	0x08, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x65, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x08, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x4f, 0x77, 0x6e,
+	0x65, 0x72, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x12,
+	0x22, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x44, 0x61, 0x74, 0x65, 0x18,
+	0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x44,
+	0x61, 0x74, 0x65, 0x12, 0x26, 0x0a, 0x0e, 0x4c, 0x61, 0x73, 0x74, 0x55, 0x70, 0x64, 0x61, 0x74,
+	0x65, 0x44, 0x61, 0x74, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x4c, 0x61, 0x73,
+	0x74, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x44, 0x61, 0x74, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x4c,
+	0x6f, 0x63, 0x61, 0x6c, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x4c, 0x6f, 0x63,
+	0x61, 0x6c, 0x65, 0x42, 0x14, 0x5a, 0x12, 0x2e, 0x2f, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_ticketReservation_proto_rawDescOnce sync.Once
+	file_ticketReservation_proto_rawDescData = file_ticketReservation_proto_rawDesc
+)
+
+func file_ticketReservation_proto_rawDescGZIP() []byte {
+	file_ticketReservation_proto_rawDescOnce.Do(func() {
+		file_ticketReservation_proto_rawDescData = protoimpl.X.CompressGZIP(file_ticketReservation_proto_rawDescData)
+	})
+	return file_ticketReservation_proto_rawDescData
+}
+
+var file_ticketReservation_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_ticketReservation_proto_goTypes = []interface{}{
+	(*TicketReservation)(nil), // 0: TicketReservation
+}
+var file_ticketReservation_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_ticketReservation_proto_init() }
+func file_ticketReservation_proto_init() {
+	if File_ticketReservation_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_ticketReservation_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TicketReservation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_ticketReservation_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ticketReservation_proto_goTypes,
+		DependencyIndexes: file_ticketReservation_proto_depIdxs,
+		MessageInfos:      file_ticketReservation_proto_msgTypes,
+	}.Build()
+	File_ticketReservation_proto = out.File
+	file_ticketReservation_proto_rawDesc = nil
+	file_ticketReservation_proto_goTypes = nil
+	file_ticketReservation_proto_depIdxs = nil
+}
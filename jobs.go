@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	l "ticketservice/internal/lock"
+	s "ticketservice/internal/scheduler"
+	u "ticketservice/internal/utils"
+)
+
+// Job names, these are what /jobs reports
+const (
+	createTicketsJob = "createTickets"
+	reconcileJob     = "reconcileReservations"
+	remindersJob     = "sendReminders"
+	savingsReportJob = "savingsReport"
+)
+
+var jobScheduler = s.New()
+
+// Makes sure only one replica runs a job at a time
+var jobLocker l.Locker
+
+// registerJobs adds every job to the scheduler. Jobs without a schedule
+// are still registered so they can be triggered over HTTP and show up in /jobs.
+func registerJobs() error {
+	jobs := []struct {
+		name     string
+		lock     string
+		schedule string
+		jitter   time.Duration
+		run      func(ctx context.Context) error
+	}{
+		{createTicketsJob, createTicketsJob, c.Jobs.CreateTickets.Schedule, c.Jobs.CreateTickets.Jitter, func(ctx context.Context) error {
+			return checkAndCreateNewTickets(ctx)
+		}},
+		// Ticket runs reconcile first, sharing their lock keeps the two
+		// from reconciling the same reservations at once
+		{reconcileJob, createTicketsJob, c.Jobs.Reconcile.Schedule, c.Jobs.Reconcile.Jitter, func(ctx context.Context) error {
+			return reconcileReservations(ctx)
+		}},
+		// Reminders go through the same tickets, sharing the lock keeps a
+		// ticket run and a reminder run from reminding about one twice
+		{remindersJob, createTicketsJob, c.Jobs.Reminders.Schedule, c.Jobs.Reminders.Jitter, func(ctx context.Context) error {
+			return sendReminders(ctx)
+		}},
+		{savingsReportJob, savingsReportJob, c.Jobs.SavingsReport.Schedule, c.Jobs.SavingsReport.Jitter, func(ctx context.Context) error {
+			return logSuppressedSavings()
+		}},
+	}
+	for _, j := range jobs {
+		var schedule s.Schedule
+		if j.schedule != "" {
+			var err error
+			schedule, err = s.ParseSchedule(j.schedule)
+			if err != nil {
+				return fmt.Errorf("invalid schedule for %s: %v", j.name, err)
+			}
+			u.LogPrint(2, "Scheduling %s with %q", j.name, j.schedule)
+		}
+		err := jobScheduler.Register(s.Job{
+			Name:     j.name,
+			Schedule: schedule,
+			Jitter:   j.jitter,
+			Run:      guardJob(j.lock, j.run),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logSuppressedSavings logs what the active suppressions hide in each currency
+func logSuppressedSavings() error {
+	savings, totals, err := suppressedSavingsReport()
+	if err != nil {
+		return err
+	}
+	u.LogPrint(2, "%d active suppressions hide savings in %d currencies", len(savings), len(totals))
+	for currency, total := range totals {
+		u.LogPrint(2, "Suppressed: %d recommendations saving %d %s", total.Recommendations, total.Savings, currency)
+	}
+	return nil
+}
+
+// guardJob wraps a job so it only runs while holding the named lock. When
+// another replica holds it the run is reported as skipped.
+func guardJob(lock string, run func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		err := l.WithLock(ctx, jobLocker, "job-"+lock, instanceID, c.Store.Lock.TTL, run)
+		if errors.Is(err, l.ErrLockHeld) {
+			return fmt.Errorf("%w: %v", s.ErrSkipped, err)
+		}
+		return err
+	}
+}
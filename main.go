@@ -15,72 +15,320 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 	b "ticketservice/internal/bigqueryfunctions"
+	conf "ticketservice/internal/config"
+	"ticketservice/internal/authz"
+	"ticketservice/internal/locale"
+	l "ticketservice/internal/lock"
+	"ticketservice/internal/policy"
+	"ticketservice/internal/queue"
+	s "ticketservice/internal/scheduler"
+	"ticketservice/internal/templates"
 	t "ticketservice/internal/ticketinterfaces"
 	u "ticketservice/internal/utils"
 
-	"github.com/codingconcepts/env"
 	"github.com/labstack/echo/v4"
 )
 
-type config struct {
-	BqDataset string `env:"BQ_DATASET" required:"true"`
-	BqProject string `env:"BQ_PROJECT" required:"true"`
-	BqRecommendationsTable string `env:"BQ_RECOMMENDATIONS_TABLE" default:"flattened_recommendations"`
-	BqTicketTable	string `env:"BQ_TICKET_TABLE" default:"recommender_ticket_table"`
-	BqRoutingTable	string `env:"BQ_ROUTING_TABLE" default:"recommender_routing_table"`
-	TicketImpl	string `env:"TICKET_SERVICE_IMPL" default:"slackTicket"` //Needs to be the same name as the file without the extension
-	TicketCostThreshold int `env:"TICKET_COST_THRESHOLD" default:"100"`
-	TicketLimitPerCall int `env:"TICKET_LIMIT" default:"5"`
-	AllowNullCost bool `env:"ALLOW_NULL_COST" default:"false"`
-	ExcludeSubTypes string `env:"EXCLUDE_SUB_TYPES" default:"' '"` // Use commas to seperate
-}
-
-var c config
+// c is the config the service started with. Sections a reload can change
+// are read through currentConfig instead.
+var c conf.Config
 var ticketService t.BaseTicketService
+// Identifies this instance in reservations, so we know who left them behind
+var instanceID string
+
+var (
+	configFile        = flag.String("config", os.Getenv("CONFIG_FILE"), "Path to a YAML or JSON config file")
+	validateConfig    = flag.Bool("validate-config", false, "Validate the configuration, report every problem and exit")
+	validateTemplates = flag.Bool("validate-templates", false, "Render every template against sample rows, print the output and exit")
+)
 
-// Init function for startup of application
-func init() {
+// loadConfig loads the config file and environment overrides,
+// returning every problem found along the way.
+func loadConfig() []error {
+	var problems []error
+	c, problems = conf.Load(*configFile)
+	return append(problems, c.Validate()...)
+}
+
+// setup prepares BigQuery and the ticket plugin for startup of application
+func setup() {
 	// Print Startup so we know it's not lagging
-	log.SetOutput(os.Stdout)
 	u.LogPrint(1, "Ticket Service Starting")
-	//Load env variables using "github.com/codingconcepts/env"
-	if err := env.Set(&c); err != nil {
-		u.LogPrint(4,err)
+	if problems := loadConfig(); len(problems) > 0 {
+		for _, p := range problems {
+			log.Printf("Config: %v", p)
+		}
+		log.Fatalf("Invalid configuration, %d problem(s) found", len(problems))
+	}
+	startup := c
+	liveConfig.Store(&startup)
+	policy.SetCurrent(c.PolicySet())
+	locale.SetCurrent(c.LocaleSettings())
+	authz.SetCurrent(c.AuthzRules())
+	library, problems := loadTemplates(c)
+	if len(problems) > 0 {
+		for _, p := range problems {
+			log.Printf("Templates: %v", p)
+		}
+		log.Fatalf("Invalid templates, %d problem(s) found", len(problems))
 	}
+	templates.SetCurrent(library)
+	hostname, _ := os.Hostname()
+	instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
 	//initialize BigQuery
-	b.InitBQ(c.BqDataset, c.BqProject, c.BqTicketTable)
+	b.InitBQ(c.Store.Dataset, c.Store.Project, c.Store.TicketTable)
+	b.SetRecommendationsTable(c.Store.RecommendationsTable)
 	//Check For Access and Existence of BQ Table.
 	u.LogPrint(1, "Creating Ticket Table")
-	err := b.CreateOrUpdateTicketTable(c.BqTicketTable)
+	err := b.CreateOrUpdateTicketTable(c.Store.TicketTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	u.LogPrint(1, "Creating Reservation Table")
+	err = b.CreateOrUpdateReservationTable(c.Store.ReservationTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	u.LogPrint(1, "Creating History Table")
+	err = b.CreateOrUpdateHistoryTable(c.Store.HistoryTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	u.LogPrint(1, "Creating Suppression Table")
+	err = b.CreateOrUpdateSuppressionTable(c.Store.SuppressionTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Store.Lock.Backend == "bigquery" {
+		u.LogPrint(1, "Creating Lock Table")
+		err = b.CreateOrUpdateLockTable(c.Store.Lock.Table)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	jobLocker, err = l.New(c.Store.Lock.Backend, c.Store.Lock.FileDir, c.Store.Lock.Table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Store.Queue.Backend == "bigquery" {
+		u.LogPrint(1, "Creating Queue Table")
+		err = b.CreateOrUpdateQueueTable(c.Store.Queue.Table)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	workQueue, err := queue.New(c.Store.Queue.Backend, c.Store.Queue.FileDir, c.Store.Queue.Table)
 	if err != nil {
 		log.Fatal(err)
 	}
+	queue.SetCurrent(workQueue)
 	u.LogPrint(1, "Creating Routing Table")
-	err = b.CreateOrUpdateRoutingTable(c.BqRoutingTable)
+	err = b.CreateOrUpdateRoutingTable(c.Store.RoutingTable)
 	if err != nil {
 		log.Fatal(err)
 	}
-	ticketService, err = t.InitTicketService(c.TicketImpl)
+	u.LogPrint(1, "Loading Routing Cache")
+	routing, err := b.LoadRoutingCache(c.Store.RoutingTable)
+	if err != nil {
+		// Lookups go straight to the table until a reload succeeds
+		u.LogPrint(3, "Failed to load routing cache: %v", err)
+	} else {
+		b.SetRoutingCache(routing)
+	}
+	ticketService, err = t.InitTicketService(c.Backend.Impl, c.Backend.Settings)
 	if err != nil {
 		u.LogPrint(4,"Failed to load ticket service plugin", err)
 	}
+	authz.SetResolver(resolveIdentities)
+	if routing != nil {
+		// Resolving can take a while with a large routing table
+		go reportUnresolvedIdentities(routing)
+	}
+	// Started after the plugin registers its handlers, jobs left from
+	// before a restart would be dead lettered otherwise
+	worker := &queue.Worker{
+		Queue:             workQueue,
+		Workers:           c.Store.Queue.Workers,
+		MaxAttempts:       c.Store.Queue.MaxAttempts,
+		VisibilityTimeout: c.Store.Queue.VisibilityTimeout,
+		PollInterval:      c.Store.Queue.PollInterval,
+		RetryBackoff:      c.Store.Queue.RetryBackoff,
+	}
+	go worker.Run(context.Background())
+}
+
+// apiUser is who made an API request, as told by the proxy in front of the
+// service. IAP prefixes the email with the identity provider, which goes.
+func apiUser(ctx echo.Context) string {
+	user := ctx.Request().Header.Get(currentConfig().Authorization.UserHeader)
+	if i := strings.LastIndex(user, ":"); i >= 0 {
+		user = user[i+1:]
+	}
+	return user
+}
+
+// ticketError answers a request for a ticket that couldn't be fetched
+func ticketError(ctx echo.Context, err error) error {
+	status := http.StatusBadRequest
+	if errors.Is(err, b.ErrTicketNotFound) {
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// denied answers a request authz refused, or fails it for any other error
+func denied(ctx echo.Context, err error) error {
+	if d, ok := err.(*authz.DeniedError); ok {
+		return ctx.JSON(http.StatusForbidden, map[string]string{
+			"error": d.Error(),
+		})
+	}
+	return ctx.JSON(http.StatusInternalServerError, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// reopenTicket saves a ticket as reopened, lifting the suppression of a
+// dismissed one. The next reminder follows the usual snooze days.
+func reopenTicket(ticket *t.Ticket, user string) error {
+	now := time.Now()
+	subtype, err := b.GetTicketSubtype(ticket)
+	if err != nil {
+		// The recommendation may be gone from the export, the recommender's policy still applies
+		u.LogPrint(2, "Failed to look up the recommendation of %s: %v", ticket.IssueKey, err)
+	}
+	if ticket.Status == "Dismissed" {
+		// Otherwise the suppression keeps the reopened ticket from any reminder
+		if err := b.LiftResourceSuppressions(c.Store.SuppressionTable, ticket.TargetResource, subtype); err != nil {
+			return err
+		}
+	}
+	snoozeDays := policy.Current().Match(ticket.RecommenderID, subtype).SnoozeDays
+	ticket.SnoozeDate = now.AddDate(0, 0, snoozeDays).Format(time.RFC3339)
+	ticket.Status = "Reopened"
+	ticket.Reason = ""
+	ticket.Comment = ""
+	ticket.LastUpdateDate = now.Format(time.RFC3339)
+	if err := b.AppendTicketsToTable(c.Store.TicketTable, []*t.Ticket{ticket}); err != nil {
+		return err
+	}
+	entry := &t.TicketHistory{IssueKey: ticket.IssueKey, Event: t.EventReopened, User: user}
+	if err := b.AppendHistory("", []*t.TicketHistory{entry}); err != nil {
+		u.LogPrint(3, "Failed to record reopening %s in ticket history: %v", ticket.IssueKey, err)
+	}
+	return nil
+}
+
+// checkTemplates loads the config and templates, renders each template
+// against the sample rows and returns the exit code.
+func checkTemplates() int {
+	// Only problems reading the config matter here, the rest is --validate-config's job.
+	// Policy templates are picked by policy, so they need to be in effect
+	var problems []error
+	c, problems = conf.Load(*configFile)
+	policy.SetCurrent(c.PolicySet())
+	locale.SetCurrent(c.LocaleSettings())
+	library, loadProblems := loadTemplates(c)
+	problems = append(problems, loadProblems...)
+	if library != nil {
+		rendered, renderProblems := library.Check(templates.Samples())
+		for _, r := range rendered {
+			fmt.Printf("--- %s (%s sample)\n%s\n", r.Template, r.Sample, strings.TrimSpace(r.Output))
+		}
+		problems = append(problems, renderProblems...)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Println("Templates are valid")
+	return 0
 }
 
 func main() {
+	log.SetOutput(os.Stdout)
+	flag.Parse()
+	if *validateConfig {
+		problems := loadConfig()
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("%d problem(s) found\n", len(problems))
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+		return
+	}
+	if *validateTemplates {
+		os.Exit(checkTemplates())
+	}
+	setup()
+
+	if err := registerJobs(); err != nil {
+		log.Fatal(err)
+	}
+	jobScheduler.Start()
+	defer jobScheduler.Stop()
+	watchReloadSignal()
 
 	e := echo.New()
 
-	e.GET("/CreateTickets", func(c echo.Context) error {
-		err := checkAndCreateNewTickets()
-		if err != nil{
-			u.LogPrint(3,"Error creating new ticket: %v",err)
-			return err
+	// The HTTP trigger goes through the scheduler as well so it can't overlap a scheduled run
+	if c.Jobs.HTTPTrigger {
+		e.GET("/CreateTickets", func(c echo.Context) error {
+			err := jobScheduler.RunNow(createTicketsJob)
+			if errors.Is(err, s.ErrJobRunning) || errors.Is(err, s.ErrSkipped) {
+				return c.JSON(http.StatusConflict, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			if err != nil{
+				u.LogPrint(3,"Error creating new ticket: %v",err)
+				return err
+			}
+			return nil
+		})
+	}
+
+	// Last run, next run and last result for each job
+	e.GET("/jobs", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, jobScheduler.Status())
+	})
+
+	// Reload templates, policies and routing. The old ones stay if anything is wrong.
+	e.POST("/admin/reload", func(c echo.Context) error {
+		if err := authz.AuthorizeAdmin(apiUser(c), "reload the configuration"); err != nil {
+			return denied(c, err)
+		}
+		if problems := reload(); len(problems) > 0 {
+			logReloadProblems(problems)
+			messages := make([]string, len(problems))
+			for i, p := range problems {
+				messages[i] = p.Error()
+			}
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+				"errors": messages,
+			})
 		}
-		return nil
+		return c.JSON(http.StatusOK, map[string]string{
+			"status": "reloaded",
+		})
 	})
 
 	// Create a new ticket.
@@ -91,6 +339,9 @@ func main() {
 				"error": err.Error(),
 			})
 		}
+		if err := authz.Authorize(apiUser(c), "create tickets", &ticket); err != nil {
+			return denied(c, err)
+		}
 		issueKey, err := ticketService.CreateTicket(&ticket, t.RecommendationQueryResult{})
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
@@ -108,14 +359,19 @@ func main() {
 		var issueKey = c.Param("issueKey")
 
 		// Check to make sure the ticket exists before continuing
-		_, err := ticketService.GetTicket(issueKey)
+		ticket, err := ticketService.GetTicket(issueKey)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				// Gonna need to think if this is ok to send back.
-				"error": err.Error(),
-			})
+			// Gonna need to think if this is ok to send back.
+			return ticketError(c, err)
+		}
+
+		if err := authz.Authorize(apiUser(c), "close this ticket", &ticket); err != nil {
+			return denied(c, err)
 		}
 
+		if err := ticketService.UpdateTicket(&ticket, t.RecommendationQueryResult{}, t.EventClosed); err != nil {
+			u.LogPrint(3, "Failed to post closed message to %s: %v", issueKey, err)
+		}
 		if err := ticketService.CloseTicket(issueKey); err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
@@ -125,6 +381,52 @@ func main() {
 		return c.NoContent(http.StatusNoContent)
 	})
 
+	// Reopen a closed ticket, the only way back for an archived channel.
+	e.PUT("/tickets/:issueKey/reopen", func(c echo.Context) error {
+		issueKey := c.Param("issueKey")
+		ticket, err := ticketService.GetTicket(issueKey)
+		if err != nil {
+			return ticketError(c, err)
+		}
+		if err := authz.Authorize(apiUser(c), "reopen this ticket", &ticket); err != nil {
+			return denied(c, err)
+		}
+		if reopenable, ok := ticketService.(t.ReopenableTicketService); ok {
+			if err := reopenable.ReopenTicket(issueKey); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+		}
+		if err := reopenTicket(&ticket, apiUser(c)); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err := ticketService.UpdateTicket(&ticket, t.RecommendationQueryResult{}, t.EventReopened); err != nil {
+			u.LogPrint(3, "Failed to post reopened message to %s: %v", issueKey, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	// List, create and lift suppressions, and report what they hide
+	registerSuppressionRoutes(e)
+
+	// Jobs that ran out of attempts, for someone to look into
+	e.GET("/queue/dead", func(c echo.Context) error {
+		// Dead letters hold raw webhook payloads, messages and user IDs included
+		if err := authz.AuthorizeAdmin(apiUser(c), "list dead letters"); err != nil {
+			return denied(c, err)
+		}
+		jobs, err := queue.Current().DeadLetters(c.Request().Context())
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusOK, jobs)
+	})
+
 	// Handle webhook actions.
 	e.POST("/webhooks", func(c echo.Context) error {
 		u.LogPrint(1, "Webhook recieved")
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"ticketservice/internal/authz"
+	b "ticketservice/internal/bigqueryfunctions"
+	conf "ticketservice/internal/config"
+	"ticketservice/internal/locale"
+	"ticketservice/internal/policy"
+	"ticketservice/internal/templates"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+)
+
+// Only one reload runs at a time, SIGHUP and the endpoint share it
+var reloadMutex sync.Mutex
+
+// liveConfig is the config the service runs with, swapped whole on reload
+var liveConfig atomic.Pointer[conf.Config]
+
+// currentConfig returns the config as of the last reload. Until setup has
+// loaded one it's the startup config.
+func currentConfig() *conf.Config {
+	if cfg := liveConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &c
+}
+
+// reload re-reads the config file, the templates and the routing table.
+// Everything is loaded and checked before anything is swapped, so a bad
+// file leaves the service running with what it had. Changes to settings
+// only read at startup are rejected rather than silently ignored.
+func reload() []error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	u.LogPrint(1, "Reloading configuration")
+	next, problems := conf.Load(*configFile)
+	problems = append(problems, next.Validate()...)
+	problems = append(problems, restartRequired(next)...)
+	if len(problems) > 0 {
+		return problems
+	}
+	library, problems := loadTemplates(next)
+	if len(problems) > 0 {
+		return problems
+	}
+	routing, err := b.LoadRoutingCache(next.Store.RoutingTable)
+	if err != nil {
+		return []error{fmt.Errorf("Failed to load routing table: %w", err)}
+	}
+
+	// The plugin goes first, it's the only step that can still fail
+	if reloadable, ok := ticketService.(t.ReloadableTicketService); ok {
+		if err := reloadable.Reload(next.Backend.Settings); err != nil {
+			return []error{fmt.Errorf("Ticket service rejected reload: %w", err)}
+		}
+	}
+	policy.SetCurrent(next.PolicySet())
+	locale.SetCurrent(next.LocaleSettings())
+	authz.SetCurrent(next.AuthzRules())
+	templates.SetCurrent(library)
+	b.SetRoutingCache(routing)
+	applyReloadable(next)
+	go reportUnresolvedIdentities(routing)
+	u.LogPrint(2, "Reloaded configuration, routing for %d projects", routing.Projects())
+	return nil
+}
+
+// loadTemplates parses the default, per subtype and policy templates of a config
+func loadTemplates(cfg conf.Config) (*templates.Library, []error) {
+	defaults := templatePaths(cfg.Templates.EventTemplates)
+	subtypes := make(map[string]templates.Paths)
+	for subtype, events := range cfg.Templates.Subtypes {
+		subtypes[subtype] = templatePaths(events)
+	}
+	var files []string
+	for _, p := range cfg.Policies {
+		if p.TitleTemplate != "" {
+			files = append(files, p.TitleTemplate)
+		}
+		if p.UpdateTemplate != "" {
+			files = append(files, p.UpdateTemplate)
+		}
+	}
+	return templates.Load(defaults, subtypes, files, cfg.Localization.Locales)
+}
+
+func templatePaths(events conf.EventTemplates) templates.Paths {
+	paths := make(templates.Paths)
+	for _, file := range events.Files() {
+		paths[file.Kind] = file.Path
+	}
+	return paths
+}
+
+// restartRequired rejects changes to settings that are only read at startup
+func restartRequired(next conf.Config) []error {
+	var problems []error
+	if next.Store != c.Store {
+		problems = append(problems, fmt.Errorf("store section changed, restart to apply it"))
+	}
+	if next.Jobs != c.Jobs {
+		problems = append(problems, fmt.Errorf("jobs section changed, restart to apply it"))
+	}
+	if next.Backend.Impl != c.Backend.Impl {
+		problems = append(problems, fmt.Errorf("backend.impl changed, restart to apply it"))
+	}
+	if next.Tickets.Workers != c.Tickets.Workers {
+		problems = append(problems, fmt.Errorf("tickets.workers changed, restart to apply it"))
+	}
+	if next.Authorization.UserHeader != c.Authorization.UserHeader {
+		problems = append(problems, fmt.Errorf("authorization.userHeader changed, restart to apply it"))
+	}
+	return problems
+}
+
+// applyReloadable publishes the reloaded config, so the config the service
+// holds matches what it runs with. c is never written after startup,
+// restartRequired made sure the sections read from it are unchanged.
+func applyReloadable(next conf.Config) {
+	liveConfig.Store(&next)
+}
+
+func logReloadProblems(problems []error) {
+	for _, p := range problems {
+		u.LogPrint(3, "Reload: %v", p)
+	}
+	if len(problems) > 0 {
+		u.LogPrint(3, "Reload failed, %d problem(s) found, keeping the current configuration", len(problems))
+	}
+}
+
+// watchReloadSignal reloads whenever the process gets a SIGHUP
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			logReloadProblems(reload())
+		}
+	}()
+}
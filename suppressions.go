@@ -0,0 +1,193 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"ticketservice/internal/authz"
+	b "ticketservice/internal/bigqueryfunctions"
+	t "ticketservice/internal/ticketinterfaces"
+	u "ticketservice/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// Label keys and values are lower case letters, numbers, dashes and underscores
+	labelSelectorRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]*=[a-z0-9_-]*$`)
+	suppressionIDRegex = regexp.MustCompile(`^[a-f0-9]{16}$`)
+)
+
+// registerSuppressionRoutes adds the endpoints managing suppressions
+func registerSuppressionRoutes(e *echo.Echo) {
+	e.GET("/suppressions", listSuppressions)
+	e.POST("/suppressions", createSuppression)
+	e.DELETE("/suppressions/:id", deleteSuppression)
+	e.GET("/suppressions/savings", suppressedSavings)
+}
+
+// validateSuppression checks a suppression before it's written, normalizing its expiry to UTC.
+func validateSuppression(s *t.Suppression, now time.Time) error {
+	bySubtype := s.RecommenderSubtype != "" && s.ProjectID != ""
+	if s.TargetResource == "" && !bySubtype && len(s.Labels) == 0 {
+		return fmt.Errorf("a suppression needs a TargetResource, a RecommenderSubtype and ProjectID, or Labels")
+	}
+	if len(s.Labels) > 0 && c.Store.LabelsColumn == "" {
+		return fmt.Errorf("label suppressions need store.labelsColumn (BQ_LABELS_COLUMN) to be set")
+	}
+	for _, label := range s.Labels {
+		if !labelSelectorRegex.MatchString(label) {
+			return fmt.Errorf("label %q should look like key=value", label)
+		}
+	}
+	if s.ExpiryDate != "" {
+		expiry, err := time.Parse(time.RFC3339, s.ExpiryDate)
+		if err != nil {
+			return fmt.Errorf("ExpiryDate %q is not an RFC 3339 date: %v", s.ExpiryDate, err)
+		}
+		if !expiry.After(now) {
+			return fmt.Errorf("ExpiryDate %q is in the past", s.ExpiryDate)
+		}
+		s.ExpiryDate = expiry.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// List the suppressions in effect.
+func listSuppressions(ctx echo.Context) error {
+	suppressions, err := b.GetActiveSuppressions(c.Store.SuppressionTable)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if suppressions == nil {
+		suppressions = []*t.Suppression{}
+	}
+	return ctx.JSON(http.StatusOK, suppressions)
+}
+
+// Create a suppression. Tickets stop being created, and reminded, for
+// whatever it matches from the next run.
+func createSuppression(ctx echo.Context) error {
+	if err := authz.AuthorizeAdmin(apiUser(ctx), "create a suppression"); err != nil {
+		return denied(ctx, err)
+	}
+	var suppression t.Suppression
+	if err := ctx.Bind(&suppression); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err := validateSuppression(&suppression, time.Now()); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	id, err := b.NewSuppressionID()
+	if err != nil {
+		return err
+	}
+	suppression.ID = id
+	suppression.State = b.SuppressionActive
+	suppression.CreationDate = ""
+	if err := b.AppendSuppressions(c.Store.SuppressionTable, []*t.Suppression{&suppression}); err != nil {
+		u.LogPrint(3, "Failed to create suppression: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	u.LogPrint(2, "Created suppression %s for %s", suppression.ID, suppression.Owner)
+	return ctx.JSON(http.StatusCreated, &suppression)
+}
+
+// Lift a suppression, its recommendations get tickets again from the next run.
+func deleteSuppression(ctx echo.Context) error {
+	if err := authz.AuthorizeAdmin(apiUser(ctx), "delete a suppression"); err != nil {
+		return denied(ctx, err)
+	}
+	id := ctx.Param("id")
+	notFound := func() error {
+		return ctx.JSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("no suppression %s", id),
+		})
+	}
+	if !suppressionIDRegex.MatchString(id) {
+		return notFound()
+	}
+	suppression, err := b.GetSuppression(c.Store.SuppressionTable, id)
+	if errors.Is(err, b.ErrSuppressionNotFound) {
+		return notFound()
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if suppression.State == b.SuppressionDeleted {
+		return notFound()
+	}
+	suppression.State = b.SuppressionDeleted
+	if err := b.AppendSuppressions(c.Store.SuppressionTable, []*t.Suppression{suppression}); err != nil {
+		u.LogPrint(3, "Failed to delete suppression %s: %v", id, err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	u.LogPrint(2, "Deleted suppression %s", id)
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// savingsTotal is what the active suppressions hide in one currency
+type savingsTotal struct {
+	Recommendations int64
+	Savings         int64
+}
+
+// suppressedSavingsReport gets the potential savings hidden by each active
+// suppression and totals them by currency.
+func suppressedSavingsReport() ([]b.SuppressedSavings, map[string]savingsTotal, error) {
+	savings, err := b.GetSuppressedSavings(c.Store.SuppressionTable, c.Store.RecommendationsTable, c.Store.LabelsColumn)
+	if err != nil {
+		return nil, nil, err
+	}
+	totals := make(map[string]savingsTotal)
+	for _, s := range savings {
+		total := totals[s.CurrencyCode]
+		total.Recommendations += s.Recommendations
+		total.Savings += s.Savings
+		totals[s.CurrencyCode] = total
+	}
+	return savings, totals, nil
+}
+
+// Report the potential savings hidden by each active suppression, with totals by currency.
+func suppressedSavings(ctx echo.Context) error {
+	savings, totals, err := suppressedSavingsReport()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"suppressions": savings,
+		"totals":       totals,
+	})
+}
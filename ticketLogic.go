@@ -15,10 +15,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	b "ticketservice/internal/bigqueryfunctions"
+	"ticketservice/internal/locale"
+	"ticketservice/internal/policy"
 	"ticketservice/internal/ticketinterfaces"
 	u "ticketservice/internal/utils"
 	"time"
@@ -27,18 +32,51 @@ import (
 
 
 
-func checkAndCreateNewTickets() error {
-	var allowNullString string
-	if c.AllowNullCost {
-		allowNullString = "or impact_cost_unit is null"
+// checkAndCreateNewTickets creates and reminds about the tickets the query
+// finds. Once ctx is done no more recommendations are taken, the tickets
+// already created are still written.
+func checkAndCreateNewTickets(ctx context.Context) error {
+	// Clean up after any run that died part way through before looking for new work.
+	// Open reservations are excluded by the query, so a failure here can't cause duplicates.
+	if err := reconcileReservations(ctx); err != nil {
+		u.LogPrint(3, "Failed to reconcile ticket reservations: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return processTickets(ctx, false)
+}
+
+// sendReminders reminds about, and reopens, the existing tickets that are
+// due without creating any, for reminders on a schedule of their own.
+func sendReminders(ctx context.Context) error {
+	return processTickets(ctx, true)
+}
+
+// processTickets runs the query for tickets that are due and processes
+// each row, leaving out new recommendations when remindersOnly is set.
+func processTickets(ctx context.Context, remindersOnly bool) error {
+	existingOnly := ""
+	if remindersOnly {
+		existingOnly = "AND t.IssueKey IS NOT NULL"
+	}
+	policies := policy.Current()
+	labelsColumn := ""
+	if c.Store.LabelsColumn != "" {
+		labelsColumn = "f." + c.Store.LabelsColumn
 	}
 	query := fmt.Sprintf(ticketinterfaces.CheckQueryTpl, 
-		fmt.Sprintf("%s.%s", c.BqDataset, c.BqRecommendationsTable),
-		fmt.Sprintf("%s.%s", c.BqDataset, c.BqTicketTable),
-		c.TicketCostThreshold,
-		allowNullString,
-		c.ExcludeSubTypes,
-		c.TicketLimitPerCall,
+		fmt.Sprintf("%s.%s", c.Store.Dataset, c.Store.RecommendationsTable),
+		fmt.Sprintf("%s.%s", c.Store.Dataset, c.Store.TicketTable),
+		policies.FilterSQL("f.recommender_name", "f.recommender_subtype", "f.impact_cost_unit"),
+		policies.CapSQL("f.recommender_name", "f.recommender_subtype"),
+		excludeSubTypesFilter(policies.ExcludeSubTypes),
+		policies.MaxTotal(),
+		fmt.Sprintf("%s.%s", c.Store.Dataset, c.Store.ReservationTable),
+		policies.KeySQL("f.recommender_name", "f.recommender_subtype"),
+		b.SuppressionFilterSQL(c.Store.SuppressionTable, "TargetResource", "f.recommender_subtype", "f.project_id", labelsColumn),
+		policies.SnoozeDaysSQL("f.recommender_name", "f.recommender_subtype"),
+		existingOnly,
 	)
 	u.LogPrint(1, "Querying for new Tickets")
 	t := reflect.TypeOf(ticketinterfaces.RecommendationQueryResult{})
@@ -48,63 +86,306 @@ func checkAndCreateNewTickets() error {
 		return err
 	}
 	var rowsToInsert []*ticketinterfaces.Ticket
+	var reservations []*ticketinterfaces.TicketReservation
 	var rowsMutex sync.Mutex
 	var wg sync.WaitGroup
-	wg.Add(len(results))
-	for _, r := range results{
-		go func(r interface{}) error {
+	// A fixed number of workers keeps us from flooding the ticket
+	// backend when TICKET_LIMIT is raised.
+	workers := currentConfig().Tickets.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan interface{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
-			row, ok := r.(ticketinterfaces.RecommendationQueryResult);
-			if !ok {
-				return fmt.Errorf("Failed to convert Query Schema into RecommendationQueryResults")
-			}
-			ticket := row.Ticket
-			// Logic for if the ticket is already created
-			if ticket.IssueKey != ""{
-				u.LogPrint(3,"Already Exists: " + ticket.IssueKey)
-				ticket.RecommenderID = row.RecommenderName
-				ticket.SnoozeDate = time.Now().AddDate(0,0,7).Format(time.RFC3339)
+			for r := range queue {
+				ticket, reservation, err := processRecommendation(r)
+				if err != nil {
+					u.LogPrint(3, "Failed to process recommendation: %v", err)
+					continue
+				}
+				if ticket == nil {
+					continue
+				}
 				rowsMutex.Lock()
 				rowsToInsert = append(rowsToInsert, ticket)
+				if reservation != nil {
+					reservations = append(reservations, reservation)
+				}
 				rowsMutex.Unlock()
-				return nil
-			}
-			u.LogPrint(1, "Retrieving Routing Information")
-			routingRows, err := b.GetRoutingRowsByProjectID(c.BqRoutingTable,row.ProjectId)
-			if err != nil {
-				u.LogPrint(3,"Failed to get routing information")
-				return err
-			}
-			// Check if the length of routingRows is zero
-			if len(routingRows) == 0 {
-				u.LogPrint(3, "No routing rows found for the given project ID: %v", row.ProjectId)
-				return fmt.Errorf("No routing rows found for the given project ID")
-			}
-			ticket.Status = "New"
-			ticket.TargetResource = row.TargetResource
-			ticket.RecommenderID = row.RecommenderName
-			ticket.TargetContact = routingRows[0].Target
-			ticket.Assignee = routingRows[0].TicketSystemIdentifiers
-			u.LogPrint(1,"Creating new Ticket")
-			ticketID, err := ticketService.CreateTicket(ticket, row)
-			if err != nil {
-				u.LogPrint(3, "Failed to create new ticket: %v", err)
-				return err
 			}
-			ticket.IssueKey = ticketID
-			rowsMutex.Lock()
-			rowsToInsert = append(rowsToInsert, ticket)
-			rowsMutex.Unlock()
-			return nil
-		}(r)
+		}()
+	}
+feed:
+	for _, r := range results {
+		select {
+		case queue <- r:
+		case <-ctx.Done():
+			u.LogPrint(3, "Stopped creating tickets: %v", ctx.Err())
+			break feed
+		}
 	}
+	close(queue)
 	wg.Wait()
 	if len(rowsToInsert) > 0 {
-		err = b.AppendTicketsToTable(c.BqTicketTable, rowsToInsert)
+		err = b.AppendTicketsToTable(c.Store.TicketTable, rowsToInsert)
 		if err != nil {
-			u.LogPrint(3,err)
+			u.LogPrint(3,"Failed to append tickets: %v", err)
 			return err
 		}
 	}
+	// The tickets are safely stored, the reservations are no longer needed.
+	// If this fails they'll be picked up by the next reconcile, which is harmless.
+	if len(reservations) > 0 {
+		for _, r := range reservations {
+			r.State = b.ReservationFinalized
+		}
+		if err := b.AppendReservations(c.Store.ReservationTable, reservations); err != nil {
+			u.LogPrint(3, "Failed to finalize reservations: %v", err)
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
 	return err
 }
+
+
+// processRecommendation creates a ticket for a single query result, or pushes
+// out the snooze date of the ticket that already exists for it, reopening it
+// if it was closed while the recommendation is still there.
+// It returns the ticket row that should be appended to the ticket table and,
+// for new tickets, the reservation that needs finalizing once that row is written.
+// Tickets that aren't due return no row.
+func processRecommendation(r interface{}) (*ticketinterfaces.Ticket, *ticketinterfaces.TicketReservation, error) {
+	row, ok := r.(ticketinterfaces.RecommendationQueryResult);
+	if !ok {
+		return nil, nil, fmt.Errorf("Failed to convert Query Schema into RecommendationQueryResults")
+	}
+	ticket := row.Ticket
+	// Logic for if the ticket is already created
+	if ticket.IssueKey != ""{
+		now := time.Now()
+		snoozeDays := policy.Current().Match(row.RecommenderName, row.RecommenderSubtype).SnoozeDays
+		if !dueForUpdate(ticket, snoozeDays, now) {
+			u.LogPrint(1, "Not reminding about %s, it is %s", ticket.IssueKey, ticket.Status)
+			return nil, nil, nil
+		}
+		u.LogPrint(3,"Already Exists: " + ticket.IssueKey)
+		event := ticketinterfaces.EventReminder
+		if ticketinterfaces.IsClosed(ticket.Status) {
+			// Closing it didn't make the recommendation go away
+			if reopenable, ok := ticketService.(ticketinterfaces.ReopenableTicketService); ok {
+				if err := reopenable.ReopenTicket(ticket.IssueKey); err != nil {
+					u.LogPrint(3, "Failed to reopen %s: %v", ticket.IssueKey, err)
+					return nil, nil, err
+				}
+			}
+			u.LogPrint(2, "Reopening %s, its recommendation is still there", ticket.IssueKey)
+			ticket.Status = "Reopened"
+			ticket.Reason = ""
+			ticket.Comment = ""
+			event = ticketinterfaces.EventReopened
+		}
+		ticket.RecommenderID = row.RecommenderName
+		ticket.SnoozeDate = now.AddDate(0,0,snoozeDays).Format(time.RFC3339)
+		// The reminder row has to be the latest, or the ticket table keeps reading the old one
+		ticket.LastUpdateDate = now.Format(time.RFC3339)
+		// A failed reminder shouldn't stop the snooze date moving, or we'd retry every run
+		if err := ticketService.UpdateTicket(ticket, row, event); err != nil {
+			u.LogPrint(3, "Failed to send %s for %s: %v", event, ticket.IssueKey, err)
+		} else {
+			ticket.LastPingDate = now.Format(time.RFC3339)
+		}
+		return ticket, nil, nil
+	}
+	u.LogPrint(1, "Retrieving Routing Information")
+	routingRows, err := b.GetRoutingRowsByProjectID(c.Store.RoutingTable,row.ProjectId)
+	if err != nil {
+		u.LogPrint(3,"Failed to get routing information")
+		return nil, nil, err
+	}
+	// Check if the length of routingRows is zero
+	if len(routingRows) == 0 {
+		u.LogPrint(3, "No routing rows found for the given project ID: %v", row.ProjectId)
+		return nil, nil, fmt.Errorf("No routing rows found for the given project ID")
+	}
+	ticket.Status = "New"
+	ticket.TargetResource = row.TargetResource
+	ticket.RecommenderID = row.RecommenderName
+	ticket.TargetContact = routingRows[0].Target
+	ticket.Locale = locale.Current().Resolve(routingRows[0].Locale, ticket.TargetContact)
+	ticket.Assignee = resolveIdentities(routingRows[0].TicketSystemIdentifiers)
+	// Reserve the ticket before touching the backend so a crash can't leave
+	// a ticket behind that the next run doesn't know about.
+	reservation := &ticketinterfaces.TicketReservation{
+		TargetResource:     row.TargetResource,
+		RecommenderID:      row.RecommenderName,
+		RecommenderSubtype: row.RecommenderSubtype,
+		ProjectID:          row.ProjectId,
+		State:              b.ReservationPending,
+		TargetContact:      ticket.TargetContact,
+		Assignee:           ticket.Assignee,
+		Locale:             ticket.Locale,
+		Owner:              instanceID,
+	}
+	if err := b.AppendReservations(c.Store.ReservationTable, []*ticketinterfaces.TicketReservation{reservation}); err != nil {
+		u.LogPrint(3, "Failed to reserve ticket: %v", err)
+		return nil, nil, err
+	}
+	u.LogPrint(1,"Creating new Ticket")
+	ticketID, err := ticketService.CreateTicket(ticket, row)
+	if err != nil {
+		u.LogPrint(3, "Failed to create new ticket: %v", err)
+		// Let the next run try again. If we can't write this, reconcile will sort it out.
+		reservation.State = b.ReservationReleased
+		if err := b.AppendReservations(c.Store.ReservationTable, []*ticketinterfaces.TicketReservation{reservation}); err != nil {
+			u.LogPrint(3, "Failed to release reservation: %v", err)
+		}
+		return nil, nil, err
+	}
+	ticket.IssueKey = ticketID
+	// Record the IssueKey as soon as we have it, so reconcile doesn't need to ask the backend.
+	reservation.State = b.ReservationCreated
+	reservation.IssueKey = ticketID
+	reservation.Subject = ticket.Subject
+	if err := b.AppendReservations(c.Store.ReservationTable, []*ticketinterfaces.TicketReservation{reservation}); err != nil {
+		u.LogPrint(3, "Failed to record created reservation: %v", err)
+	}
+	return ticket, reservation, nil
+}
+
+// queryDateFormat is how CheckQueryTpl formats the dates of a ticket
+const queryDateFormat = "2006-01-02T15:04:05-0700"
+
+// parseQueryDate reads a ticket date from the query, or one we wrote
+func parseQueryDate(value string) (time.Time, error) {
+	date, err := time.Parse(queryDateFormat, value)
+	if err != nil {
+		date, err = time.Parse(time.RFC3339, value)
+	}
+	return date, err
+}
+
+// dueForUpdate tells if an existing ticket should get a reminder, open ones
+// once their snooze date has passed. A closed ticket is reopened when its
+// recommendation is still there snoozeDays after it was closed. Dismissed
+// recommendations are suppressed, they only come back once that's lifted.
+// Keep in line with the WHERE clause of CheckQueryTpl.
+func dueForUpdate(ticket *ticketinterfaces.Ticket, snoozeDays int, now time.Time) bool {
+	if snoozeDate, err := parseQueryDate(ticket.SnoozeDate); err == nil && now.Before(snoozeDate) {
+		return false
+	}
+	if ticketinterfaces.IsClosed(ticket.Status) {
+		closed, err := parseQueryDate(ticket.LastUpdateDate)
+		return err == nil && !now.Before(closed.AddDate(0, 0, snoozeDays))
+	}
+	return true
+}
+
+// reconcileReservations resolves reservations left open by a run that died
+// between creating a ticket in the backend and writing it to the ticket table.
+// Once ctx is done no more reservations are looked up, the ones already
+// resolved are still written.
+func reconcileReservations(ctx context.Context) error {
+	orphans, err := b.GetOrphanedReservations(c.Store.ReservationTable, c.Store.ReservationTimeout)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	u.LogPrint(2, "Reconciling %d orphaned reservations", len(orphans))
+	var tickets []*ticketinterfaces.Ticket
+	var resolved []*ticketinterfaces.TicketReservation
+	for _, res := range orphans {
+		if ctx.Err() != nil {
+			u.LogPrint(3, "Stopped reconciling reservations: %v", ctx.Err())
+			break
+		}
+		ticket := reservationToTicket(res)
+		issueKey := res.IssueKey
+		if issueKey == "" {
+			// We died during CreateTicket, so only the backend knows if it happened.
+			finder, ok := ticketService.(ticketinterfaces.TicketFinder)
+			if !ok {
+				u.LogPrint(3, "Ticket plugin can't look up tickets, leaving reservation for %v open", res.TargetResource)
+				continue
+			}
+			row := ticketinterfaces.RecommendationQueryResult{
+				ProjectId:          res.ProjectID,
+				RecommenderName:    res.RecommenderID,
+				RecommenderSubtype: res.RecommenderSubtype,
+				TargetResource:     res.TargetResource,
+			}
+			issueKey, err = finder.FindTicket(ticket, row)
+			if err != nil {
+				u.LogPrint(3, "Failed to look up ticket for %v: %v", res.TargetResource, err)
+				continue
+			}
+			if issueKey == "" {
+				u.LogPrint(2, "No ticket was created for %v, releasing reservation", res.TargetResource)
+				res.State = b.ReservationReleased
+				resolved = append(resolved, res)
+				continue
+			}
+		}
+		res.IssueKey = issueKey
+		res.State = b.ReservationFinalized
+		resolved = append(resolved, res)
+		// The ticket row may have made it in before we died
+		_, err := b.GetTicketByIssueKey(issueKey)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, b.ErrTicketNotFound) {
+			return err
+		}
+		ticket.IssueKey = issueKey
+		tickets = append(tickets, ticket)
+	}
+	if len(tickets) > 0 {
+		if err := b.AppendTicketsToTable(c.Store.TicketTable, tickets); err != nil {
+			return err
+		}
+	}
+	if len(resolved) > 0 {
+		if err := b.AppendReservations(c.Store.ReservationTable, resolved); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// reservationToTicket rebuilds the ticket row we would have written for a reservation.
+func reservationToTicket(res *ticketinterfaces.TicketReservation) *ticketinterfaces.Ticket {
+	now := time.Now().Format(time.RFC3339)
+	return &ticketinterfaces.Ticket{
+		TargetContact:  res.TargetContact,
+		CreationDate:   res.CreationDate,
+		Status:         "New",
+		TargetResource: res.TargetResource,
+		RecommenderID:  res.RecommenderID,
+		LastUpdateDate: now,
+		LastPingDate:   res.CreationDate,
+		SnoozeDate:     time.Now().AddDate(0,0,policy.Current().Match(res.RecommenderID, res.RecommenderSubtype).SnoozeDays).Format(time.RFC3339),
+		Subject:        res.Subject,
+		Assignee:       res.Assignee,
+		Locale:         res.Locale,
+	}
+}
+
+// excludeSubTypesFilter builds the subtype filter for CheckQueryTpl.
+// Subtypes are validated on load, so quoting is all that's needed.
+func excludeSubTypesFilter(subtypes []string) string {
+	if len(subtypes) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(subtypes))
+	for i, subtype := range subtypes {
+		quoted[i] = "'" + subtype + "'"
+	}
+	return fmt.Sprintf("AND recommender_subtype NOT IN (%s)", strings.Join(quoted, ", "))
+}
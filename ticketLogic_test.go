@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	t "ticketservice/internal/ticketinterfaces"
+)
+
+// fakeTicketService records the events posted to tickets and the tickets it reopens
+type fakeTicketService struct {
+	events   []string
+	reopened []string
+}
+
+func (f *fakeTicketService) Init() error { return nil }
+
+func (f *fakeTicketService) CreateTicket(ticket *t.Ticket, row t.RecommendationQueryResult) (string, error) {
+	return "", nil
+}
+
+func (f *fakeTicketService) UpdateTicket(ticket *t.Ticket, row t.RecommendationQueryResult, event string) error {
+	f.events = append(f.events, ticket.IssueKey+" "+event)
+	return nil
+}
+
+func (f *fakeTicketService) CloseTicket(issueKey string) error { return nil }
+
+func (f *fakeTicketService) ReopenTicket(issueKey string) error {
+	f.reopened = append(f.reopened, issueKey)
+	return nil
+}
+
+func (f *fakeTicketService) GetTicket(issueKey string) (t.Ticket, error) { return t.Ticket{}, nil }
+
+func (f *fakeTicketService) HandleWebhookAction(echo.Context) error { return nil }
+
+func useFakeTicketService(test *testing.T) *fakeTicketService {
+	fake := &fakeTicketService{}
+	previous := ticketService
+	ticketService = fake
+	test.Cleanup(func() { ticketService = previous })
+	return fake
+}
+
+func TestProcessRecommendationRemindsOpenTickets(test *testing.T) {
+	for _, status := range []string{"New", "Snoozed", "Reopened"} {
+		fake := useFakeTicketService(test)
+		past := time.Now().AddDate(0, 0, -1).Format(time.RFC3339)
+		row := t.RecommendationQueryResult{
+			RecommenderName: "google.compute.instance.MachineTypeRecommender",
+			Ticket:          &t.Ticket{IssueKey: "C123", Status: status, SnoozeDate: past, LastUpdateDate: past},
+		}
+		ticket, _, err := processRecommendation(row)
+		if err != nil {
+			test.Fatalf("%s: unexpected error: %v", status, err)
+		}
+		if ticket == nil {
+			test.Fatalf("%s: got no ticket row", status)
+		}
+		if ticket.SnoozeDate == past {
+			test.Errorf("%s: snooze date wasn't moved", status)
+		}
+		if ticket.LastUpdateDate == past {
+			test.Errorf("%s: reminder row isn't the latest", status)
+		}
+		if len(fake.events) != 1 || fake.events[0] != "C123 "+t.EventReminder {
+			test.Errorf("%s: posted %v, want one reminder", status, fake.events)
+		}
+	}
+}
+
+func TestProcessRecommendationLeavesOutTicketsNotDue(test *testing.T) {
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1).Format(time.RFC3339)
+	tomorrow := now.AddDate(0, 0, 1).Format(time.RFC3339)
+	// The default policy snoozes for 7 days
+	lastWeek := now.AddDate(0, 0, -8).Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		ticket t.Ticket
+		// Empty when the row is left out
+		wantEvent  string
+		wantStatus string
+	}{
+		{"open and due", t.Ticket{Status: "New", SnoozeDate: yesterday, LastUpdateDate: lastWeek}, t.EventReminder, "New"},
+		{"snoozed", t.Ticket{Status: "Snoozed", SnoozeDate: tomorrow, LastUpdateDate: yesterday}, "", ""},
+		{"closed recently", t.Ticket{Status: "Closed", SnoozeDate: lastWeek, LastUpdateDate: yesterday}, "", ""},
+		{"closed a while ago", t.Ticket{Status: "Closed", SnoozeDate: lastWeek, LastUpdateDate: lastWeek}, t.EventReopened, "Reopened"},
+		{"closed while snoozed", t.Ticket{Status: "Closed", SnoozeDate: tomorrow, LastUpdateDate: lastWeek}, "", ""},
+		{"closed, as the query formats it", t.Ticket{Status: "Closed", SnoozeDate: "1970-01-01T00:00:00+0000", LastUpdateDate: now.AddDate(0, 0, -8).Format(queryDateFormat)}, t.EventReopened, "Reopened"},
+		{"dismissed recently", t.Ticket{Status: "Dismissed", SnoozeDate: lastWeek, LastUpdateDate: yesterday}, "", ""},
+		// Its suppression would keep it out of the query until lifted
+		{"dismissed and lifted", t.Ticket{Status: "Dismissed", SnoozeDate: lastWeek, LastUpdateDate: lastWeek}, t.EventReopened, "Reopened"},
+	}
+	for _, tt := range tests {
+		fake := useFakeTicketService(test)
+		ticket := tt.ticket
+		ticket.IssueKey = "C123"
+		ticket.Reason = t.ReasonPlanned
+		row := t.RecommendationQueryResult{
+			RecommenderName: "google.compute.instance.MachineTypeRecommender",
+			Ticket:          &ticket,
+		}
+		got, reservation, err := processRecommendation(row)
+		if err != nil {
+			test.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if reservation != nil {
+			test.Errorf("%s: got a reservation for an existing ticket", tt.name)
+		}
+		if tt.wantEvent == "" {
+			if got != nil || len(fake.events) != 0 || len(fake.reopened) != 0 {
+				test.Errorf("%s: got row %v, posted %v and reopened %v, want it left out", tt.name, got, fake.events, fake.reopened)
+			}
+			continue
+		}
+		if got == nil {
+			test.Fatalf("%s: got no ticket row", tt.name)
+		}
+		if got.Status != tt.wantStatus {
+			test.Errorf("%s: status %q, want %q", tt.name, got.Status, tt.wantStatus)
+		}
+		if len(fake.events) != 1 || fake.events[0] != "C123 "+tt.wantEvent {
+			test.Errorf("%s: posted %v, want %s", tt.name, fake.events, tt.wantEvent)
+		}
+		if reopened := tt.wantEvent == t.EventReopened; reopened != (len(fake.reopened) == 1) {
+			test.Errorf("%s: reopened %v in the backend", tt.name, fake.reopened)
+		} else if reopened && got.Reason != "" {
+			test.Errorf("%s: reopened ticket kept reason %q", tt.name, got.Reason)
+		}
+	}
+}